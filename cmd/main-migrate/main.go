@@ -1,13 +1,177 @@
 package main
 
 import (
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/riskibarqy/go-template/config"
 	"github.com/riskibarqy/go-template/databases"
 )
 
+const usage = `Usage: main-migrate [flags] <command> [argument]
+
+Runs the migrations embedded in the binary against DB_CONNECTION_STRING.
+The migrations are written for postgres, a sqlite or mysql database is created by the schema command instead.
+
+Commands:
+  up              apply all the pending migrations
+  down [N]        roll back the last N applied migrations, 1 by default
+  goto VERSION    migrate up or down to the version
+  force VERSION   set the version without running any migration, to recover from a dirty database
+  version         print the version of the last applied migration
+  status          list the migrations and whether they're applied
+  create NAME     create the up and down files of a new migration in the source tree
+  schema          create the missing tables of a sqlite or mysql database from databases/schema
+
+Flags:
+`
+
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print the SQL of the migrations that would run without running them")
+	dir := flag.String("dir", databases.MigrationsDir, "the directory the create command writes the migration to")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, arg := flag.Arg(0), flag.Arg(1)
+
+	// creating a migration doesn't need the database
+	if command == "create" {
+		paths, err := databases.CreateMigration(*dir, arg)
+		if err != nil {
+			log.Fatalf("Failed to create the migration: %v", err)
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return
+	}
+
 	config.GetConfiguration()
-	databases.NewMigrator(config.AppConfig.DBConnectionString).Run("up")
+	// the migrations are written in the postgres dialect, the other databases get the schema of the last migration
+	if config.AppConfig.DBDriver != "postgres" {
+		if command != "schema" {
+			log.Fatalf("Migrations only support postgres, DB_DRIVER is %q, run the schema command instead", config.AppConfig.DBDriver)
+		}
+		err := applySchema(config.AppConfig.DBDriver, config.AppConfig.DBConnectionString, *dryRun)
+		if err != nil {
+			log.Fatalf("Schema failed: %v", err)
+		}
+		return
+	}
+	if command == "schema" {
+		log.Fatalf("The schema command only supports sqlite and mysql, run the migrations on postgres")
+	}
+
+	migrator := databases.NewMigrator(config.AppConfig.DBConnectionString)
+	migrator.DryRun = *dryRun
+
+	var err error
+	switch command {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		n := 1
+		if arg != "" {
+			n, err = strconv.Atoi(arg)
+			if err != nil {
+				log.Fatalf("Invalid number of migrations %q", arg)
+			}
+		}
+		err = migrator.Down(n)
+	case "goto":
+		version, errParse := strconv.ParseUint(arg, 10, 64)
+		if errParse != nil {
+			log.Fatalf("Invalid version %q", arg)
+		}
+		err = migrator.Goto(uint(version))
+	case "force":
+		version, errParse := strconv.Atoi(arg)
+		if errParse != nil {
+			log.Fatalf("Invalid version %q", arg)
+		}
+		err = migrator.Force(version)
+	case "version":
+		version, dirty, errVersion := migrator.Version()
+		if errVersion == nil {
+			fmt.Print(version)
+			if dirty {
+				fmt.Print(" (dirty)")
+			}
+			fmt.Println()
+		}
+		err = errVersion
+	case "status":
+		err = printStatus(migrator)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Migration %s failed: %v", command, err)
+	}
+
+	if !*dryRun && (command == "up" || command == "down" || command == "goto" || command == "force") {
+		fmt.Printf("Migration %s done\n", command)
+	}
+}
+
+// applySchema creates the missing tables of the database, or prints their statements in a dry run
+func applySchema(driver string, dsn string, dryRun bool) error {
+	if dryRun {
+		statements, err := databases.Schema(driver)
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			fmt.Printf("%s;\n\n", statement)
+		}
+		return nil
+	}
+
+	db, err := sqlx.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	err = databases.ApplySchema(db, driver)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Schema done")
+	return nil
+}
+
+// printStatus prints the migrations and whether they're applied
+func printStatus(migrator *databases.Migrator) error {
+	migrations, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+	for _, migration := range migrations {
+		status := "pending"
+		if migration.Dirty {
+			status = "dirty"
+		} else if migration.Applied {
+			status = "applied"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, status)
+	}
+	return w.Flush()
 }
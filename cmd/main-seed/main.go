@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/riskibarqy/go-template/config"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/databases/seeders"
+)
+
+const usage = `Usage: main-seed [flags] <command> [argument]
+
+Seeds the database of DB_CONNECTION_STRING with the data of an environment, apart from the migrations.
+Every seeder is applied once, the applied ones are recorded in the seed_history table.
+
+Commands:
+  run             apply the pending seeders of the environment
+  status          list the seeders of the environment and whether they're applied
+  fake-users N    insert N fake users with random names, whose password is "` + seeders.FakeUserPassword + `",
+                  to load test the listing of the users, they're not recorded in the seed history
+
+Flags:
+`
+
+func main() {
+	env := flag.String("env", "", "the environment to seed, APP_MODE by default")
+	dryRun := flag.Bool("dry-run", false, "print the seeders that would be applied without applying them")
+	clientID := flag.Int("client", seeders.DefaultClientID, "the client owning the fake users")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	command, arg := flag.Arg(0), flag.Arg(1)
+
+	config.GetConfiguration()
+	if *env == "" {
+		*env = config.AppConfig.AppMode
+	}
+	if len(seeders.For(*env)) == 0 {
+		log.Fatalf("No seeder is registered for the %s environment, the environments are %v", *env, seeders.Environments())
+	}
+
+	databases.Init()
+	db := config.AppConfig.DatabaseClient
+	defer db.Close()
+
+	ctx := context.Background()
+	runner := seeders.NewRunner(db, *env)
+	runner.DryRun = *dryRun
+
+	var err error
+	switch command {
+	case "run":
+		var applied []string
+		applied, err = runner.Run(ctx)
+		if err == nil && !*dryRun {
+			fmt.Printf("Seeded %s, %d seeder(s) applied\n", *env, len(applied))
+		}
+	case "status":
+		err = printStatus(ctx, runner)
+	case "fake-users":
+		n, errParse := strconv.Atoi(arg)
+		if errParse != nil {
+			log.Fatalf("Invalid number of users %q", arg)
+		}
+		if *dryRun {
+			fmt.Printf("Would insert %d fake users\n", n)
+			return
+		}
+
+		var inserted int
+		start := time.Now()
+		inserted, err = seeders.InsertFakeUsers(ctx, db, n, *clientID, rand.New(rand.NewSource(time.Now().UnixNano())))
+		fmt.Printf("Inserted %d fake users in %s\n", inserted, time.Since(start).Round(time.Millisecond))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Seed %s failed: %v", command, err)
+	}
+}
+
+// printStatus prints the seeders of the environment and whether they're applied
+func printStatus(ctx context.Context, runner *seeders.Runner) error {
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		if status.Applied {
+			fmt.Fprintf(w, "%s\tapplied\t%s\n", status.Name, status.AppliedAt.Format(time.RFC3339))
+		} else {
+			fmt.Fprintf(w, "%s\tpending\t\n", status.Name)
+		}
+	}
+	return w.Flush()
+}
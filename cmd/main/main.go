@@ -4,14 +4,19 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/ancalabrese/reload"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/riskibarqy/go-template/config"
 	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/audit"
+	auditPg "github.com/riskibarqy/go-template/internal/audit/postgres"
 	"github.com/riskibarqy/go-template/internal/data"
 	internalhttp "github.com/riskibarqy/go-template/internal/http"
+	"github.com/riskibarqy/go-template/internal/outbox"
 	"github.com/riskibarqy/go-template/internal/redis"
 	"github.com/riskibarqy/go-template/internal/user"
 	userPg "github.com/riskibarqy/go-template/internal/user/postgres"
@@ -22,17 +27,74 @@ var ctx = context.Background()
 
 // InternalServices represents all the internal domain services
 type InternalServices struct {
-	userService user.ServiceInterface
+	userService  user.ServiceInterface
+	auditService audit.ServiceInterface
+	outboxRelay  *outbox.Relay
 }
 
-func buildInternalServices(db *sqlx.DB, _ *config.Config) *InternalServices {
+func buildInternalServices(db *sqlx.DB, replicas *data.ReplicaSet, metrics *data.QueryMetrics, cfg *config.Config) *InternalServices {
+	eventOutbox := outbox.New(data.NewStorage[models.OutboxEvent](db, outbox.TableName).SetMetrics(metrics).Generic())
+
+	var sinks []outbox.Sink
+	if cfg.OutboxWebhookURL != "" {
+		sinks = append(sinks, outbox.NewWebhookSink(cfg.OutboxWebhookURL))
+	}
+	if cfg.OutboxRedisStream != "" {
+		sinks = append(sinks, outbox.NewRedisStreamSink(redis.RedisClient, cfg.OutboxRedisStream))
+	}
+	if len(sinks) == 0 {
+		sinks = append(sinks, outbox.LogSink{})
+	}
+
+	auditLogStorage := data.NewStorage[models.AuditLog](db, "audit_log").SetReplicas(replicas).SetMetrics(metrics).Generic()
+	auditor := data.NewAuditor(auditLogStorage)
+
 	userPostgresStorage := userPg.NewPostgresStorage(
-		data.NewPostgresStorage(db, "user", models.User{}),
+		data.NewStorage[models.User](db, user.TableName).SetReplicas(replicas).SetMetrics(metrics).SetAuditor(auditor).Generic(),
 	)
+	auditPostgresStorage := auditPg.NewPostgresStorage(auditLogStorage)
 
-	userService := user.NewService(userPostgresStorage)
+	userService := user.NewService(userPostgresStorage, eventOutbox)
+	auditService := audit.NewService(auditPostgresStorage)
 	return &InternalServices{
-		userService: userService,
+		userService:  userService,
+		auditService: auditService,
+		outboxRelay:  outbox.NewRelay(eventOutbox, sinks...),
+	}
+}
+
+// verifySchema compares the models of the storages with their tables and checks the migrations are applied,
+// the differences stop the production mode and are only logged in the other modes.
+// The migrations only run on postgres, the other databases are only compared with the models.
+func verifySchema(db *sqlx.DB) {
+	problems := []string{}
+
+	issues, err := data.VerifySchema(ctx)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, issue := range issues {
+		problems = append(problems, issue.String())
+	}
+
+	if config.AppConfig.DBDriver == "postgres" {
+		pending, err := databases.PendingMigrations(db)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, migration := range pending {
+			problems = append(problems, fmt.Sprintf("migration %s is not applied", migration))
+		}
+	}
+
+	if len(problems) == 0 {
+		return
+	}
+	for _, problem := range problems {
+		log.Printf("Schema verification: %s", problem)
+	}
+	if config.AppConfig.AppMode == "production" {
+		log.Fatalf("Schema verification failed with %d problem(s)", len(problems))
 	}
 }
 
@@ -74,13 +136,43 @@ func main() {
 	// Print the current mode
 	fmt.Printf("Running in %s mode\n", config.AppConfig.AppMode)
 
+	operationTimeouts := map[data.Operation]time.Duration{}
+	for op, timeout := range config.AppConfig.DBOperationTimeouts {
+		operationTimeouts[data.Operation(op)] = timeout
+	}
+	data.SetTimeouts(data.Timeouts{
+		Default:    config.AppConfig.DBQueryTimeout,
+		Operations: operationTimeouts,
+	})
+
+	metrics, err := data.NewQueryMetrics(prometheus.DefaultRegisterer, config.AppConfig.DBSlowQueryThreshold)
+	if err != nil {
+		log.Fatalf("Failed to register the query metrics: %v", err)
+	}
+	err = data.RegisterDBStats(prometheus.DefaultRegisterer, config.AppConfig.DatabaseClient, "primary")
+	if err != nil {
+		log.Fatalf("Failed to register the database metrics: %v", err)
+	}
+	for i, replica := range config.AppConfig.ReplicaClients {
+		err = data.RegisterDBStats(prometheus.DefaultRegisterer, replica, fmt.Sprintf("replica_%d", i+1))
+		if err != nil {
+			log.Fatalf("Failed to register the database metrics: %v", err)
+		}
+	}
+
 	dataManager := data.NewManager(config.AppConfig.DatabaseClient)
-	internalServices := buildInternalServices(config.AppConfig.DatabaseClient, config.AppConfig)
+	replicas := data.NewReplicaSet(10*time.Second, config.AppConfig.ReplicaClients...)
+	internalServices := buildInternalServices(config.AppConfig.DatabaseClient, replicas, metrics, config.AppConfig)
+	if config.AppConfig.DBVerifySchema {
+		verifySchema(config.AppConfig.DatabaseClient)
+	}
+	go internalServices.outboxRelay.Run(ctx)
 
 	s := internalhttp.NewServer(
 		config.AppConfig,
 		dataManager,
 		internalServices.userService,
+		internalServices.auditService,
 	)
 
 	s.Serve()
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestParseDurations(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want map[string]time.Duration
+	}{
+		{"empty", "", map[string]time.Duration{}},
+		{"durations", "Insert=5s, Where = 10s", map[string]time.Duration{"Insert": 5 * time.Second, "Where": 10 * time.Second}},
+		{"invalid duration is skipped", "Insert=5s,Where=soon", map[string]time.Duration{"Insert": 5 * time.Second}},
+		{"pair without duration is skipped", "Insert,Where=1m", map[string]time.Duration{"Where": time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseDurations(tt.s); !maps.Equal(got, tt.want) {
+				t.Errorf("parseDurations(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDurationOrDefault(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		defaultVal time.Duration
+		want       time.Duration
+	}{
+		{"not set", "", 0, 0},
+		{"not set with default", "", time.Second, time.Second},
+		{"set", "250ms", time.Second, 250 * time.Millisecond},
+		{"invalid", "soon", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(dbQueryTimeout, tt.value)
+			if got := getDurationOrDefault(dbQueryTimeout, tt.defaultVal); got != tt.want {
+				t.Errorf("getDurationOrDefault() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigurationDefaults(t *testing.T) {
+	t.Setenv(dbQueryTimeout, "")
+	t.Setenv(dbOperationTimeouts, "Insert=5s,Delete=never")
+	t.Setenv(dbVerifySchema, "")
+	GetConfiguration()
+
+	if AppConfig.DBVerifySchema {
+		t.Errorf("DBVerifySchema = true, want the schema verification disabled by default")
+	}
+
+	if AppConfig.DBQueryTimeout != 0 {
+		t.Errorf("DBQueryTimeout = %s, want no timeout", AppConfig.DBQueryTimeout)
+	}
+	want := map[string]time.Duration{"Insert": 5 * time.Second}
+	if !maps.Equal(AppConfig.DBOperationTimeouts, want) {
+		t.Errorf("DBOperationTimeouts = %v, want %v", AppConfig.DBOperationTimeouts, want)
+	}
+}
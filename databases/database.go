@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log"
 
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 	"github.com/riskibarqy/go-template/config"
+	_ "modernc.org/sqlite"
 )
 
 // Init Connect to the database
@@ -13,7 +16,7 @@ func Init() {
 	fmt.Println("DB Connection String:", config.AppConfig.DBConnectionString)
 
 	// Open new database connection
-	db, err := sqlx.Open("postgres", config.AppConfig.DBConnectionString)
+	db, err := sqlx.Open(config.AppConfig.DBDriver, config.AppConfig.DBConnectionString)
 	if err != nil {
 		log.Fatalf("Failed to reconnect to the database: %v", err)
 	}
@@ -22,4 +25,17 @@ func Init() {
 	config.AppConfig.DatabaseClient = db
 
 	log.Println("Successfully connected to the database")
+
+	// Open the read replicas, the reads fall back to the primary when none is available
+	config.AppConfig.ReplicaClients = []*sqlx.DB{}
+	for i, dsn := range config.AppConfig.DBReplicaConnectionStrings {
+		replica, err := sqlx.Open(config.AppConfig.DBDriver, dsn)
+		if err != nil {
+			log.Printf("Failed to connect to the database replica %d: %v", i, err)
+			continue
+		}
+		config.AppConfig.ReplicaClients = append(config.AppConfig.ReplicaClients, replica)
+	}
+
+	log.Printf("Connected to %d database replica(s)", len(config.AppConfig.ReplicaClients))
 }
@@ -2,62 +2,362 @@ package databases
 
 import (
 	"database/sql"
+	"embed"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/lib/pq"
 )
 
+// migrationsFS holds the migrations, embedded in the binary so it migrates from any directory
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// MigrationsDir is the directory of the migrations in the source tree, where the new migrations are created
+const MigrationsDir = "databases/migrations"
+
+// Migration is an embedded migration and its state in the database
+type Migration struct {
+	Version uint
+	Name    string
+	Applied bool
+	Dirty   bool
+}
+
+// Migrator runs the embedded migrations against a postgres database
 type Migrator struct {
 	DBURL string
+	// DryRun prints the SQL of the migrations that would run to Out instead of running them
+	DryRun bool
+	Out    io.Writer
 }
 
+// NewMigrator creates a migrator of the database, printing to the standard output
 func NewMigrator(dbURL string) *Migrator {
-	return &Migrator{DBURL: dbURL}
+	return &Migrator{
+		DBURL: dbURL,
+		Out:   os.Stdout,
+	}
+}
+
+// migrationsSource returns the source of the embedded migrations
+func migrationsSource() (source.Driver, error) {
+	return iofs.New(migrationsFS, "migrations")
+}
+
+// Up applies all the pending migrations
+func (m *Migrator) Up() error {
+	if m.DryRun {
+		return m.plan(func(versions []uint, current uint) (uint, error) {
+			if len(versions) == 0 {
+				return current, nil
+			}
+			return versions[len(versions)-1], nil
+		})
+	}
+
+	return m.run(func(mg *migrate.Migrate) error {
+		return mg.Up()
+	})
+}
+
+// Down rolls back the last n applied migrations
+func (m *Migrator) Down(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("the number of migrations to roll back must be positive, got %d", n)
+	}
+
+	if m.DryRun {
+		return m.plan(func(versions []uint, current uint) (uint, error) {
+			if current == 0 {
+				return 0, nil
+			}
+			i := indexOf(versions, current)
+			if i < 0 {
+				return 0, fmt.Errorf("the applied version %d is not an embedded migration", current)
+			}
+			if i-n < 0 {
+				return 0, nil
+			}
+			return versions[i-n], nil
+		})
+	}
+
+	return m.run(func(mg *migrate.Migrate) error {
+		return mg.Steps(-n)
+	})
 }
 
-func (m *Migrator) Run(action string) {
-	// Connect to the database
+// Goto migrates up or down to the version
+func (m *Migrator) Goto(version uint) error {
+	if m.DryRun {
+		return m.plan(func(versions []uint, current uint) (uint, error) {
+			if indexOf(versions, version) < 0 {
+				return 0, fmt.Errorf("no migration has the version %d", version)
+			}
+			return version, nil
+		})
+	}
+
+	return m.run(func(mg *migrate.Migrate) error {
+		return mg.Migrate(version)
+	})
+}
+
+// Force sets the version of the database without running any migration and clears its dirty state,
+// to recover from a migration that failed halfway once the database is fixed by hand. -1 means no version.
+func (m *Migrator) Force(version int) error {
+	if m.DryRun {
+		fmt.Fprintf(m.Out, "-- the version would be forced to %d\n", version)
+		return nil
+	}
+
+	return m.run(func(mg *migrate.Migrate) error {
+		return mg.Force(version)
+	})
+}
+
+// Version returns the version of the last applied migration, zero when none was applied,
+// and whether it failed halfway
+func (m *Migrator) Version() (uint, bool, error) {
 	db, err := sql.Open("postgres", m.DBURL)
 	if err != nil {
-		log.Fatal("Failed to connect to the database:", err)
+		return 0, false, err
+	}
+	defer db.Close()
+
+	return currentVersion(db)
+}
+
+// Status lists the embedded migrations and whether they're applied
+func (m *Migrator) Status() ([]*Migration, error) {
+	current, dirty, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := migrationsSource()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []*Migration{}
+	for _, version := range versions {
+		_, name, err := readMigration(src, version, true)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, &Migration{
+			Version: version,
+			Name:    name,
+			Applied: version <= current,
+			Dirty:   dirty && version == current,
+		})
+	}
+	return migrations, nil
+}
+
+// run runs the operation with golang-migrate, a database already at the target is not an error
+func (m *Migrator) run(operation func(mg *migrate.Migrate) error) error {
+	db, err := sql.Open("postgres", m.DBURL)
+	if err != nil {
+		return fmt.Errorf("connect to the database: %w", err)
 	}
 	defer db.Close()
 
-	// Create migration driver
 	driver, err := postgres.WithInstance(db, &postgres.Config{})
 	if err != nil {
-		log.Fatal("Failed to create migration driver:", err)
+		return fmt.Errorf("create the migration driver: %w", err)
 	}
 
-	migrator, err := migrate.NewWithDatabaseInstance(
-		"file://databases/migrations",
-		"postgres", driver,
-	)
+	src, err := migrationsSource()
 	if err != nil {
-		log.Fatal("Failed to initialize migration:", err)
+		return err
 	}
 
-	// Execute the specified migration action
-	switch action {
-	case "up":
-		err = migrator.Up()
-		if err != nil && err != migrate.ErrNoChange {
-			log.Fatal("Migration up failed:", err)
+	mg, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		return fmt.Errorf("initialize the migrations: %w", err)
+	}
+	defer mg.Close()
+
+	err = operation(mg)
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+	return nil
+}
+
+// plan prints the SQL of the migrations from the current version to the target version returned by target,
+// the up migrations when the target is above the current version and the down ones otherwise.
+// It only reads the database.
+func (m *Migrator) plan(target func(versions []uint, current uint) (uint, error)) error {
+	current, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("the migration %d failed halfway, fix the database and force its version first", current)
+	}
+
+	src, err := migrationsSource()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return err
+	}
+
+	to, err := target(versions, current)
+	if err != nil {
+		return err
+	}
+
+	steps := []uint{}
+	up := to > current
+	if up {
+		for _, version := range versions {
+			if version > current && version <= to {
+				steps = append(steps, version)
+			}
 		}
-		fmt.Println("Migrations applied successfully!")
+	} else {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i] <= current && versions[i] > to {
+				steps = append(steps, versions[i])
+			}
+		}
+	}
+
+	if len(steps) == 0 {
+		fmt.Fprintln(m.Out, "-- no migration to run")
+		return nil
+	}
+
+	for _, version := range steps {
+		body, name, err := readMigration(src, version, up)
+		if err != nil {
+			return err
+		}
+
+		direction := "down"
+		if up {
+			direction = "up"
+		}
+		fmt.Fprintf(m.Out, "-- %d_%s.%s.sql\n%s\n\n", version, name, direction, strings.TrimSpace(body))
+	}
+	return nil
+}
+
+// currentVersion returns the version recorded by golang-migrate, zero when no migration was applied
+func currentVersion(db *sql.DB) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := db.QueryRow(`SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
 
-	case "down":
-		err = migrator.Steps(-1) // Rollback the last applied migration
-		if err != nil && err != migrate.ErrNoChange {
-			log.Fatal("Migration down failed:", err)
+	// the table of the versions is created by the first migration
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "42P01" {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read the applied migrations: %w", err)
+	}
+	return version, dirty, nil
+}
+
+// sourceVersions returns the versions of the migrations of the source, in ascending order
+func sourceVersions(src source.Driver) ([]uint, error) {
+	versions := []uint{}
+	version, err := src.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// readMigration returns the SQL and the name of the up or down migration of the version
+func readMigration(src source.Driver, version uint, up bool) (string, string, error) {
+	read := src.ReadDown
+	if up {
+		read = src.ReadUp
+	}
+
+	r, name, err := read(version)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), name, nil
+}
+
+// indexOf returns the index of the version, -1 when it's missing
+func indexOf(versions []uint, version uint) int {
+	for i, v := range versions {
+		if v == version {
+			return i
 		}
-		fmt.Println("Last migration rolled back!")
+	}
+	return -1
+}
+
+// migrationNamePattern matches the characters replaced in the name of a new migration
+var migrationNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
 
-	default:
-		log.Fatal("Invalid migration action. Use 'up' or 'down'")
+// CreateMigration creates the empty up and down files of a new migration in the directory,
+// versioned by the current unix time, and returns their paths.
+// The migration is embedded once the binary is built again.
+func CreateMigration(dir string, name string) ([]string, error) {
+	name = strings.Trim(migrationNamePattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, fmt.Errorf("the migration needs a name")
+	}
+
+	version := time.Now().Unix()
+	paths := []string{}
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%d_%s.%s.sql", version, name, direction))
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		f.Close()
+		paths = append(paths, path)
 	}
+	return paths, nil
 }
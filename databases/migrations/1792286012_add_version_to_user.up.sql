@@ -0,0 +1,2 @@
+-- Version of the row used for optimistic locking, incremented on every update
+ALTER TABLE public."user" ADD COLUMN "version" INT NOT NULL DEFAULT 1;
@@ -0,0 +1,17 @@
+CREATE TABLE public."audit_log"
+(
+    "id" BIGSERIAL NOT NULL,
+    "table_name" VARCHAR(100) NOT NULL,
+    "row_id" VARCHAR(64) NOT NULL,
+    "action" VARCHAR(20) NOT NULL,
+    -- The changed columns with their old and new values, the secrets are redacted
+    "changes" JSONB NOT NULL,
+    -- The acting user, NULL when the change wasn't made by a logged-in user
+    "user_id" INT,
+    "request_id" VARCHAR(100),
+    "created_at" INT NOT NULL,
+    CONSTRAINT audit_log_pkey PRIMARY KEY ("id")
+);
+
+-- Add an index on the audited row to optimize the history queries
+CREATE INDEX audit_log_row_idx ON public."audit_log"("table_name", "row_id", "id");
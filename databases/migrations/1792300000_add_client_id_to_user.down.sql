@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS public.user_client_id_idx;
+ALTER TABLE public."user" DROP COLUMN IF EXISTS "client_id";
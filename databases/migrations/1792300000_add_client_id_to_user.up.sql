@@ -0,0 +1,5 @@
+-- Client organization owning the user, the existing users belong to the first client
+ALTER TABLE public."user" ADD COLUMN "client_id" INT NOT NULL DEFAULT 1;
+
+-- Add an index on client_id as every query of the users is scoped to a client
+CREATE INDEX user_client_id_idx ON public."user"("client_id");
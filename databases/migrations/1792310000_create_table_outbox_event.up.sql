@@ -0,0 +1,18 @@
+CREATE TABLE public."outbox_event"
+(
+    "id" BIGSERIAL NOT NULL,
+    "topic" VARCHAR(100) NOT NULL,
+    -- The key of the event, e.g. the id of the changed row, the sinks may partition by it
+    "event_key" VARCHAR(100) NOT NULL,
+    "payload" JSONB NOT NULL,
+    "attempts" INT NOT NULL DEFAULT 0,
+    "last_error" TEXT,
+    -- The event is delivered or retried from then, the relay pushes it back while delivering it
+    "next_attempt_at" INT NOT NULL,
+    "delivered_at" INT,
+    "created_at" INT NOT NULL,
+    CONSTRAINT outbox_event_pkey PRIMARY KEY ("id")
+);
+
+-- Add a partial index on the pending events to optimize the polling of the relay
+CREATE INDEX outbox_event_pending_idx ON public."outbox_event"("next_attempt_at", "id") WHERE "delivered_at" IS NULL;
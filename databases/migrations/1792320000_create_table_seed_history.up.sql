@@ -0,0 +1,8 @@
+-- The seeders applied by the seed command, apart from the schema migrations
+CREATE TABLE public."seed_history"
+(
+    "name" VARCHAR(255) NOT NULL,
+    "environment" VARCHAR(50) NOT NULL,
+    "applied_at" INT NOT NULL,
+    CONSTRAINT seed_history_pkey PRIMARY KEY ("name")
+);
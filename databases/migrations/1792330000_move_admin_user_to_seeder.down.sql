@@ -0,0 +1,2 @@
+-- The removed admin user is inserted again by the admin_user seeder, run the seed command
+SELECT 1;
@@ -0,0 +1,7 @@
+-- The admin user inserted by 1738651950_user_seeder is now inserted by the admin_user seeder of databases/seeders,
+-- which only runs in the development, staging and test environments. Remove the user while it still has its seeded
+-- password, so a production database doesn't keep it, and forget the seeder so the next seed run inserts it again.
+DELETE FROM public."user"
+WHERE "email" = 'riskibarqy@gmail.com' AND "password" = '$2a$10$c2gIKDaKiwgUKlD3CnDZ7uBBbXIgID8TJtKSIHrMIko2jo6TEqKwW';
+
+DELETE FROM public."seed_history" WHERE "name" = 'admin_user';
@@ -0,0 +1 @@
+ALTER TABLE public."audit_log" DROP COLUMN IF EXISTS "client_id";
@@ -0,0 +1,7 @@
+-- Client organization owning the audited row, NULL when the audited table has no client
+ALTER TABLE public."audit_log" ADD COLUMN "client_id" INT;
+
+-- The existing audit logs of the users belong to the client of their user
+UPDATE public."audit_log" a SET "client_id" = u."client_id"
+FROM public."user" u
+WHERE a."table_name" = 'user' AND a."row_id" = u."id"::TEXT;
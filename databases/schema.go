@@ -0,0 +1,60 @@
+package databases
+
+import (
+	"embed"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// schemaFS holds the schemas of the databases the migrations don't run on,
+// the migrations are written in the postgres dialect
+//
+//go:embed schema/*.sql
+var schemaFS embed.FS
+
+// Schema returns the statements creating the tables of a database of the driver other than postgres,
+// in the state of the last migration
+func Schema(driver string) ([]string, error) {
+	b, err := schemaFS.ReadFile(fmt.Sprintf("schema/%s.sql", driver))
+	if err != nil {
+		return nil, fmt.Errorf("no schema for the driver %q, the migrations create the postgres tables", driver)
+	}
+
+	statements := []string{}
+	for _, statement := range strings.Split(string(b), ";\n") {
+		if strings.TrimSpace(stripComments(statement)) != "" {
+			statements = append(statements, strings.TrimSpace(statement))
+		}
+	}
+	return statements, nil
+}
+
+// ApplySchema creates the missing tables and indexes of a database of the driver other than postgres,
+// the existing ones are left as is
+func ApplySchema(db *sqlx.DB, driver string) error {
+	statements, err := Schema(driver)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range statements {
+		_, err = db.Exec(statement)
+		if err != nil {
+			return fmt.Errorf("apply the schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// stripComments removes the line comments of the SQL
+func stripComments(sql string) string {
+	lines := []string{}
+	for _, line := range strings.Split(sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,59 @@
+-- The schema of a mysql database, the migrations only run on postgres.
+-- It matches the schema after the last migration, update it along with every new migration.
+CREATE TABLE IF NOT EXISTS `user`
+(
+    `id` INT NOT NULL AUTO_INCREMENT,
+    `name` VARCHAR(100) NOT NULL,
+    `email` VARCHAR(100) NOT NULL UNIQUE,
+    `password` VARCHAR(255) NOT NULL,
+    `token` TEXT,
+    `token_expired_at` INT NULL,
+    `created_at` INT NOT NULL,
+    `updated_at` INT NOT NULL,
+    `deleted_at` INT,
+    `version` INT NOT NULL DEFAULT 1,
+    `client_id` INT NOT NULL DEFAULT 1,
+    PRIMARY KEY (`id`),
+    INDEX user_email_idx (`email`),
+    INDEX user_deleted_at_idx (`deleted_at`),
+    INDEX user_client_id_idx (`client_id`)
+);
+
+CREATE TABLE IF NOT EXISTS `audit_log`
+(
+    `id` BIGINT NOT NULL AUTO_INCREMENT,
+    `table_name` VARCHAR(100) NOT NULL,
+    `row_id` VARCHAR(64) NOT NULL,
+    `action` VARCHAR(20) NOT NULL,
+    `changes` JSON NOT NULL,
+    `user_id` INT,
+    `request_id` VARCHAR(100),
+    `created_at` INT NOT NULL,
+    `client_id` INT,
+    PRIMARY KEY (`id`),
+    INDEX audit_log_row_idx (`table_name`, `row_id`, `id`)
+);
+
+-- mysql has no partial index, the index covers the delivered events too
+CREATE TABLE IF NOT EXISTS `outbox_event`
+(
+    `id` BIGINT NOT NULL AUTO_INCREMENT,
+    `topic` VARCHAR(100) NOT NULL,
+    `event_key` VARCHAR(100) NOT NULL,
+    `payload` JSON NOT NULL,
+    `attempts` INT NOT NULL DEFAULT 0,
+    `last_error` TEXT,
+    `next_attempt_at` INT NOT NULL,
+    `delivered_at` INT,
+    `created_at` INT NOT NULL,
+    PRIMARY KEY (`id`),
+    INDEX outbox_event_pending_idx (`next_attempt_at`, `id`)
+);
+
+CREATE TABLE IF NOT EXISTS `seed_history`
+(
+    `name` VARCHAR(255) NOT NULL,
+    `environment` VARCHAR(50) NOT NULL,
+    `applied_at` INT NOT NULL,
+    PRIMARY KEY (`name`)
+);
@@ -0,0 +1,59 @@
+-- The schema of a sqlite database, the migrations only run on postgres.
+-- It matches the schema after the last migration, update it along with every new migration.
+CREATE TABLE IF NOT EXISTS "user"
+(
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "name" VARCHAR(100) NOT NULL,
+    "email" VARCHAR(100) NOT NULL UNIQUE,
+    "password" VARCHAR(255) NOT NULL,
+    "token" TEXT,
+    "token_expired_at" INT NULL,
+    "created_at" INT NOT NULL,
+    "updated_at" INT NOT NULL,
+    "deleted_at" INT,
+    "version" INT NOT NULL DEFAULT 1,
+    "client_id" INT NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS user_email_idx ON "user"("email");
+
+CREATE INDEX IF NOT EXISTS user_deleted_at_idx ON "user"("deleted_at");
+
+CREATE INDEX IF NOT EXISTS user_client_id_idx ON "user"("client_id");
+
+CREATE TABLE IF NOT EXISTS "audit_log"
+(
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "table_name" VARCHAR(100) NOT NULL,
+    "row_id" VARCHAR(64) NOT NULL,
+    "action" VARCHAR(20) NOT NULL,
+    "changes" TEXT NOT NULL,
+    "user_id" INT,
+    "request_id" VARCHAR(100),
+    "created_at" INT NOT NULL,
+    "client_id" INT
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_row_idx ON "audit_log"("table_name", "row_id", "id");
+
+CREATE TABLE IF NOT EXISTS "outbox_event"
+(
+    "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+    "topic" VARCHAR(100) NOT NULL,
+    "event_key" VARCHAR(100) NOT NULL,
+    "payload" TEXT NOT NULL,
+    "attempts" INT NOT NULL DEFAULT 0,
+    "last_error" TEXT,
+    "next_attempt_at" INT NOT NULL,
+    "delivered_at" INT,
+    "created_at" INT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_event_pending_idx ON "outbox_event"("next_attempt_at", "id") WHERE "delivered_at" IS NULL;
+
+CREATE TABLE IF NOT EXISTS "seed_history"
+(
+    "name" VARCHAR(255) NOT NULL PRIMARY KEY,
+    "environment" VARCHAR(50) NOT NULL,
+    "applied_at" INT NOT NULL
+);
@@ -0,0 +1,33 @@
+package databases
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	for _, driver := range []string{"sqlite", "mysql"} {
+		statements, err := Schema(driver)
+		if err != nil {
+			t.Fatalf("Schema(%s): %v", driver, err)
+		}
+
+		tables := 0
+		for _, statement := range statements {
+			if strings.HasSuffix(statement, ";") {
+				t.Errorf("Schema(%s) kept the semicolon of %q", driver, statement)
+			}
+			if strings.Contains(statement, "CREATE TABLE") {
+				tables++
+			}
+		}
+		if tables != 4 {
+			t.Errorf("Schema(%s) creates %d tables, want the user, audit_log, outbox_event and seed_history tables", driver, tables)
+		}
+	}
+
+	_, err := Schema("postgres")
+	if err == nil {
+		t.Errorf("Schema(postgres) succeeded, want an error since the migrations create the postgres tables")
+	}
+}
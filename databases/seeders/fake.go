@@ -0,0 +1,53 @@
+package seeders
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/riskibarqy/go-template/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// FakeUserPassword is the password of the fake users
+const FakeUserPassword = "password"
+
+// the names the fake users are made of
+var (
+	firstNames = []string{
+		"Adi", "Ayu", "Bayu", "Budi", "Citra", "Dewi", "Dian", "Eka", "Fajar", "Gita",
+		"Hadi", "Indah", "Joko", "Kartika", "Lestari", "Maya", "Nanda", "Putri", "Rizky", "Sari",
+		"Teguh", "Utami", "Wahyu", "Yoga", "Zahra", "Alice", "Bob", "Carol", "David", "Emma",
+	}
+	lastNames = []string{
+		"Pratama", "Saputra", "Wijaya", "Santoso", "Kusuma", "Hidayat", "Nugroho", "Setiawan", "Wibowo", "Halim",
+		"Gunawan", "Siregar", "Lubis", "Nasution", "Harahap", "Smith", "Johnson", "Brown", "Miller", "Wilson",
+	}
+)
+
+// FakeUsers generates n users with random names and unique emails, to load test the listing of the users.
+// The emails share a tag drawn from r, so users generated by another call don't collide with them.
+// Their password is FakeUserPassword, hashed once with bcrypt as hashing it for every user takes minutes.
+func FakeUsers(n int, r *rand.Rand) ([]models.User, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("the number of fake users must be positive, got %d", n)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(FakeUserPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := fmt.Sprintf("%06x", r.Intn(1<<24))
+	users := make([]models.User, n)
+	for i := range users {
+		first := firstNames[r.Intn(len(firstNames))]
+		last := lastNames[r.Intn(len(lastNames))]
+		users[i] = models.User{
+			Name:     first + " " + last,
+			Email:    strings.ToLower(fmt.Sprintf("%s.%s.%s%d@example.com", first, last, tag, i+1)),
+			Password: string(hash),
+		}
+	}
+	return users, nil
+}
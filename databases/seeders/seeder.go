@@ -0,0 +1,232 @@
+package seeders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// The environments a seeder is registered for, the values of APP_MODE
+const (
+	EnvDevelopment = "development"
+	EnvStaging     = "staging"
+	EnvTest        = "test"
+)
+
+// SeedHistoryTableName is the table of the applied seeders
+const SeedHistoryTableName = "seed_history"
+
+// Seeder inserts the data an environment needs to be usable, e.g. an admin user.
+// A seeder is applied once per database, the runner records it in the seed history.
+type Seeder struct {
+	// Name identifies the seeder in the seed history, renaming it applies it again
+	Name         string
+	Environments []string
+	// Seed inserts the data with the transaction and the storages of tx, along with the context holding the transaction
+	Seed func(ctx context.Context, tx *Tx) error
+}
+
+// Tx is the transaction a seeder runs in. Its Queryer always runs in the transaction,
+// the storages of Storage only with the context passed to the seeder, or a context derived from it.
+type Tx struct {
+	// Queryer runs the raw queries in the transaction
+	data.Queryer
+	db *sqlx.DB
+}
+
+// Storage returns the storage of the table. It's built on the database of tx and takes the transaction
+// from the context of its queries, as every storage: the queries run with the context passed to the seeder
+// are in the transaction, the ones run with another context are not and escape its rollback.
+func Storage[T any](tx *Tx, tableName string) *data.Storage[T] {
+	return data.NewStorage[T](tx.db, tableName)
+}
+
+// registry holds the registered seeders, in their order of registration
+var registry struct {
+	mu      sync.Mutex
+	seeders []*Seeder
+}
+
+// Register registers a seeder, it panics when a seeder of the same name is already registered
+func Register(seeder *Seeder) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, registered := range registry.seeders {
+		if registered.Name == seeder.Name {
+			panic(fmt.Sprintf("seeders: the seeder %s is registered twice", seeder.Name))
+		}
+	}
+	registry.seeders = append(registry.seeders, seeder)
+}
+
+// For returns the seeders registered for the environment, in their order of registration
+func For(environment string) []*Seeder {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	seeders := []*Seeder{}
+	for _, seeder := range registry.seeders {
+		for _, env := range seeder.Environments {
+			if env == environment {
+				seeders = append(seeders, seeder)
+				break
+			}
+		}
+	}
+	return seeders
+}
+
+// Status is a seeder of an environment and whether it's applied
+type Status struct {
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Runner applies the seeders of an environment that are not in the seed history yet
+type Runner struct {
+	db          *sqlx.DB
+	manager     *data.Manager
+	history     *data.Storage[models.SeedHistory]
+	environment string
+	// DryRun prints the seeders that would be applied to Out instead of applying them
+	DryRun bool
+	Out    io.Writer
+}
+
+// NewRunner creates a runner of the seeders of the environment, printing to the standard output
+func NewRunner(db *sqlx.DB, environment string) *Runner {
+	return &Runner{
+		db:          db,
+		manager:     data.NewManager(db),
+		history:     data.NewStorage[models.SeedHistory](db, SeedHistoryTableName),
+		environment: environment,
+		Out:         os.Stdout,
+	}
+}
+
+// Run applies the pending seeders of the environment, each one in its own transaction with its
+// record in the seed history, so a failing seeder leaves no data behind and is applied again
+// by the next run. It returns the names of the applied seeders.
+func (r *Runner) Run(ctx context.Context) ([]string, error) {
+	seeders := For(r.environment)
+	if len(seeders) == 0 {
+		fmt.Fprintf(r.Out, "No seeder is registered for the %s environment\n", r.environment)
+		return nil, nil
+	}
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, seeder := range seeders {
+		if _, ok := applied[seeder.Name]; ok {
+			continue
+		}
+
+		if r.DryRun {
+			fmt.Fprintf(r.Out, "Would apply %s\n", seeder.Name)
+			continue
+		}
+
+		err := r.apply(ctx, seeder)
+		// another run applied the seeder in the meantime
+		if errors.Is(err, data.ErrAlreadyExist) {
+			continue
+		}
+		if err != nil {
+			return names, fmt.Errorf("apply the seeder %s: %w", seeder.Name, err)
+		}
+
+		fmt.Fprintf(r.Out, "Applied %s\n", seeder.Name)
+		names = append(names, seeder.Name)
+	}
+	return names, nil
+}
+
+// apply runs the seeder and records it in the seed history, in a transaction that isn't retried
+func (r *Runner) apply(ctx context.Context, seeder *Seeder) error {
+	return r.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+		q, ok := data.TxFromContext(tctx)
+		if !ok {
+			return fmt.Errorf("the seeder %s runs without transaction", seeder.Name)
+		}
+
+		err := seeder.Seed(tctx, &Tx{Queryer: q, db: r.db})
+		if err != nil {
+			return err
+		}
+
+		return r.history.Insert(tctx, &models.SeedHistory{
+			Name:        seeder.Name,
+			Environment: r.environment,
+			AppliedAt:   int(time.Now().Unix()),
+		})
+	})
+}
+
+// Status lists the seeders of the environment and whether they're applied
+func (r *Runner) Status(ctx context.Context) ([]*Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []*Status{}
+	for _, seeder := range For(r.environment) {
+		status := &Status{Name: seeder.Name}
+		if history, ok := applied[seeder.Name]; ok {
+			appliedAt := time.Unix(int64(history.AppliedAt), 0)
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// applied returns the seed history by the name of the seeders
+func (r *Runner) applied(ctx context.Context) (map[string]models.SeedHistory, error) {
+	histories, err := r.history.Where(ctx, "1 = 1", map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("read the seed history, are the migrations applied? %w", err)
+	}
+
+	applied := map[string]models.SeedHistory{}
+	for _, history := range histories {
+		applied[history.Name] = history
+	}
+	return applied, nil
+}
+
+// Environments returns the environments having at least a registered seeder
+func Environments() []string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	set := map[string]bool{}
+	for _, seeder := range registry.seeders {
+		for _, env := range seeder.Environments {
+			set[env] = true
+		}
+	}
+
+	environments := []string{}
+	for env := range set {
+		environments = append(environments, env)
+	}
+	sort.Strings(environments)
+	return environments
+}
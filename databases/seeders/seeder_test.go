@@ -0,0 +1,219 @@
+package seeders
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/user"
+	"github.com/riskibarqy/go-template/models"
+	_ "modernc.org/sqlite"
+)
+
+// openDB opens a sqlite database created from the sqlite schema
+func openDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "seed.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+	return db
+}
+
+// newRunner returns a runner of the environment printing to out
+func newRunner(db *sqlx.DB, environment string, out *bytes.Buffer) *Runner {
+	runner := NewRunner(db, environment)
+	runner.Out = out
+	return runner
+}
+
+// userEmails returns the emails of the users of every client
+func userEmails(t *testing.T, db *sqlx.DB) []string {
+	t.Helper()
+
+	emails := []string{}
+	err := db.Select(&emails, `SELECT email FROM "user" ORDER BY email`)
+	if err != nil {
+		t.Fatalf("select the users: %v", err)
+	}
+	return emails
+}
+
+// insertRaw inserts a user with a raw query of the transaction
+func insertRaw(tx *Tx, email string) error {
+	_, err := tx.Exec(tx.Rebind(`INSERT INTO "user" (name, email, password, created_at, updated_at, client_id) VALUES (?, ?, 'x', 0, 0, 1)`),
+		email, email)
+	return err
+}
+
+func init() {
+	Register(&Seeder{
+		Name:         "runner_raw",
+		Environments: []string{"runner"},
+		Seed: func(ctx context.Context, tx *Tx) error {
+			return insertRaw(tx, "raw@example.com")
+		},
+	})
+	Register(&Seeder{
+		Name:         "runner_storage",
+		Environments: []string{"runner"},
+		Seed: func(ctx context.Context, tx *Tx) error {
+			return Storage[models.User](tx, user.TableName).Insert(tenantContext(ctx, DefaultClientID), &models.User{
+				Name: "Storage", Email: "storage@example.com", Password: "x",
+			})
+		},
+	})
+
+	Register(&Seeder{
+		Name:         "failing_first",
+		Environments: []string{"failing"},
+		Seed: func(ctx context.Context, tx *Tx) error {
+			return insertRaw(tx, "first@example.com")
+		},
+	})
+	Register(&Seeder{
+		Name:         "failing_second",
+		Environments: []string{"failing"},
+		Seed: func(ctx context.Context, tx *Tx) error {
+			err := insertRaw(tx, "second@example.com")
+			if err != nil {
+				return err
+			}
+			err = Storage[models.User](tx, user.TableName).Insert(tenantContext(ctx, DefaultClientID), &models.User{
+				Name: "Third", Email: "third@example.com", Password: "x",
+			})
+			if err != nil {
+				return err
+			}
+			return errors.New("failed")
+		},
+	})
+}
+
+func TestRunnerAppliesEachSeederOnce(t *testing.T) {
+	db := openDB(t)
+	out := &bytes.Buffer{}
+	runner := newRunner(db, "runner", out)
+
+	applied, err := runner.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !slices.Equal(applied, []string{"runner_raw", "runner_storage"}) {
+		t.Errorf("Run() applied %v, want both seeders", applied)
+	}
+
+	applied, err = runner.Run(context.Background())
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Run() again applied %v, %v, want nothing", applied, err)
+	}
+	if got := userEmails(t, db); !slices.Equal(got, []string{"raw@example.com", "storage@example.com"}) {
+		t.Errorf("the users are %v, want the users of both seeders once", got)
+	}
+
+	statuses, err := runner.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt == nil {
+			t.Errorf("the status of %s isn't applied", status.Name)
+		}
+	}
+}
+
+func TestRunnerRollsBackAFailingSeeder(t *testing.T) {
+	db := openDB(t)
+	runner := newRunner(db, "failing", &bytes.Buffer{})
+
+	applied, err := runner.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "failing_second") {
+		t.Fatalf("Run() error = %v, want the error of failing_second", err)
+	}
+	if !slices.Equal(applied, []string{"failing_first"}) {
+		t.Errorf("Run() applied %v, want [failing_first]", applied)
+	}
+
+	// the raw query and the storage of the failing seeder are rolled back with its transaction
+	if got := userEmails(t, db); !slices.Equal(got, []string{"first@example.com"}) {
+		t.Errorf("the users are %v, want the user of failing_first only", got)
+	}
+
+	statuses, err := runner.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("the statuses are %+v %+v, want failing_first applied only", *statuses[0], *statuses[1])
+	}
+}
+
+func TestRunnerDryRun(t *testing.T) {
+	db := openDB(t)
+	out := &bytes.Buffer{}
+	runner := newRunner(db, "runner", out)
+	runner.DryRun = true
+
+	applied, err := runner.Run(context.Background())
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("Run() in a dry run = %v, %v, want nothing applied", applied, err)
+	}
+	if got := out.String(); got != "Would apply runner_raw\nWould apply runner_storage\n" {
+		t.Errorf("the dry run printed %q", got)
+	}
+	if got := userEmails(t, db); len(got) != 0 {
+		t.Errorf("the dry run inserted %v", got)
+	}
+}
+
+func TestAdminUserSeeder(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing *models.User
+		want     string
+	}{
+		{"inserts the admin user", nil, adminPasswordHash},
+		{"keeps a user of the email", &models.User{Name: "Riski", Email: adminEmail, Password: "changed"}, "changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openDB(t)
+			storage := data.NewStorage[models.User](db, user.TableName)
+			if tt.existing != nil {
+				err := storage.Insert(tenantContext(context.Background(), 2), tt.existing)
+				if err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+			}
+
+			_, err := newRunner(db, EnvTest, &bytes.Buffer{}).Run(context.Background())
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			users, err := storage.Where(data.WithoutTenant(context.Background()), "email = :email", map[string]interface{}{"email": adminEmail})
+			if err != nil {
+				t.Fatalf("Where: %v", err)
+			}
+			if len(users) != 1 || users[0].Password != tt.want {
+				t.Errorf("the users of the admin email are %+v, want one whose password is %q", users, tt.want)
+			}
+		})
+	}
+}
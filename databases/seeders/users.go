@@ -0,0 +1,101 @@
+package seeders
+
+import (
+	"context"
+	"math/rand"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/user"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// DefaultClientID is the client owning the seed users, the client of the users created before the tenants
+const DefaultClientID = 1
+
+// the admin user of the development, staging and test environments, formerly inserted by the user seeder migration
+const (
+	adminName  = "Riski Ramdan"
+	adminEmail = "riskibarqy@gmail.com"
+	// adminPasswordHash is the bcrypt hash of the password of the admin user
+	adminPasswordHash = "$2a$10$c2gIKDaKiwgUKlD3CnDZ7uBBbXIgID8TJtKSIHrMIko2jo6TEqKwW"
+)
+
+// demoUsers is the number of fake users seeded in development, to page through the users
+const demoUsers = 50
+
+func init() {
+	Register(&Seeder{
+		Name:         "admin_user",
+		Environments: []string{EnvDevelopment, EnvStaging, EnvTest},
+		Seed:         seedAdminUser,
+	})
+
+	Register(&Seeder{
+		Name:         "demo_users",
+		Environments: []string{EnvDevelopment},
+		Seed: func(ctx context.Context, tx *Tx) error {
+			// a fixed seed so every development database has the same users
+			_, err := insertFakeUsers(ctx, Storage[models.User](tx, user.TableName), demoUsers, DefaultClientID, rand.New(rand.NewSource(1)))
+			return err
+		},
+	})
+}
+
+// seedAdminUser inserts the admin user, unless a user already has its email,
+// e.g. the user inserted by the former migration whose password was changed since
+func seedAdminUser(ctx context.Context, tx *Tx) error {
+	storage := Storage[models.User](tx, user.TableName)
+
+	count, err := storage.Count(data.WithoutTenant(ctx), "email = :email", map[string]interface{}{
+		"email": adminEmail,
+	})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return storage.Insert(tenantContext(ctx, DefaultClientID), &models.User{
+		Name:     adminName,
+		Email:    adminEmail,
+		Password: adminPasswordHash,
+	})
+}
+
+// InsertFakeUsers inserts n fake users of the client in batches, see FakeUsers, and returns how many were inserted.
+// The users don't go through the user service, no event is published for them.
+func InsertFakeUsers(ctx context.Context, db *sqlx.DB, n int, clientID int, r *rand.Rand) (int, error) {
+	return insertFakeUsers(ctx, data.NewStorage[models.User](db, user.TableName), n, clientID, r)
+}
+
+// insertFakeUsers inserts n fake users of the client with the storage, see InsertFakeUsers
+func insertFakeUsers(ctx context.Context, storage *data.Storage[models.User], n int, clientID int, r *rand.Rand) (int, error) {
+	users, err := FakeUsers(n, r)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = tenantContext(ctx, clientID)
+
+	inserted := 0
+	for start := 0; start < len(users); start += fakeUsersBatch {
+		end := min(start+fakeUsersBatch, len(users))
+		err = storage.InsertMany(ctx, users[start:end])
+		if err != nil {
+			return inserted, err
+		}
+		inserted = end
+	}
+	return inserted, nil
+}
+
+// tenantContext returns the context of the client, the seed users are stamped with it
+func tenantContext(ctx context.Context, clientID int) context.Context {
+	return context.WithValue(ctx, appcontext.KeyClientID, clientID)
+}
+
+// fakeUsersBatch is the number of fake users inserted by a query
+const fakeUsersBatch = 1000
@@ -0,0 +1,44 @@
+package databases
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PendingMigrations returns the embedded migrations that are not applied to the database yet,
+// and the migration that failed halfway when the database is dirty
+func PendingMigrations(db *sqlx.DB) ([]string, error) {
+	current, dirty, err := currentVersion(db.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := migrationsSource()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	versions, err := sourceVersions(src)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []string{}
+	if dirty {
+		pending = append(pending, fmt.Sprintf("%d (dirty, failed halfway)", current))
+	}
+	for _, version := range versions {
+		if version <= current {
+			continue
+		}
+
+		_, name, err := readMigration(src, version, true)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, fmt.Sprintf("%d_%s", version, name))
+	}
+	return pending, nil
+}
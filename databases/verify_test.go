@@ -0,0 +1,66 @@
+package databases
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestPendingMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		dirty   bool
+		want    []string
+	}{
+		{
+			name:    "applied up to a version",
+			version: 1792300000,
+			want: []string{
+				"1792310000_create_table_outbox_event",
+				"1792320000_create_table_seed_history",
+				"1792330000_move_admin_user_to_seeder",
+				"1792340000_add_client_id_to_audit_log",
+			},
+		},
+		{
+			name:    "dirty",
+			version: 1792320000,
+			dirty:   true,
+			want: []string{
+				"1792320000 (dirty, failed halfway)",
+				"1792330000_move_admin_user_to_seeder",
+				"1792340000_add_client_id_to_audit_log",
+			},
+		},
+		{
+			name:    "up to date",
+			version: 1792340000,
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "migrations.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			defer db.Close()
+
+			// the table of the versions as golang-migrate creates it
+			db.MustExec(`CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+			db.MustExec(`INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)`, tt.version, tt.dirty)
+
+			pending, err := PendingMigrations(db)
+			if err != nil {
+				t.Fatalf("PendingMigrations: %v", err)
+			}
+			if !slices.Equal(pending, tt.want) {
+				t.Errorf("PendingMigrations() = %q, want %q", pending, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+package datatransfers
+
+// AuditHistoryParams represents the params of the history of a row
+type AuditHistoryParams struct {
+	TableName string
+	RowID     string
+	Page      int
+	Limit     int
+}
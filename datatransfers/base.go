@@ -3,6 +3,7 @@ package datatransfers
 type FindAllParams struct {
 	Page    int
 	Limit   int
+	Cursor  string
 	UserID  int
 	Offset  int
 	Status  string
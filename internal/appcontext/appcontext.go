@@ -25,6 +25,9 @@ const (
 	// KeyUserID represents the current logged-in UserID
 	KeyUserID contextKey = "UserID"
 
+	// KeyRequestID represents the id of the current request
+	KeyRequestID contextKey = "RequestID"
+
 	// KeyLoginToken represents the current logged-in token
 	KeyLoginToken contextKey = "LoginToken"
 
@@ -113,6 +116,16 @@ func UserID(ctx context.Context) int {
 	return 0
 }
 
+// RequestID gets the id of the current request from the context
+func RequestID(ctx context.Context) *string {
+	requestID := ctx.Value(KeyRequestID)
+	if requestID != nil {
+		v := requestID.(string)
+		return &v
+	}
+	return nil
+}
+
 // WarehouseID gets current prefered warehouseID of CustomerID
 func WarehouseID(ctx context.Context) int {
 	warehouseID := ctx.Value(KeyWarehouseID)
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/riskibarqy/go-template/datatransfers"
+	"github.com/riskibarqy/go-template/internal/types"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// Storage represents the audit log storage interface
+type Storage interface {
+	FindHistory(ctx context.Context, params *datatransfers.AuditHistoryParams) ([]*models.AuditLog, int, *types.Error)
+}
+
+// ServiceInterface represents the audit service interface
+type ServiceInterface interface {
+	History(ctx context.Context, params *datatransfers.AuditHistoryParams) ([]*models.AuditLog, int, *types.Error)
+}
+
+// Service is the domain logic implementation of audit Service interface
+type Service struct {
+	auditStorage Storage
+}
+
+// History lists a page of the audit logs of a row, the latest first, and the total number of its audit logs
+func (s *Service) History(ctx context.Context, params *datatransfers.AuditHistoryParams) ([]*models.AuditLog, int, *types.Error) {
+	auditLogs, count, err := s.auditStorage.FindHistory(ctx, params)
+	if err != nil {
+		err.Path = ".AuditService->History()" + err.Path
+		return nil, 0, err
+	}
+
+	return auditLogs, count, nil
+}
+
+// NewService creates a new audit AppService
+func NewService(
+	auditStorage Storage,
+) *Service {
+	return &Service{
+		auditStorage: auditStorage,
+	}
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/riskibarqy/go-template/datatransfers"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/types"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// PostgresStorage implements the audit storage service interface
+type PostgresStorage struct {
+	Storage data.GenericStorage
+}
+
+// FindHistory find a page of the audit logs of a row and the total number of its audit logs,
+// only the audit logs of the client of the context are found
+func (s *PostgresStorage) FindHistory(ctx context.Context, params *datatransfers.AuditHistoryParams) ([]*models.AuditLog, int, *types.Error) {
+	auditLogs := []*models.AuditLog{}
+	query := data.NewQuery(
+		data.Eq("table_name", params.TableName),
+		data.Eq("row_id", params.RowID),
+	).OrderBy("id", data.Desc).Page(params.Page, params.Limit)
+
+	total, err := s.Storage.FindPage(ctx, &auditLogs, query)
+	if err != nil {
+		return nil, 0, &types.Error{
+			Path:    ".AuditPostgresStorage->FindHistory()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "pq-error",
+		}
+	}
+
+	return auditLogs, total, nil
+}
+
+// NewPostgresStorage creates new audit repository service
+func NewPostgresStorage(
+	storage data.GenericStorage,
+) *PostgresStorage {
+	return &PostgresStorage{
+		Storage: storage,
+	}
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+// The actions of the audit logs
+const (
+	AuditInsert     = "insert"
+	AuditUpsert     = "upsert"
+	AuditUpdate     = "update"
+	AuditDelete     = "delete"
+	AuditDeleteHard = "delete_hard"
+	AuditRestore    = "restore"
+)
+
+// redactedValue replaces the values of the redacted columns in the audit logs
+const redactedValue = "[REDACTED]"
+
+// AuditLog is a row change recorded in the audit_log table by the Auditor
+type AuditLog struct {
+	ID        int          `json:"id" db:"id"`
+	TableName string       `json:"tableName" db:"table_name"`
+	RowID     string       `json:"rowId" db:"row_id"`
+	Action    string       `json:"action" db:"action"`
+	Changes   AuditChanges `json:"changes" db:"changes"`
+	UserID    *int         `json:"userId,omitempty" db:"user_id"`
+	RequestID *string      `json:"requestId,omitempty" db:"request_id"`
+	CreatedAt int          `json:"createdAt" db:"created_at,insertonly"`
+	// ClientID is the tenant of the audited row, nil when its model has none
+	ClientID *int `json:"clientId,omitempty" db:"client_id,tenant"`
+}
+
+// AuditChange is the old and new value of a changed column
+type AuditChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// AuditChanges are the changed columns of an audit log by their name, stored as json
+type AuditChanges map[string]AuditChange
+
+// Value implements driver.Valuer
+func (c AuditChanges) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+	return fmt.Errorf("cannot scan %T into AuditChanges", src)
+}
+
+// Auditor records the changes of the audited storages as AuditLog, see PostgresStorage.SetAuditor.
+// An audit log holds the changed columns with their old and new values, the acting appcontext.UserID
+// and the appcontext.RequestID. It belongs to the tenant of the audited row, so the audit logs are scoped
+// to the client as their rows. It's inserted with the context of the change, so within its transaction.
+type Auditor struct {
+	storage  GenericStorage
+	redacted []string
+}
+
+// NewAuditor creates an auditor inserting the audit logs into the storage of AuditLog,
+// the values of the password and token columns are redacted
+func NewAuditor(storage GenericStorage) *Auditor {
+	return &Auditor{
+		storage:  storage,
+		redacted: []string{"password", "token"},
+	}
+}
+
+// Redact redacts the values of the columns in addition to the password and token columns,
+// a redacted column is still recorded when it changes
+func (a *Auditor) Redact(columns ...string) *Auditor {
+	a.redacted = append(a.redacted, columns...)
+	return a
+}
+
+// record inserts the audit log of the change of a row of the table from before to after.
+// An invalid before or after stands for the missing row of an insert or a hard delete,
+// and nothing is recorded when no column changed. It's a no-op on a nil auditor.
+func (a *Auditor) record(ctx context.Context, m *modelInfo, tableName string, action string, before reflect.Value, after reflect.Value) error {
+	if a == nil {
+		return nil
+	}
+
+	row := after
+	if !row.IsValid() {
+		row = before
+	}
+
+	changes := AuditChanges{}
+	for _, column := range m.columns {
+		if column == m.pk {
+			continue
+		}
+
+		var oldValue, newValue interface{}
+		if before.IsValid() {
+			oldValue = normalize(m.value(before, column))
+		}
+		if after.IsValid() {
+			newValue = normalize(m.value(after, column))
+		}
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		if contains(a.redacted, column) {
+			oldValue, newValue = redact(oldValue), redact(newValue)
+		}
+		changes[column] = AuditChange{
+			Old: oldValue,
+			New: newValue,
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	log := &AuditLog{
+		TableName: tableName,
+		RowID:     fmt.Sprint(normalize(m.value(row, m.pk))),
+		Action:    action,
+		Changes:   changes,
+		RequestID: appcontext.RequestID(ctx),
+	}
+	if userID := appcontext.UserID(ctx); userID != 0 {
+		log.UserID = &userID
+	}
+	if tenant, ok := normalize(m.tenantValue(row)).(int64); ok {
+		clientID := int(tenant)
+		log.ClientID = &clientID
+	}
+
+	// the tenant is the one of the row rather than the one of the context
+	err := a.storage.Insert(WithoutTenant(ctx), log)
+	if err != nil {
+		return fmt.Errorf("audit %s of %s: %w", action, tableName, err)
+	}
+	return nil
+}
+
+// recordEach records the insert or the upsert of every element of elems, as accepted by InsertMany
+func (a *Auditor) recordEach(ctx context.Context, m *modelInfo, tableName string, action string, elems interface{}) error {
+	if a == nil {
+		return nil
+	}
+
+	return m.eachElem(elems, func(elem reflect.Value) error {
+		return a.record(ctx, m, tableName, action, reflect.Value{}, elem)
+	})
+}
+
+// redact hides the value, a null value is kept so the clearing of a secret is still visible
+func redact(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return redactedValue
+}
+
+// SetAuditor records the inserts, updates, deletes and restores of the storage with the auditor,
+// the operations then run within a transaction when the context has none.
+// The bulk UpdateWhere is not audited, Purge is audited as the DeleteHard of every purged element.
+func (r *PostgresStorage) SetAuditor(auditor *Auditor) *PostgresStorage {
+	r.auditor = auditor
+	return r
+}
+
+// audited loads the element of the id, including the soft deleted elements, when the storage is audited.
+// It returns an invalid value when the storage is not audited.
+func (r *PostgresStorage) audited(ctx context.Context, id interface{}) (reflect.Value, error) {
+	if r.auditor == nil {
+		return reflect.Value{}, nil
+	}
+
+	elem := reflect.New(r.elemType)
+	err := r.FindByID(WithDeleted(WithPrimary(ctx)), elem.Interface(), id)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return elem.Elem(), nil
+}
+
+// withDeletedAt returns a copy of the element with the soft delete column set to deletedAt
+func (m *modelInfo) withDeletedAt(elem reflect.Value, deletedAt interface{}) (reflect.Value, error) {
+	row := reflect.New(m.elemType).Elem()
+	row.Set(elem)
+
+	err := setValue(m.field(row, softDeleteColumn), deletedAt)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	return row, nil
+}
@@ -0,0 +1,208 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+type auditedItem struct {
+	ID       int     `db:"id"`
+	ClientID int     `db:"client_id,tenant"`
+	Name     string  `db:"name"`
+	Password string  `db:"password"`
+	Token    *string `db:"token"`
+	Secret   string  `db:"secret"`
+}
+
+const (
+	auditedItemSchema = `CREATE TABLE audited_item (id INTEGER PRIMARY KEY AUTOINCREMENT, client_id INT NOT NULL,
+		name TEXT NOT NULL, password TEXT NOT NULL, token TEXT, secret TEXT NOT NULL)`
+	auditLogSchema = `CREATE TABLE audit_log (id INTEGER PRIMARY KEY AUTOINCREMENT, table_name TEXT NOT NULL,
+		row_id TEXT NOT NULL, action TEXT NOT NULL, changes TEXT NOT NULL, user_id INT, request_id TEXT,
+		created_at INT NOT NULL, client_id INT)`
+)
+
+// auditSetup is an audited storage, the storage of its audit logs and the manager of their transactions
+type auditSetup struct {
+	manager *Manager
+	storage GenericStorage
+	logs    GenericStorage
+}
+
+// auditSetups returns the audited storages of the audited items on sqlite and in memory,
+// their secret column is redacted
+func auditSetups(t *testing.T) map[string]auditSetup {
+	t.Helper()
+
+	db := openSQLite(t, auditedItemSchema, auditLogSchema)
+	sqliteLogs := NewPostgresStorage(db, "audit_log", AuditLog{})
+	memoryLogs := NewMemoryStorage("audit_log", AuditLog{})
+	return map[string]auditSetup{
+		"sqlite": {
+			manager: NewManager(db),
+			storage: NewPostgresStorage(db, "audited_item", auditedItem{}).SetAuditor(NewAuditor(sqliteLogs).Redact("secret")),
+			logs:    sqliteLogs,
+		},
+		"memory": {
+			manager: NewMemoryManager(),
+			storage: NewMemoryStorage("audited_item", auditedItem{}).SetAuditor(NewAuditor(memoryLogs).Redact("secret")),
+			logs:    memoryLogs,
+		},
+	}
+}
+
+// clientContext returns the context of a request of the user of the client
+func clientContext(clientID int, userID int, requestID string) context.Context {
+	ctx := context.WithValue(context.Background(), appcontext.KeyClientID, clientID)
+	ctx = context.WithValue(ctx, appcontext.KeyUserID, userID)
+	return context.WithValue(ctx, appcontext.KeyRequestID, requestID)
+}
+
+// auditLogs returns the audit logs of the storage readable by the context, by id
+func auditLogs(t *testing.T, ctx context.Context, logs GenericStorage) []AuditLog {
+	t.Helper()
+
+	result := []AuditLog{}
+	err := logs.WhereQuery(ctx, &result, NewQuery().OrderBy("id", Asc))
+	if err != nil {
+		t.Fatalf("WhereQuery: %v", err)
+	}
+	return result
+}
+
+// changesJSON returns the changes as json, so the numbers decoded from the database compare with the others
+func changesJSON(t *testing.T, changes AuditChanges) string {
+	t.Helper()
+
+	b, err := json.Marshal(changes)
+	if err != nil {
+		t.Fatalf("marshal the changes: %v", err)
+	}
+	return string(b)
+}
+
+func TestAuditorRecordsTheChanges(t *testing.T) {
+	for name, setup := range auditSetups(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := clientContext(1, 5, "request-1")
+			token := "t0k3n"
+
+			item := &auditedItem{Name: "a", Password: "p4ss", Token: &token, Secret: "s3cr3t"}
+			err := setup.storage.Insert(ctx, item)
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			item.Name = "b"
+			err = setup.storage.Update(ctx, item)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			// nothing changed, nothing is recorded
+			err = setup.storage.Update(ctx, item)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			item.Password = "n3w"
+			item.Token = nil
+			err = setup.storage.Update(ctx, item)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			err = setup.storage.DeleteHard(ctx, item.ID)
+			if err != nil {
+				t.Fatalf("DeleteHard: %v", err)
+			}
+
+			want := []struct {
+				action  string
+				changes string
+			}{
+				{AuditInsert, `{"client_id":{"old":null,"new":1},"name":{"old":null,"new":"a"},"password":{"old":null,"new":"[REDACTED]"},"secret":{"old":null,"new":"[REDACTED]"},"token":{"old":null,"new":"[REDACTED]"}}`},
+				{AuditUpdate, `{"name":{"old":"a","new":"b"}}`},
+				{AuditUpdate, `{"password":{"old":"[REDACTED]","new":"[REDACTED]"},"token":{"old":"[REDACTED]","new":null}}`},
+				{AuditDeleteHard, `{"client_id":{"old":1,"new":null},"name":{"old":"b","new":null},"password":{"old":"[REDACTED]","new":null},"secret":{"old":"[REDACTED]","new":null}}`},
+			}
+
+			logs := auditLogs(t, ctx, setup.logs)
+			if len(logs) != len(want) {
+				t.Fatalf("recorded %d audit logs, want %d: %+v", len(logs), len(want), logs)
+			}
+			for i, log := range logs {
+				if log.Action != want[i].action {
+					t.Errorf("audit log %d action = %s, want %s", i, log.Action, want[i].action)
+				}
+				if got := changesJSON(t, log.Changes); got != want[i].changes {
+					t.Errorf("audit log %d changes = %s, want %s", i, got, want[i].changes)
+				}
+				if log.TableName != "audited_item" || log.RowID != fmt.Sprint(item.ID) {
+					t.Errorf("audit log %d is of %s %s, want audited_item %d", i, log.TableName, log.RowID, item.ID)
+				}
+				if log.UserID == nil || *log.UserID != 5 || log.RequestID == nil || *log.RequestID != "request-1" {
+					t.Errorf("audit log %d is by %v in %v, want the user 5 in request-1", i, log.UserID, log.RequestID)
+				}
+				if log.ClientID == nil || *log.ClientID != 1 {
+					t.Errorf("audit log %d belongs to the client %v, want 1", i, log.ClientID)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLogsAreScopedToTheClientOfTheirRow(t *testing.T) {
+	for name, setup := range auditSetups(t) {
+		t.Run(name, func(t *testing.T) {
+			for _, clientID := range []int{1, 2} {
+				err := setup.storage.Insert(clientContext(clientID, 5, "request"), &auditedItem{Name: fmt.Sprint(clientID)})
+				if err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+			}
+			// the tenant of a job spanning every client is the one of the row
+			err := setup.storage.Insert(WithoutTenant(context.Background()), &auditedItem{ClientID: 2, Name: "job"})
+			if err != nil {
+				t.Fatalf("Insert WithoutTenant: %v", err)
+			}
+
+			for clientID, want := range map[int]int{1: 1, 2: 2} {
+				logs := auditLogs(t, clientContext(clientID, 5, "request"), setup.logs)
+				if len(logs) != want {
+					t.Errorf("the client %d reads %d audit logs, want %d", clientID, len(logs), want)
+				}
+				for _, log := range logs {
+					if log.ClientID == nil || *log.ClientID != clientID {
+						t.Errorf("the client %d reads an audit log of the client %v", clientID, log.ClientID)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAuditIsRolledBackWithTheChange(t *testing.T) {
+	for name, setup := range auditSetups(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := clientContext(1, 5, "request")
+			errFailed := errors.New("failed")
+
+			err := setup.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+				err := setup.storage.Insert(tctx, &auditedItem{Name: "a"})
+				if err != nil {
+					return err
+				}
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Fatalf("RunInTransaction() error = %v, want %v", err, errFailed)
+			}
+
+			if logs := auditLogs(t, ctx, setup.logs); len(logs) != 0 {
+				t.Errorf("recorded %+v, want nothing", logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// Errors of the violated constraints, a *ConstraintError is one of them with errors.Is.
+// ErrAlreadyExist is the violation of a unique constraint or primary key.
+var (
+	ErrForeignKey = fmt.Errorf("data references data that doesn't exist or is still referenced")
+	ErrNotNull    = fmt.Errorf("data misses a required value")
+	ErrCheck      = fmt.Errorf("data has an invalid value")
+	ErrCancelled  = fmt.Errorf("query has been cancelled")
+)
+
+// ConstraintError is returned by the storages when a query violates a constraint of the database
+type ConstraintError struct {
+	// Kind is ErrAlreadyExist, ErrForeignKey, ErrNotNull or ErrCheck
+	Kind error
+	// Constraint is the name of the violated constraint, when the database reports it
+	Constraint string
+	// Column is the column of the violated constraint, the last one of a composite key,
+	// and Field its json name in the model, when the database reports it
+	Column string
+	Field  string
+	// Err is the error of the database driver
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("%v: %s", e.Kind, e.Column)
+	}
+	return e.Kind.Error()
+}
+
+// Is reports whether the target is the kind of the error
+func (e *ConstraintError) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Unwrap returns the error of the database driver
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// patterns of the constraint error messages
+var (
+	// postgres detail, e.g. Key (email)=(a@b.c) already exists.
+	keyDetailPattern = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+	// mysql messages, e.g. Column 'name' cannot be null
+	mysqlColumnPattern     = regexp.MustCompile("Column '([^']+)'")
+	mysqlConstraintPattern = regexp.MustCompile("(?:for key|CONSTRAINT|constraint) [`']([^`']+)[`']")
+	mysqlForeignKeyPattern = regexp.MustCompile("FOREIGN KEY \\(`([^`]+)`\\)")
+	// sqlite messages, e.g. UNIQUE constraint failed: user.email
+	sqliteFailedPattern = regexp.MustCompile(`(?:UNIQUE|NOT NULL|CHECK) constraint failed: ([^:]+?)(?: \(\d+\))?$`)
+)
+
+// translateError returns the error of the database driver as a *ConstraintError when the query violated
+// a constraint, wrapped into ErrCancelled when the query was cancelled, and as is otherwise
+func (r *PostgresStorage) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return r.translatePq(pqErr, err)
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return r.translateMysql(mysqlErr, err)
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return r.translateSqlite(sqliteErr, err)
+	}
+
+	return err
+}
+
+// translatePq translates the SQLSTATE of a postgres error
+func (r *PostgresStorage) translatePq(pqErr *pq.Error, err error) error {
+	var kind error
+	switch pqErr.Code {
+	case "23505":
+		kind = ErrAlreadyExist
+	case "23503":
+		kind = ErrForeignKey
+	case "23502":
+		kind = ErrNotNull
+	case "23514":
+		kind = ErrCheck
+	case "57014":
+		return fmt.Errorf("%w: %w", ErrCancelled, err)
+	default:
+		return err
+	}
+
+	column := pqErr.Column
+	if m := keyDetailPattern.FindStringSubmatch(pqErr.Detail); column == "" && m != nil {
+		column = lastColumn(m[1])
+	}
+	return r.constraintError(kind, pqErr.Constraint, column, err)
+}
+
+// translateMysql translates the error number of a mysql error
+func (r *PostgresStorage) translateMysql(mysqlErr *mysql.MySQLError, err error) error {
+	var kind error
+	switch mysqlErr.Number {
+	case 1062:
+		kind = ErrAlreadyExist
+	case 1451, 1452:
+		kind = ErrForeignKey
+	case 1048, 1364:
+		kind = ErrNotNull
+	case 3819:
+		kind = ErrCheck
+	case 1317, 3024:
+		return fmt.Errorf("%w: %w", ErrCancelled, err)
+	default:
+		return err
+	}
+
+	var constraint, column string
+	if m := mysqlConstraintPattern.FindStringSubmatch(mysqlErr.Message); m != nil {
+		constraint = m[1]
+	}
+	if m := mysqlColumnPattern.FindStringSubmatch(mysqlErr.Message); m != nil {
+		column = m[1]
+	} else if m := mysqlForeignKeyPattern.FindStringSubmatch(mysqlErr.Message); m != nil {
+		column = m[1]
+	}
+	return r.constraintError(kind, constraint, column, err)
+}
+
+// translateSqlite translates the extended result code of a sqlite error
+func (r *PostgresStorage) translateSqlite(sqliteErr *sqlite.Error, err error) error {
+	var kind error
+	switch sqliteErr.Code() {
+	case 2067, 1555: // SQLITE_CONSTRAINT_UNIQUE, SQLITE_CONSTRAINT_PRIMARYKEY
+		kind = ErrAlreadyExist
+	case 787: // SQLITE_CONSTRAINT_FOREIGNKEY
+		kind = ErrForeignKey
+	case 1299: // SQLITE_CONSTRAINT_NOTNULL
+		kind = ErrNotNull
+	case 275: // SQLITE_CONSTRAINT_CHECK
+		kind = ErrCheck
+	case 9: // SQLITE_INTERRUPT
+		return fmt.Errorf("%w: %w", ErrCancelled, err)
+	default:
+		return err
+	}
+
+	// the unique and not null messages list the table.column, the check message the constraint
+	var constraint, column string
+	if m := sqliteFailedPattern.FindStringSubmatch(sqliteErr.Error()); m != nil {
+		if kind == ErrCheck {
+			constraint = m[1]
+		} else {
+			column = lastColumn(m[1])
+		}
+	}
+	return r.constraintError(kind, constraint, column, err)
+}
+
+// constraintError creates the constraint error of the column, with the json name of its field in the model
+func (m *modelInfo) constraintError(kind error, constraint string, column string, err error) *ConstraintError {
+	e := &ConstraintError{
+		Kind:       kind,
+		Constraint: constraint,
+		Column:     column,
+		Err:        err,
+	}
+	if _, ok := m.fieldIndexes[column]; ok {
+		e.Field = m.jsonName(column)
+	}
+	return e
+}
+
+// lastColumn returns the last column of a list of columns, e.g. "client_id, email" or "user.client_id, user.email"
+func lastColumn(columns string) string {
+	parts := strings.Split(columns, ",")
+	column := strings.TrimSpace(parts[len(parts)-1])
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = column[i+1:]
+	}
+	return strings.Trim(column, `"`+"`")
+}
@@ -0,0 +1,212 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+type constraintItem struct {
+	ID       int    `json:"id" db:"id"`
+	Email    string `json:"emailAddress" db:"email"`
+	Age      int    `json:"age" db:"age"`
+	ParentID *int   `json:"parentId" db:"parent_id"`
+}
+
+const constraintItemSchema = `CREATE TABLE constraint_item (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	age INT CONSTRAINT age_positive CHECK (age >= 0),
+	parent_id INT REFERENCES constraint_item (id)
+)`
+
+func TestTranslateErrorSQLite(t *testing.T) {
+	db := openSQLite(t, constraintItemSchema)
+	storage := NewPostgresStorage(db, "constraint_item", constraintItem{})
+	ctx := context.Background()
+
+	err := storage.Insert(ctx, &constraintItem{Email: "a@example.com", Age: 1})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	missingParent := 1000
+	tests := []struct {
+		name           string
+		insert         func() error
+		wantKind       error
+		wantColumn     string
+		wantField      string
+		wantConstraint string
+	}{
+		{
+			name:       "unique",
+			insert:     func() error { return storage.Insert(ctx, &constraintItem{Email: "a@example.com"}) },
+			wantKind:   ErrAlreadyExist,
+			wantColumn: "email",
+			wantField:  "emailAddress",
+		},
+		{
+			name: "not null",
+			insert: func() error {
+				_, err := storage.UpdateWhere(ctx, map[string]interface{}{"email": nil}, "id = :id", map[string]interface{}{"id": 1})
+				return err
+			},
+			wantKind:   ErrNotNull,
+			wantColumn: "email",
+			wantField:  "emailAddress",
+		},
+		{
+			name:           "check",
+			insert:         func() error { return storage.Insert(ctx, &constraintItem{Email: "b@example.com", Age: -1}) },
+			wantKind:       ErrCheck,
+			wantConstraint: "age_positive",
+		},
+		{
+			name: "foreign key",
+			insert: func() error {
+				return storage.Insert(ctx, &constraintItem{Email: "c@example.com", ParentID: &missingParent})
+			},
+			wantKind: ErrForeignKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.insert()
+			if !errors.Is(err, tt.wantKind) {
+				t.Fatalf("error = %v, want %v", err, tt.wantKind)
+			}
+
+			var constraintErr *ConstraintError
+			if !errors.As(err, &constraintErr) {
+				t.Fatalf("error = %T, want a *ConstraintError", err)
+			}
+			if constraintErr.Column != tt.wantColumn || constraintErr.Field != tt.wantField || constraintErr.Constraint != tt.wantConstraint {
+				t.Errorf("constraint %q, column %q, field %q, want %q, %q, %q", constraintErr.Constraint, constraintErr.Column,
+					constraintErr.Field, tt.wantConstraint, tt.wantColumn, tt.wantField)
+			}
+		})
+	}
+}
+
+func TestTranslateErrorDrivers(t *testing.T) {
+	storage := NewPostgresStorage(openSQLite(t, constraintItemSchema), "constraint_item", constraintItem{})
+	errOther := errors.New("connection refused")
+
+	tests := []struct {
+		name           string
+		err            error
+		wantKind       error
+		wantColumn     string
+		wantField      string
+		wantConstraint string
+	}{
+		{
+			name:           "postgres unique with the column of the detail",
+			err:            &pq.Error{Code: "23505", Constraint: "constraint_item_email_key", Detail: "Key (email)=(a@example.com) already exists."},
+			wantKind:       ErrAlreadyExist,
+			wantConstraint: "constraint_item_email_key",
+			wantColumn:     "email",
+			wantField:      "emailAddress",
+		},
+		{
+			name:           "postgres composite unique reports the last column",
+			err:            &pq.Error{Code: "23505", Constraint: "item_client_email_key", Detail: "Key (client_id, email)=(1, a@example.com) already exists."},
+			wantKind:       ErrAlreadyExist,
+			wantConstraint: "item_client_email_key",
+			wantColumn:     "email",
+			wantField:      "emailAddress",
+		},
+		{
+			name:           "postgres foreign key",
+			err:            &pq.Error{Code: "23503", Constraint: "constraint_item_parent_id_fkey", Detail: "Key (parent_id)=(1000) is not present in table \"constraint_item\"."},
+			wantKind:       ErrForeignKey,
+			wantConstraint: "constraint_item_parent_id_fkey",
+			wantColumn:     "parent_id",
+			wantField:      "parentId",
+		},
+		{
+			name:       "postgres not null",
+			err:        &pq.Error{Code: "23502", Column: "email"},
+			wantKind:   ErrNotNull,
+			wantColumn: "email",
+			wantField:  "emailAddress",
+		},
+		{
+			name:           "postgres check",
+			err:            &pq.Error{Code: "23514", Constraint: "age_positive"},
+			wantKind:       ErrCheck,
+			wantConstraint: "age_positive",
+		},
+		{
+			name:           "mysql duplicate entry",
+			err:            &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@example.com' for key 'constraint_item.email'"},
+			wantKind:       ErrAlreadyExist,
+			wantConstraint: "constraint_item.email",
+		},
+		{
+			name:           "mysql foreign key",
+			err:            &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails (`db`.`constraint_item`, CONSTRAINT `parent_fk` FOREIGN KEY (`parent_id`) REFERENCES `constraint_item` (`id`))"},
+			wantKind:       ErrForeignKey,
+			wantConstraint: "parent_fk",
+			wantColumn:     "parent_id",
+			wantField:      "parentId",
+		},
+		{
+			name:       "mysql not null",
+			err:        &mysql.MySQLError{Number: 1048, Message: "Column 'email' cannot be null"},
+			wantKind:   ErrNotNull,
+			wantColumn: "email",
+			wantField:  "emailAddress",
+		},
+		{
+			name:           "mysql check",
+			err:            &mysql.MySQLError{Number: 3819, Message: "Check constraint 'age_positive' is violated."},
+			wantKind:       ErrCheck,
+			wantConstraint: "age_positive",
+		},
+		{
+			name:       "column unknown to the model has no field",
+			err:        &pq.Error{Code: "23502", Column: "created_by"},
+			wantKind:   ErrNotNull,
+			wantColumn: "created_by",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := storage.translateError(tt.err)
+			if !errors.Is(err, tt.wantKind) {
+				t.Fatalf("translateError() = %v, want %v", err, tt.wantKind)
+			}
+
+			var constraintErr *ConstraintError
+			if !errors.As(err, &constraintErr) {
+				t.Fatalf("translateError() = %T, want a *ConstraintError", err)
+			}
+			if constraintErr.Column != tt.wantColumn || constraintErr.Field != tt.wantField || constraintErr.Constraint != tt.wantConstraint {
+				t.Errorf("constraint %q, column %q, field %q, want %q, %q, %q", constraintErr.Constraint, constraintErr.Column,
+					constraintErr.Field, tt.wantConstraint, tt.wantColumn, tt.wantField)
+			}
+			if errors.Unwrap(err) != tt.err {
+				t.Errorf("translateError() unwraps to %v, want the driver error", errors.Unwrap(err))
+			}
+		})
+	}
+
+	for _, err := range []error{&pq.Error{Code: "57014"}, &mysql.MySQLError{Number: 3024}} {
+		if got := storage.translateError(err); !errors.Is(got, ErrCancelled) || !errors.Is(got, err) {
+			t.Errorf("translateError(%v) = %v, want ErrCancelled wrapping the driver error", err, got)
+		}
+	}
+
+	for _, err := range []error{errOther, &pq.Error{Code: "42P01"}, &mysql.MySQLError{Number: 1146}} {
+		if got := storage.translateError(err); got != err {
+			t.Errorf("translateError(%v) = %v, want the error as is", err, got)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package data
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded,
+// or was created for another ordering than the one of the query
+var ErrInvalidCursor = fmt.Errorf("invalid cursor")
+
+// cursor is the position of the last element of a keyset page,
+// along with the ordering of the page so it's only replayed against the same ordering
+type cursor struct {
+	Column    string        `json:"c"`
+	Direction SortDirection `json:"d"`
+	Key       interface{}   `json:"k"`
+	ID        interface{}   `json:"id"`
+}
+
+// encodeCursor encodes the keyset ordering, the sort key and the id of the last element into an opaque cursor
+func encodeCursor(key order, value interface{}, id interface{}) (string, error) {
+	b, err := json.Marshal(cursor{Column: key.column, Direction: key.direction, Key: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor decodes the opaque cursor created by encodeCursor,
+// it rejects the cursor created for another keyset ordering than key
+func decodeCursor(s string, key order) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// keep the numbers as json.Number so ids are bound as they were encoded
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	c := &cursor{}
+	err = decoder.Decode(c)
+	if err != nil || c.ID == nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Column != key.column || c.Direction != key.direction {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,151 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type pageItem struct {
+	ID    int     `db:"id"`
+	Score int     `db:"score"`
+	Note  *string `db:"note"`
+}
+
+const pageItemSchema = `CREATE TABLE page_item (id INTEGER PRIMARY KEY AUTOINCREMENT, score INT NOT NULL, note TEXT)`
+
+// pageStorages returns the storages of the page items on sqlite and in memory, filled with n items
+// whose scores have ties
+func pageStorages(t *testing.T, n int) map[string]GenericStorage {
+	t.Helper()
+
+	storages := map[string]GenericStorage{
+		"sqlite": NewPostgresStorage(openSQLite(t, pageItemSchema), "page_item", pageItem{}),
+		"memory": NewMemoryStorage("page_item", pageItem{}),
+	}
+	for name, storage := range storages {
+		items := []pageItem{}
+		for i := 0; i < n; i++ {
+			items = append(items, pageItem{Score: i % 3})
+		}
+		err := storage.InsertMany(context.Background(), items)
+		if err != nil {
+			t.Fatalf("%s: InsertMany: %v", name, err)
+		}
+	}
+	return storages
+}
+
+func TestFindCursorPagesThroughEveryRow(t *testing.T) {
+	orderings := []struct {
+		name  string
+		query func() *Query
+	}{
+		{"primary key", func() *Query { return NewQuery() }},
+		{"score ascending", func() *Query { return NewQuery().OrderBy("score", Asc) }},
+		{"score descending", func() *Query { return NewQuery().OrderBy("score", Desc) }},
+	}
+
+	for name, storage := range pageStorages(t, 10) {
+		for _, ordering := range orderings {
+			t.Run(name+"/"+ordering.name, func(t *testing.T) {
+				seen := map[int]bool{}
+				cursor := ""
+				for page := 0; page < 10; page++ {
+					items := []pageItem{}
+					next, err := storage.FindCursor(context.Background(), &items, ordering.query().After(cursor).Limit(3))
+					if err != nil {
+						t.Fatalf("FindCursor: %v", err)
+					}
+					for _, item := range items {
+						if seen[item.ID] {
+							t.Fatalf("the item %d is repeated on the page %d", item.ID, page)
+						}
+						seen[item.ID] = true
+					}
+					if next == "" {
+						break
+					}
+					cursor = next
+				}
+				if len(seen) != 10 {
+					t.Errorf("paged through %d items, want 10", len(seen))
+				}
+			})
+		}
+	}
+}
+
+func TestFindCursorRejectsAnotherOrdering(t *testing.T) {
+	for name, storage := range pageStorages(t, 5) {
+		t.Run(name, func(t *testing.T) {
+			items := []pageItem{}
+			cursor, err := storage.FindCursor(context.Background(), &items, NewQuery().OrderBy("score", Asc).Limit(2))
+			if err != nil || cursor == "" {
+				t.Fatalf("FindCursor() = %q, %v, want a cursor", cursor, err)
+			}
+
+			replays := map[string]*Query{
+				"another column":    NewQuery().OrderBy("id", Asc),
+				"another direction": NewQuery().OrderBy("score", Desc),
+				"default ordering":  NewQuery(),
+			}
+			for replay, q := range replays {
+				_, err = storage.FindCursor(context.Background(), &items, q.After(cursor).Limit(2))
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Errorf("%s: FindCursor() error = %v, want ErrInvalidCursor", replay, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFindCursorRejectsNullableSortColumn(t *testing.T) {
+	for name, storage := range pageStorages(t, 2) {
+		t.Run(name, func(t *testing.T) {
+			items := []pageItem{}
+			_, err := storage.FindCursor(context.Background(), &items, NewQuery().OrderBy("note", Asc).Limit(1))
+			if err == nil {
+				t.Errorf("FindCursor() sorted by a nullable column, want an error")
+			}
+		})
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	key := order{column: "score", direction: Asc}
+	valid, err := encodeCursor(key, 2, 7)
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		key    order
+		valid  bool
+	}{
+		{"same ordering", valid, key, true},
+		{"another column", valid, order{column: "id", direction: Asc}, false},
+		{"another direction", valid, order{column: "score", direction: Desc}, false},
+		{"not base64", "%%%", key, false},
+		{"not json", "bm90IGpzb24", key, false},
+		{"without id", base64.RawURLEncoding.EncodeToString([]byte(`{"c":"score","d":"ASC","k":2}`)), key, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(tt.cursor, tt.key)
+			if tt.valid {
+				if err != nil || fmt.Sprintf("%v %v", c.Key, c.ID) != "2 7" {
+					t.Errorf("decodeCursor() = %+v, %v, want the key 2 and the id 7", c, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeCursor() error = %v, want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect represents the SQL flavor of a database used by the generic storage
+type Dialect interface {
+	// Name returns the name of the dialect
+	Name() string
+	// Quote quotes the identifier
+	Quote(identifier string) string
+	// ILike returns the predicate matching the column with the pattern case-insensitively
+	ILike(column string, pattern string) string
+	// Returning reports whether INSERT and UPDATE support the RETURNING clause,
+	// the storage reads the rows back by their id otherwise
+	Returning() bool
+	// OnConflict returns the clause appended to an INSERT to update the rows conflicting on the columns,
+	// the primary key and the columns are quoted and the sets are the assignments of the update.
+	// Without sets the conflicting rows are left as is.
+	OnConflict(pk string, columns []string, sets []string) string
+	// Excluded returns the value the column would have been inserted with, to be used in the sets of OnConflict
+	Excluded(column string) string
+	// MaxBindParams returns the maximum number of bind parameters of a single statement
+	MaxBindParams() int
+	// Cursors reports whether the database supports the server-side cursors of DECLARE and FETCH,
+	// Each fetches keyset batches otherwise
+	Cursors() bool
+	// NextIDs returns the query of :count new values of the sequence generating the :pk of the :table,
+	// the values are null when the primary key has no sequence. It's empty when the database has no sequences.
+	NextIDs() string
+	// Columns returns the query of the column_name, data_type and nullable of the columns of the :table
+	Columns() string
+}
+
+// The dialects supported by the generic storage
+var (
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+	MySQL    Dialect = mysqlDialect{}
+)
+
+func init() {
+	// the pure go sqlite driver registers itself as "sqlite", which sqlx doesn't know
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+// DialectOf returns the dialect of the database driver, it defaults to Postgres
+func DialectOf(driverName string) Dialect {
+	switch driverName {
+	case "sqlite", "sqlite3":
+		return SQLite
+	case "mysql":
+		return MySQL
+	}
+	return Postgres
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) Quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
+
+func (postgresDialect) ILike(column string, pattern string) string {
+	return fmt.Sprintf("%s ILIKE %s", column, pattern)
+}
+
+func (postgresDialect) Returning() bool {
+	return true
+}
+
+func (postgresDialect) OnConflict(pk string, columns []string, sets []string) string {
+	if len(sets) == 0 {
+		return fmt.Sprintf(`ON CONFLICT (%s) DO NOTHING`, strings.Join(columns, ","))
+	}
+	return fmt.Sprintf(`ON CONFLICT (%s) DO UPDATE SET %s`, strings.Join(columns, ","), strings.Join(sets, ","))
+}
+
+func (d postgresDialect) Excluded(column string) string {
+	return "EXCLUDED." + d.Quote(column)
+}
+
+func (postgresDialect) MaxBindParams() int {
+	return 65535
+}
+
+func (postgresDialect) Cursors() bool {
+	return true
+}
+
+func (postgresDialect) NextIDs() string {
+	return `SELECT nextval(pg_get_serial_sequence(:table, :pk)) FROM generate_series(1, :count)`
+}
+
+func (postgresDialect) Columns() string {
+	return `SELECT column_name, data_type, is_nullable = 'YES' AS nullable FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = :table`
+}
+
+// sqliteDialect is close to postgres since sqlite supports RETURNING and ON CONFLICT since 3.35
+type sqliteDialect struct {
+	postgresDialect
+}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) ILike(column string, pattern string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", column, pattern)
+}
+
+func (sqliteDialect) MaxBindParams() int {
+	return 32766
+}
+
+func (sqliteDialect) Cursors() bool {
+	return false
+}
+
+func (sqliteDialect) NextIDs() string {
+	return ""
+}
+
+func (sqliteDialect) Columns() string {
+	return `SELECT name AS column_name, type AS data_type, "notnull" = 0 AS nullable FROM pragma_table_info(:table)`
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) Quote(identifier string) string {
+	return "`" + strings.ReplaceAll(identifier, "`", "``") + "`"
+}
+
+func (mysqlDialect) ILike(column string, pattern string) string {
+	return fmt.Sprintf("LOWER(%s) LIKE LOWER(%s)", column, pattern)
+}
+
+func (mysqlDialect) Returning() bool {
+	return false
+}
+
+// OnConflict ignores the columns, mysql updates the rows conflicting on any unique key.
+// The primary key is passed to LAST_INSERT_ID so the id of an updated row is returned as the last insert id,
+// this assignment alone leaves the conflicting rows as is when there is no set.
+func (d mysqlDialect) OnConflict(pk string, columns []string, sets []string) string {
+	sets = append(sets, fmt.Sprintf("%s = LAST_INSERT_ID(%s)", pk, pk))
+	return fmt.Sprintf(`ON DUPLICATE KEY UPDATE %s`, strings.Join(sets, ","))
+}
+
+func (d mysqlDialect) Excluded(column string) string {
+	return fmt.Sprintf("VALUES(%s)", d.Quote(column))
+}
+
+func (mysqlDialect) MaxBindParams() int {
+	return 65535
+}
+
+func (mysqlDialect) Cursors() bool {
+	return false
+}
+
+func (mysqlDialect) NextIDs() string {
+	return ""
+}
+
+func (mysqlDialect) Columns() string {
+	return `SELECT column_name AS column_name, data_type AS data_type, is_nullable = 'YES' AS nullable
+		FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = :table`
+}
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"testing"
+)
+
+func TestOnConflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		sets    []string
+		want    string
+	}{
+		{"postgres update", Postgres, []string{`"name" = EXCLUDED."name"`}, `ON CONFLICT ("email") DO UPDATE SET "name" = EXCLUDED."name"`},
+		{"postgres nothing to update", Postgres, nil, `ON CONFLICT ("email") DO NOTHING`},
+		{"sqlite nothing to update", SQLite, []string{}, `ON CONFLICT ("email") DO NOTHING`},
+		{"mysql update", MySQL, []string{"`name` = VALUES(`name`)"}, "ON DUPLICATE KEY UPDATE `name` = VALUES(`name`),`id` = LAST_INSERT_ID(`id`)"},
+		{"mysql nothing to update", MySQL, nil, "ON DUPLICATE KEY UPDATE `id` = LAST_INSERT_ID(`id`)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.dialect.OnConflict(tt.dialect.Quote("id"), []string{tt.dialect.Quote("email")}, tt.sets)
+			if got != tt.want {
+				t.Errorf("OnConflict() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
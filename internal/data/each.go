@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrStop is returned by the function given to Each to stop the iteration, Each then returns nil
+var ErrStop = fmt.Errorf("stop iteration")
+
+// eachBatchSize is the number of rows fetched at once by Each
+const eachBatchSize = 500
+
+// cursorSeq numbers the server-side cursors so the iterations of a transaction don't share a cursor
+var cursorSeq atomic.Int64
+
+// txBeginner is implemented by the databases that can start a transaction, e.g. *sqlx.DB
+type txBeginner interface {
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
+}
+
+// Each streams the elements matching the structured query to fn, one pointer to a new element at a time,
+// so only a batch of rows is held in memory. The rows are ordered as FindCursor orders them, by the first
+// ordering of the query then by the primary key, and the limit of the query bounds the number of elements,
+// its offset and cursor are ignored.
+//
+// On postgres the rows are fetched from a server-side cursor, declared in the transaction of the context
+// or in a new read-only transaction, so fn may run queries in the transaction of the context between the rows.
+// The other dialects fetch the rows by keyset batches, as FindCursor, so they can't order by a nullable column.
+//
+// The iteration stops with the error of fn, or with the error of the context when it's cancelled,
+// fn returns ErrStop to stop without error.
+func (r *PostgresStorage) Each(ctx context.Context, q *Query, fn func(elem interface{}) error) error {
+	ctx, cancel := withOperation(ctx, OpEach)
+	defer cancel()
+
+	cq := eachQuery(q, r.pk)
+	var err error
+	if r.dialect.Cursors() {
+		err = r.eachCursor(withScope(ctx, q.deleted), cq, fn)
+	} else {
+		err = r.eachKeyset(ctx, cq, fn)
+	}
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
+// eachQuery returns the query run by Each, ordered as keyset pagination so every dialect
+// passes the rows in the same order, without offset and cursor
+func eachQuery(q *Query, pk string) *Query {
+	cq := *q
+	cq.keyset = true
+	cq.orders, _ = cq.ordering(pk)
+	cq.keyset = false
+	cq.offset = 0
+	cq.cursor = ""
+	return &cq
+}
+
+// eachCursor runs Each with a server-side cursor
+func (r *PostgresStorage) eachCursor(ctx context.Context, q *Query, fn func(elem interface{}) error) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		db, ok := r.source(ctx).(txBeginner)
+		if !ok {
+			return r.eachKeyset(ctx, q, fn)
+		}
+
+		own, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return fmt.Errorf("error when creating transction: %w", err)
+		}
+		// the cursor is closed with the transaction
+		defer own.Rollback()
+		tx = own
+	}
+	tx = r.metrics.Instrument(tx, r.tableName)
+
+	where, tail, arg, err := q.compile(r.dialect, r.modelInfo)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, r.selectFields, r.from(ctx), strings.TrimSpace(where+" "+tail))
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("each_%d", cursorSeq.Add(1))
+	_, err = tx.ExecContext(ctx, tx.Rebind(fmt.Sprintf(`DECLARE %s NO SCROLL CURSOR FOR %s`, name, query)), args...)
+	if err != nil {
+		return r.translateError(err)
+	}
+	if ok {
+		defer tx.ExecContext(context.WithoutCancel(ctx), "CLOSE "+name)
+	}
+
+	for {
+		rows, err := tx.QueryxContext(ctx, fmt.Sprintf(`FETCH %d FROM %s`, eachBatchSize, name))
+		if err != nil {
+			return r.translateError(err)
+		}
+
+		// the batch is read before fn runs, so fn can use the connection of the transaction
+		elems := reflect.New(reflect.SliceOf(reflect.PtrTo(r.elemType)))
+		err = r.scanAll(rows, elems.Interface())
+		if err != nil {
+			return r.translateError(err)
+		}
+
+		err = eachBatch(ctx, elems.Elem(), fn)
+		if err != nil || elems.Elem().Len() < eachBatchSize {
+			return err
+		}
+	}
+}
+
+// eachKeyset runs Each with keyset batches
+func (r *PostgresStorage) eachKeyset(ctx context.Context, q *Query, fn func(elem interface{}) error) error {
+	cq := *q
+	cq.keyset = true
+
+	remaining := q.limit
+	for {
+		cq.limit = eachBatchSize
+		if q.limit > 0 && remaining < eachBatchSize {
+			cq.limit = remaining
+		}
+
+		elems := reflect.New(reflect.SliceOf(reflect.PtrTo(r.elemType)))
+		next, err := r.FindCursor(ctx, elems.Interface(), &cq)
+		if err != nil {
+			return err
+		}
+
+		err = eachBatch(ctx, elems.Elem(), fn)
+		if err != nil {
+			return err
+		}
+
+		remaining -= elems.Elem().Len()
+		if next == "" || (q.limit > 0 && remaining <= 0) {
+			return nil
+		}
+		cq.cursor = next
+	}
+}
+
+// eachBatch passes the elements of the batch, a slice of pointers to the model, to fn
+func eachBatch(ctx context.Context, datas reflect.Value, fn func(elem interface{}) error) error {
+	for i := 0; i < datas.Len(); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(datas.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
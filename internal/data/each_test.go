@@ -0,0 +1,259 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// eachStorages returns the page storages of pageStorages, and a sqlite storage with the mysql dialect
+// fetching its rows by keyset batches as mysql does, all filled with n items
+func eachStorages(t *testing.T, n int) map[string]GenericStorage {
+	t.Helper()
+
+	storages := pageStorages(t, n)
+	mysql := NewPostgresStorage(openSQLite(t, pageItemSchema), "page_item", pageItem{}).SetDialect(MySQL)
+	items := []pageItem{}
+	for i := 0; i < n; i++ {
+		items = append(items, pageItem{Score: i % 3})
+	}
+	err := mysql.InsertMany(context.Background(), items)
+	if err != nil {
+		t.Fatalf("mysql: InsertMany: %v", err)
+	}
+	storages["mysql dialect"] = mysql
+	return storages
+}
+
+// eachIDs returns the ids of the items passed by Each to its function
+func eachIDs(ctx context.Context, storage GenericStorage, q *Query) ([]int, error) {
+	ids := []int{}
+	err := storage.Each(ctx, q, func(elem interface{}) error {
+		ids = append(ids, elem.(*pageItem).ID)
+		return nil
+	})
+	return ids, err
+}
+
+// whereIDs returns the ids of the items found by WhereQuery
+func whereIDs(t *testing.T, storage GenericStorage, q *Query) []int {
+	t.Helper()
+
+	items := []pageItem{}
+	err := storage.WhereQuery(context.Background(), &items, q)
+	if err != nil {
+		t.Fatalf("WhereQuery: %v", err)
+	}
+	ids := []int{}
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+func TestEachFollowsTheOrderOfTheQuery(t *testing.T) {
+	// more rows than a batch, so the iteration spans several batches
+	n := eachBatchSize*2 + 3
+	queries := []struct {
+		name string
+		q    func() *Query
+		// want is the query of WhereQuery finding the items in the order of Each
+		want func() *Query
+	}{
+		{"primary key descending by default",
+			func() *Query { return NewQuery() },
+			func() *Query { return NewQuery().OrderBy("id", Desc) }},
+		{"score ascending",
+			func() *Query { return NewQuery().OrderBy("score", Asc) },
+			func() *Query { return NewQuery().OrderBy("score", Asc).OrderBy("id", Asc) }},
+		{"score descending",
+			func() *Query { return NewQuery().OrderBy("score", Desc).OrderBy("id", Asc) },
+			func() *Query { return NewQuery().OrderBy("score", Desc).OrderBy("id", Desc) }},
+		{"filtered",
+			func() *Query { return NewQuery(Eq("score", 1)).OrderBy("id", Asc) },
+			func() *Query { return NewQuery(Eq("score", 1)).OrderBy("id", Asc) }},
+		{"limit within a batch",
+			func() *Query { return NewQuery().OrderBy("score", Desc).Limit(7) },
+			func() *Query { return NewQuery().OrderBy("score", Desc).OrderBy("id", Desc).Limit(7) }},
+		{"limit over a batch",
+			func() *Query { return NewQuery().OrderBy("score", Asc).Limit(eachBatchSize + 2) },
+			func() *Query { return NewQuery().OrderBy("score", Asc).OrderBy("id", Asc).Limit(eachBatchSize + 2) }},
+	}
+
+	for name, storage := range eachStorages(t, n) {
+		for _, query := range queries {
+			t.Run(name+"/"+query.name, func(t *testing.T) {
+				// the offset is ignored
+				got, err := eachIDs(context.Background(), storage, query.q().Offset(4))
+				if err != nil {
+					t.Fatalf("Each: %v", err)
+				}
+				want := whereIDs(t, storage, query.want())
+				if !slices.Equal(got, want) {
+					t.Errorf("Each passed %d items, want the %d items of WhereQuery in its order", len(got), len(want))
+				}
+			})
+		}
+	}
+}
+
+func TestEachStopsOnTheErrorOfTheFunction(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name      string
+		stopAt    int
+		err       error
+		wantErr   error
+		wantCalls int
+	}{
+		{"ErrStop", 2, ErrStop, nil, 2},
+		{"error", 3, errFailed, errFailed, 3},
+		{"error in a later batch", eachBatchSize + 1, errFailed, errFailed, eachBatchSize + 1},
+	}
+
+	for name, storage := range eachStorages(t, eachBatchSize+10) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				calls := 0
+				err := storage.Each(context.Background(), NewQuery(), func(elem interface{}) error {
+					calls++
+					if calls == tt.stopAt {
+						return tt.err
+					}
+					return nil
+				})
+				if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+					t.Errorf("Each() error = %v, want %v", err, tt.wantErr)
+				}
+				if calls != tt.wantCalls {
+					t.Errorf("called %d times, want %d", calls, tt.wantCalls)
+				}
+			})
+		}
+	}
+}
+
+func TestEachStopsWhenTheContextIsCancelled(t *testing.T) {
+	for name, storage := range eachStorages(t, 10) {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			calls := 0
+			err := storage.Each(ctx, NewQuery(), func(elem interface{}) error {
+				calls++
+				if calls == 3 {
+					cancel()
+				}
+				return nil
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Each() error = %v, want %v", err, context.Canceled)
+			}
+			if calls != 3 {
+				t.Errorf("called %d times, want 3", calls)
+			}
+		})
+	}
+}
+
+func TestEachKeysetRejectsNullableSortColumn(t *testing.T) {
+	for name, storage := range eachStorages(t, 2) {
+		if name == "memory" {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			_, err := eachIDs(context.Background(), storage, NewQuery().OrderBy("note", Asc))
+			if err == nil {
+				t.Errorf("Each() sorted by a nullable column with keyset batches, want an error")
+			}
+		})
+	}
+}
+
+// TestEachOnPostgres runs Each with its server-side cursor on the postgres database of DATA_TEST_POSTGRES_URL,
+// it's skipped when the variable is not set
+func TestEachOnPostgres(t *testing.T) {
+	url := os.Getenv("DATA_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("DATA_TEST_POSTGRES_URL is not set")
+	}
+
+	db, err := sqlx.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	table := fmt.Sprintf("page_item_%d", os.Getpid())
+	db.MustExec(fmt.Sprintf(`CREATE TABLE %s (id SERIAL PRIMARY KEY, score INT NOT NULL, note TEXT)`, table))
+	t.Cleanup(func() { db.Exec(`DROP TABLE ` + table) })
+
+	storage := NewPostgresStorage(db, table, pageItem{})
+	items := []pageItem{}
+	for i := 0; i < eachBatchSize*2+3; i++ {
+		items = append(items, pageItem{Score: i % 3})
+	}
+	err = storage.InsertMany(context.Background(), items)
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+
+	t.Run("order", func(t *testing.T) {
+		got, err := eachIDs(context.Background(), storage, NewQuery().OrderBy("score", Desc).Limit(eachBatchSize+2))
+		if err != nil {
+			t.Fatalf("Each: %v", err)
+		}
+		want := whereIDs(t, storage, NewQuery().OrderBy("score", Desc).OrderBy("id", Desc).Limit(eachBatchSize+2))
+		if !slices.Equal(got, want) {
+			t.Errorf("Each passed %d items, want the %d items of WhereQuery in its order", len(got), len(want))
+		}
+	})
+
+	t.Run("queries of the transaction between the rows", func(t *testing.T) {
+		err := NewManager(db).RunInTransaction(context.Background(), func(tctx context.Context) error {
+			calls := 0
+			err := storage.Each(tctx, NewQuery(), func(elem interface{}) error {
+				calls++
+				_, err := storage.Count(tctx, "1 = 1", map[string]interface{}{})
+				if calls == eachBatchSize+1 {
+					return ErrStop
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			// the cursor is closed, a second iteration declares another one
+			_, err = eachIDs(tctx, storage, NewQuery().Limit(1))
+			return err
+		})
+		if err != nil {
+			t.Errorf("RunInTransaction() error = %v", err)
+		}
+	})
+
+	t.Run("stop and cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		calls := 0
+		err := storage.Each(ctx, NewQuery(), func(elem interface{}) error {
+			calls++
+			if calls == 3 {
+				cancel()
+			}
+			return nil
+		})
+		if !errors.Is(err, context.Canceled) || calls != 3 {
+			t.Errorf("Each() = %v after %d calls, want %v after 3", err, calls, context.Canceled)
+		}
+	})
+}
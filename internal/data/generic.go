@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Storage is the type-safe storage for the model T.
+// It shares the column metadata of T with every other storage of the same model,
+// and its GenericStorage adapter can be passed to the code that still works with interface{}.
+type Storage[T any] struct {
+	generic GenericStorage
+}
+
+// Single queries an element according to the query & argument provided
+func (s *Storage[T]) Single(ctx context.Context, where string, arg map[string]interface{}) (*T, error) {
+	elem := new(T)
+	err := s.generic.Single(ctx, elem, where, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return elem, nil
+}
+
+// Where queries the elements according to the query & argument provided
+func (s *Storage[T]) Where(ctx context.Context, where string, arg map[string]interface{}) ([]T, error) {
+	elems := []T{}
+	err := s.generic.Where(ctx, &elems, where, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return elems, nil
+}
+
+// SingleQuery queries an element according to the structured query
+func (s *Storage[T]) SingleQuery(ctx context.Context, q *Query) (*T, error) {
+	elem := new(T)
+	err := s.generic.SingleQuery(ctx, elem, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return elem, nil
+}
+
+// WhereQuery queries the elements according to the structured query
+func (s *Storage[T]) WhereQuery(ctx context.Context, q *Query) ([]T, error) {
+	elems := []T{}
+	err := s.generic.WhereQuery(ctx, &elems, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return elems, nil
+}
+
+// Count counts the elements matching the query & argument provided
+func (s *Storage[T]) Count(ctx context.Context, where string, arg map[string]interface{}) (int, error) {
+	return s.generic.Count(ctx, where, arg)
+}
+
+// FindPage queries a page of elements and the total number of elements matching the query
+func (s *Storage[T]) FindPage(ctx context.Context, q *Query) ([]T, int, error) {
+	elems := []T{}
+	total, err := s.generic.FindPage(ctx, &elems, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return elems, total, nil
+}
+
+// CountQuery counts the elements matching the conditions of the structured query
+func (s *Storage[T]) CountQuery(ctx context.Context, q *Query) (int, error) {
+	return s.generic.CountQuery(ctx, q)
+}
+
+// FindCursor queries a keyset page of elements and returns the cursor of the next page
+func (s *Storage[T]) FindCursor(ctx context.Context, q *Query) ([]T, string, error) {
+	elems := []T{}
+	next, err := s.generic.FindCursor(ctx, &elems, q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return elems, next, nil
+}
+
+// Each streams the elements matching the structured query to fn, see PostgresStorage.Each
+func (s *Storage[T]) Each(ctx context.Context, q *Query, fn func(elem *T) error) error {
+	return s.generic.Each(ctx, q, func(elem interface{}) error {
+		return fn(elem.(*T))
+	})
+}
+
+// All returns an iterator streaming the elements matching the structured query, see PostgresStorage.Each.
+// Breaking out of the loop stops the iteration, an error is yielded last with a nil element.
+func (s *Storage[T]) All(ctx context.Context, q *Query) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		err := s.generic.Each(ctx, q, func(elem interface{}) error {
+			if !yield(elem.(*T), nil) {
+				return ErrStop
+			}
+			return nil
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// SelectWithQuery runs a customized select query and scans the result into T, see PostgresStorage.SelectWithQuery
+func (s *Storage[T]) SelectWithQuery(ctx context.Context, query string, arg map[string]interface{}) ([]T, error) {
+	elems := []T{}
+	err := s.generic.SelectWithQuery(ctx, &elems, query, arg)
+	if err != nil {
+		return nil, err
+	}
+
+	return elems, nil
+}
+
+// FindByID finds an element by its id
+func (s *Storage[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	elem := new(T)
+	err := s.generic.FindByID(ctx, elem, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return elem, nil
+}
+
+// FindAll finds all elements from the database.
+func (s *Storage[T]) FindAll(ctx context.Context, page int, limit int) ([]T, error) {
+	elems := []T{}
+	err := s.generic.FindAll(ctx, &elems, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return elems, nil
+}
+
+// Insert inserts a new element into the database and sets its generated id
+func (s *Storage[T]) Insert(ctx context.Context, elem *T) error {
+	return s.generic.Insert(ctx, elem)
+}
+
+// InsertMany inserts the elements in batches and sets their generated ids
+func (s *Storage[T]) InsertMany(ctx context.Context, elems []T) error {
+	return s.generic.InsertMany(ctx, elems)
+}
+
+// Upsert inserts the elements or updates the rows that conflict on the conflictColumns
+func (s *Storage[T]) Upsert(ctx context.Context, elems []T, conflictColumns []string, updateColumns []string) error {
+	return s.generic.Upsert(ctx, elems, conflictColumns, updateColumns)
+}
+
+// Update updates the element in the database.
+func (s *Storage[T]) Update(ctx context.Context, elem *T) error {
+	return s.generic.Update(ctx, elem)
+}
+
+// UpdateFields updates only the columns of the element
+func (s *Storage[T]) UpdateFields(ctx context.Context, elem *T, columns ...string) error {
+	return s.generic.UpdateFields(ctx, elem, columns...)
+}
+
+// UpdateWhere sets the columns of every element matching the query & argument provided
+func (s *Storage[T]) UpdateWhere(ctx context.Context, set map[string]interface{}, where string, arg map[string]interface{}) (int, error) {
+	return s.generic.UpdateWhere(ctx, set, where, arg)
+}
+
+// Delete soft deletes the element by its id, ErrNotFound when no element was deleted
+func (s *Storage[T]) Delete(ctx context.Context, id interface{}) error {
+	return s.generic.Delete(ctx, id)
+}
+
+// DeleteHard hard deletes the element by its id
+func (s *Storage[T]) DeleteHard(ctx context.Context, id interface{}) error {
+	return s.generic.DeleteHard(ctx, id)
+}
+
+// Restore restores the soft deleted element by its id
+func (s *Storage[T]) Restore(ctx context.Context, id interface{}) error {
+	return s.generic.Restore(ctx, id)
+}
+
+// Purge hard deletes the elements soft deleted longer than the retention ago
+func (s *Storage[T]) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	return s.generic.Purge(ctx, retention)
+}
+
+// SetReplicas routes the read queries of the storage to the replicas,
+// it has no effect on a memory storage
+func (s *Storage[T]) SetReplicas(replicas *ReplicaSet) *Storage[T] {
+	if pg, ok := s.generic.(*PostgresStorage); ok {
+		pg.SetReplicas(replicas)
+	}
+	return s
+}
+
+// SetAuditor records the changes of the storage with the auditor
+func (s *Storage[T]) SetAuditor(auditor *Auditor) *Storage[T] {
+	switch storage := s.generic.(type) {
+	case *PostgresStorage:
+		storage.SetAuditor(auditor)
+	case *MemoryStorage:
+		storage.SetAuditor(auditor)
+	}
+	return s
+}
+
+// SetMetrics records the queries of the storage with the metrics, the memory storage has no query to record
+func (s *Storage[T]) SetMetrics(metrics *QueryMetrics) *Storage[T] {
+	if storage, ok := s.generic.(*PostgresStorage); ok {
+		storage.SetMetrics(metrics)
+	}
+	return s
+}
+
+// Generic returns the GenericStorage adapter of the storage
+func (s *Storage[T]) Generic() GenericStorage {
+	return s.generic
+}
+
+// NewStorage creates a new type-safe postgres Storage for the model T
+func NewStorage[T any](db *sqlx.DB, tableName string) *Storage[T] {
+	var elem T
+	return &Storage[T]{
+		generic: NewPostgresStorage(db, tableName, elem),
+	}
+}
+
+// NewMemory creates a new type-safe in-memory Storage for the model T
+func NewMemory[T any](tableName string) *Storage[T] {
+	var elem T
+	return &Storage[T]{
+		generic: NewMemoryStorage(tableName, elem),
+	}
+}
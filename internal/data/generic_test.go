@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// typedStorages returns the typed memory storage and the typed sqlite-backed storage of the conformance items
+func typedStorages(t *testing.T) map[string]*Storage[conformanceItem] {
+	t.Helper()
+
+	return map[string]*Storage[conformanceItem]{
+		"memory": NewMemory[conformanceItem]("conformance_item"),
+		"sqlite": NewStorage[conformanceItem](openSQLite(t, conformanceItemSchema), "conformance_item"),
+	}
+}
+
+// seedTyped inserts alice (20), bob (30), carol (40) and dave (50) for the first client
+func seedTyped(t *testing.T, storage *Storage[conformanceItem]) []conformanceItem {
+	t.Helper()
+
+	items := []conformanceItem{{Name: "alice", Age: 20}, {Name: "bob", Age: 30}, {Name: "carol", Age: 40}, {Name: "dave", Age: 50}}
+	err := storage.InsertMany(tenantContext(1), items)
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	return items
+}
+
+// pointerNames returns the names of the items
+func pointerNames(items []*conformanceItem) []string {
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func TestStorageReads(t *testing.T) {
+	for name, storage := range typedStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+			items := seedTyped(t, storage)
+
+			single, err := storage.Single(ctx, "name = :name", map[string]interface{}{"name": "bob"})
+			if err != nil || single.Age != 30 {
+				t.Errorf("Single() = %+v, %v, want bob", single, err)
+			}
+			_, err = storage.Single(ctx, "name = :name", map[string]interface{}{"name": "zoe"})
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Single() of a missing item error = %v, want ErrNotFound", err)
+			}
+
+			where, err := storage.Where(ctx, "age > :age ORDER BY id", map[string]interface{}{"age": 30})
+			if got := itemNames(where); err != nil || !slices.Equal(got, []string{"carol", "dave"}) {
+				t.Errorf("Where() = %v, %v, want [carol dave]", got, err)
+			}
+
+			singleQuery, err := storage.SingleQuery(ctx, NewQuery(Eq("name", "carol")))
+			if err != nil || singleQuery.Age != 40 {
+				t.Errorf("SingleQuery() = %+v, %v, want carol", singleQuery, err)
+			}
+
+			whereQuery, err := storage.WhereQuery(ctx, NewQuery(Lt("age", 40)).OrderBy("age", Desc))
+			if got := itemNames(whereQuery); err != nil || !slices.Equal(got, []string{"bob", "alice"}) {
+				t.Errorf("WhereQuery() = %v, %v, want [bob alice]", got, err)
+			}
+
+			count, err := storage.Count(ctx, "age >= :age", map[string]interface{}{"age": 30})
+			if err != nil || count != 3 {
+				t.Errorf("Count() = %d, %v, want 3", count, err)
+			}
+			count, err = storage.CountQuery(ctx, NewQuery(Gt("age", 40)))
+			if err != nil || count != 1 {
+				t.Errorf("CountQuery() = %d, %v, want 1", count, err)
+			}
+
+			page, total, err := storage.FindPage(ctx, NewQuery().OrderBy("id", Asc).Page(2, 3))
+			if got := itemNames(page); err != nil || total != 4 || !slices.Equal(got, []string{"dave"}) {
+				t.Errorf("FindPage() = %v of %d, %v, want [dave] of 4", got, total, err)
+			}
+
+			first, cursor, err := storage.FindCursor(ctx, NewQuery().OrderBy("id", Asc).Limit(3))
+			if err != nil {
+				t.Fatalf("FindCursor: %v", err)
+			}
+			next, nextCursor, err := storage.FindCursor(ctx, NewQuery().OrderBy("id", Asc).Limit(3).After(cursor))
+			if err != nil {
+				t.Fatalf("FindCursor of the next page: %v", err)
+			}
+			if got := append(itemNames(first), itemNames(next)...); !slices.Equal(got, []string{"alice", "bob", "carol", "dave"}) || nextCursor != "" {
+				t.Errorf("FindCursor() paged %v, want every item then no cursor", got)
+			}
+
+			found, err := storage.FindByID(ctx, items[2].ID)
+			if err != nil || found.Name != "carol" {
+				t.Errorf("FindByID() = %+v, %v, want carol", found, err)
+			}
+
+			all, err := storage.FindAll(ctx, 1, 2)
+			if got := itemNames(all); err != nil || !slices.Equal(got, []string{"dave", "carol"}) {
+				t.Errorf("FindAll() = %v, %v, want [dave carol]", got, err)
+			}
+		})
+	}
+}
+
+func TestStorageEachAndAll(t *testing.T) {
+	for name, storage := range typedStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+			seedTyped(t, storage)
+			q := NewQuery().OrderBy("age", Desc)
+
+			each := []*conformanceItem{}
+			err := storage.Each(ctx, q, func(item *conformanceItem) error {
+				each = append(each, item)
+				return nil
+			})
+			if got := pointerNames(each); err != nil || !slices.Equal(got, []string{"dave", "carol", "bob", "alice"}) {
+				t.Errorf("Each() = %v, %v, want every item by age descending", got, err)
+			}
+
+			all := []*conformanceItem{}
+			for item, err := range storage.All(ctx, q) {
+				if err != nil {
+					t.Fatalf("All: %v", err)
+				}
+				all = append(all, item)
+			}
+			if got := pointerNames(all); !slices.Equal(got, []string{"dave", "carol", "bob", "alice"}) {
+				t.Errorf("All() = %v, want every item by age descending", got)
+			}
+
+			// breaking out of the loop stops the iteration without error
+			all = all[:0]
+			for item, err := range storage.All(ctx, q) {
+				if err != nil {
+					t.Fatalf("All: %v", err)
+				}
+				all = append(all, item)
+				if len(all) == 2 {
+					break
+				}
+			}
+			if got := pointerNames(all); !slices.Equal(got, []string{"dave", "carol"}) {
+				t.Errorf("All() with a break = %v, want [dave carol]", got)
+			}
+
+			// the error is yielded last with a nil element
+			var yielded []error
+			for item, err := range storage.All(ctx, NewQuery().OrderBy("missing", Asc)) {
+				if item != nil {
+					t.Errorf("All() yielded %+v with an unknown ordering column", item)
+				}
+				yielded = append(yielded, err)
+			}
+			if len(yielded) != 1 || yielded[0] == nil {
+				t.Errorf("All() with an unknown ordering column yielded %v, want a single error", yielded)
+			}
+		})
+	}
+}
+
+func TestStorageWrites(t *testing.T) {
+	for name, storage := range typedStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+			items := seedTyped(t, storage)
+
+			erin := &conformanceItem{Name: "erin", Age: 60}
+			err := storage.Insert(ctx, erin)
+			if err != nil || erin.ID == 0 || erin.Version != 1 || erin.ClientID != 1 {
+				t.Fatalf("Insert() = %+v, %v, want the id, version 1 and client 1", erin, err)
+			}
+
+			erin.Age = 61
+			err = storage.Update(ctx, erin)
+			if err != nil || erin.Version != 2 {
+				t.Errorf("Update() = version %d, %v, want 2", erin.Version, err)
+			}
+
+			erin.Name = "erin b"
+			erin.Age = 0
+			err = storage.UpdateFields(ctx, erin, "name")
+			if err != nil {
+				t.Fatalf("UpdateFields: %v", err)
+			}
+			stored, err := storage.FindByID(ctx, erin.ID)
+			if err != nil || stored.Name != "erin b" || stored.Age != 61 {
+				t.Errorf("UpdateFields() stored %+v, %v, want only the name changed", stored, err)
+			}
+
+			updated, err := storage.UpdateWhere(ctx, map[string]interface{}{"age": 99}, "age < :age", map[string]interface{}{"age": 30})
+			if err != nil || updated != 1 {
+				t.Errorf("UpdateWhere() = %d, %v, want 1", updated, err)
+			}
+
+			err = storage.Delete(ctx, items[1].ID)
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			_, err = storage.FindByID(ctx, items[1].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID() of a deleted item error = %v, want ErrNotFound", err)
+			}
+			err = storage.Restore(ctx, items[1].ID)
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			_, err = storage.FindByID(ctx, items[1].ID)
+			if err != nil {
+				t.Errorf("FindByID() of a restored item error = %v", err)
+			}
+
+			err = storage.DeleteHard(ctx, items[2].ID)
+			if err != nil {
+				t.Fatalf("DeleteHard: %v", err)
+			}
+			_, err = storage.FindByID(WithDeleted(ctx), items[2].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID() of a hard deleted item error = %v, want ErrNotFound", err)
+			}
+
+			err = storage.Delete(ctx, items[3].ID)
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			purged, err := storage.Purge(ctx, -time.Hour)
+			if err != nil || purged != 1 {
+				t.Errorf("Purge() = %d, %v, want the deleted item", purged, err)
+			}
+		})
+	}
+}
+
+func TestStorageSelectWithQuery(t *testing.T) {
+	storage := NewStorage[conformanceItem](openSQLite(t, conformanceItemSchema), "conformance_item")
+	seedTyped(t, storage)
+
+	query := `SELECT * FROM conformance_item WHERE age > :age AND client_id = 1 AND deleted_at IS NULL ORDER BY id`
+	arg := map[string]interface{}{"age": 30}
+
+	// the raw query can't be scoped, the caller opts out of the scopes of the model
+	unscoped := map[string]context.Context{
+		"tenant":         tenantContext(1),
+		"without tenant": WithoutTenant(tenantContext(1)),
+		"with deleted":   WithDeleted(tenantContext(1)),
+	}
+	for name, ctx := range unscoped {
+		_, err := storage.SelectWithQuery(ctx, query, arg)
+		if !errors.Is(err, ErrUnscopedQuery) {
+			t.Errorf("%s: SelectWithQuery() error = %v, want ErrUnscopedQuery", name, err)
+		}
+	}
+
+	items, err := storage.SelectWithQuery(WithoutTenant(WithDeleted(tenantContext(1))), query, arg)
+	if got := itemNames(items); err != nil || !slices.Equal(got, []string{"carol", "dave"}) {
+		t.Errorf("SelectWithQuery() = %v, %v, want [carol dave]", got, err)
+	}
+
+	_, err = NewMemory[conformanceItem]("conformance_item").SelectWithQuery(tenantContext(1), `SELECT 1`, nil)
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("SelectWithQuery() on the memory storage error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,30 @@
+package data
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+// openSQLite opens a sqlite database in the temporary directory of the test and runs the schema statements.
+// It holds a single connection so a transaction sees its own changes and the tests don't lock each other.
+func openSQLite(t *testing.T, schema ...string) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	for _, statement := range schema {
+		_, err = db.Exec(statement)
+		if err != nil {
+			t.Fatalf("create the schema: %v\n%s", err, statement)
+		}
+	}
+	return db
+}
@@ -0,0 +1,252 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/utils"
+)
+
+// BeforeInsertHook is implemented by the models running code before they're inserted
+type BeforeInsertHook interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInsertHook is implemented by the models running code after they're inserted
+type AfterInsertHook interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdateHook is implemented by the models running code before they're updated
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdateHook is implemented by the models running code after they're updated
+type AfterUpdateHook interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleteHook is implemented by the models running code before they're deleted
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleteHook is implemented by the models running code after they're deleted
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// the columns stamped by the storages
+const (
+	createdAtColumn = "created_at"
+	updatedAtColumn = "updated_at"
+	ownerColumn     = "owner"
+)
+
+var (
+	beforeInsertHook = reflect.TypeOf((*BeforeInsertHook)(nil)).Elem()
+	afterInsertHook  = reflect.TypeOf((*AfterInsertHook)(nil)).Elem()
+	beforeUpdateHook = reflect.TypeOf((*BeforeUpdateHook)(nil)).Elem()
+	afterUpdateHook  = reflect.TypeOf((*AfterUpdateHook)(nil)).Elem()
+	beforeDeleteHook = reflect.TypeOf((*BeforeDeleteHook)(nil)).Elem()
+	afterDeleteHook  = reflect.TypeOf((*AfterDeleteHook)(nil)).Elem()
+)
+
+// implements reports whether the pointer to the model type implements one of the interfaces
+func implements(elemType reflect.Type, interfaces ...reflect.Type) bool {
+	for _, i := range interfaces {
+		if reflect.PtrTo(elemType).Implements(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// beforeInsert stamps the tenant column, the created_at, updated_at and owner columns that are still zero
+// and runs the BeforeInsert hook of the element
+func (m *modelInfo) beforeInsert(ctx context.Context, elem reflect.Value) error {
+	err := m.stampTenant(ctx, elem)
+	if err != nil {
+		return err
+	}
+
+	for _, column := range []string{createdAtColumn, updatedAtColumn} {
+		_, ok := m.fieldIndexes[column]
+		if ok && m.field(elem, column).IsZero() {
+			err = setValue(m.field(elem, column), m.now(column))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, ok := m.fieldIndexes[ownerColumn]
+	owner := appcontext.Owner(ctx)
+	if ok && owner != nil && m.field(elem, ownerColumn).IsZero() {
+		err = setValue(m.field(elem, ownerColumn), *owner)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hook, ok := elem.Addr().Interface().(BeforeInsertHook); ok {
+		return hook.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+// afterInsert runs the AfterInsert hook of the element
+func (m *modelInfo) afterInsert(ctx context.Context, elem reflect.Value) error {
+	if hook, ok := elem.Addr().Interface().(AfterInsertHook); ok {
+		return hook.AfterInsert(ctx)
+	}
+	return nil
+}
+
+// beforeUpdate stamps the updated_at column and runs the BeforeUpdate hook of the element
+func (m *modelInfo) beforeUpdate(ctx context.Context, elem reflect.Value) error {
+	if contains(m.updatable, updatedAtColumn) {
+		err := setValue(m.field(elem, updatedAtColumn), m.now(updatedAtColumn))
+		if err != nil {
+			return err
+		}
+	}
+
+	if hook, ok := elem.Addr().Interface().(BeforeUpdateHook); ok {
+		return hook.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+// afterUpdate runs the AfterUpdate hook of the element
+func (m *modelInfo) afterUpdate(ctx context.Context, elem reflect.Value) error {
+	if hook, ok := elem.Addr().Interface().(AfterUpdateHook); ok {
+		return hook.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+// beforeDelete runs the BeforeDelete hook of the element
+func (m *modelInfo) beforeDelete(ctx context.Context, elem reflect.Value) error {
+	if hook, ok := elem.Addr().Interface().(BeforeDeleteHook); ok {
+		return hook.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+// afterDelete runs the AfterDelete hook of the element
+func (m *modelInfo) afterDelete(ctx context.Context, elem reflect.Value) error {
+	if hook, ok := elem.Addr().Interface().(AfterDeleteHook); ok {
+		return hook.AfterDelete(ctx)
+	}
+	return nil
+}
+
+// deleteHooked runs the delete hooks of the element of the id around del.
+// The element is looked up on the primary, including the soft deleted elements when withDeleted is set.
+// Nothing is deleted when it doesn't exist, a hard delete then succeeds and a soft delete returns ErrNotFound.
+func (m *modelInfo) deleteHooked(ctx context.Context, s GenericStorage, id interface{}, withDeleted bool,
+	del func(ctx context.Context, id interface{}) error) error {
+	if !m.deleteHooks {
+		return del(ctx, id)
+	}
+
+	lookup := WithPrimary(ctx)
+	if withDeleted {
+		lookup = WithDeleted(lookup)
+	}
+
+	elem := reflect.New(m.elemType)
+	err := s.FindByID(lookup, elem.Interface(), id)
+	if err == ErrNotFound && withDeleted {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = m.beforeDelete(ctx, elem.Elem())
+	if err != nil {
+		return err
+	}
+
+	err = del(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return m.afterDelete(ctx, elem.Elem())
+}
+
+// updateColumns adds the updated_at column to the columns of a partial update when the model has it
+func (m *modelInfo) updateColumns(columns []string) []string {
+	if !contains(m.updatable, updatedAtColumn) || contains(columns, updatedAtColumn) {
+		return columns
+	}
+	return append(append([]string{}, columns...), updatedAtColumn)
+}
+
+// updateSet adds the updated_at column to the set of UpdateWhere when the model has it,
+// the set of the caller is left unchanged
+func (m *modelInfo) updateSet(set map[string]interface{}) map[string]interface{} {
+	if !contains(m.updatable, updatedAtColumn) {
+		return set
+	}
+	if _, ok := set[updatedAtColumn]; ok {
+		return set
+	}
+
+	stamped := map[string]interface{}{
+		updatedAtColumn: m.now(updatedAtColumn),
+	}
+	for column, value := range set {
+		stamped[column] = value
+	}
+	return stamped
+}
+
+// now returns the current time in the type of the column,
+// a time.Time for the time columns and the unix time otherwise
+func (m *modelInfo) now(column string) interface{} {
+	fieldType := m.fieldType(column)
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType == reflect.TypeOf(time.Time{}) {
+		return time.Now()
+	}
+	return utils.Now()
+}
+
+// eachElem runs f with every element of elems, a pointer to the model or a slice as accepted by InsertMany.
+// The nil elements and the elements of another type are skipped, they're rejected by the operation.
+func (m *modelInfo) eachElem(elems interface{}, f func(elem reflect.Value) error) error {
+	datas := reflect.ValueOf(elems)
+	if datas.Kind() == reflect.Ptr && datas.Elem().Kind() == reflect.Struct {
+		if datas.Elem().Type() != m.elemType {
+			return nil
+		}
+		return f(datas.Elem())
+	}
+
+	datas = reflect.Indirect(datas)
+	if datas.Kind() != reflect.Slice {
+		return nil
+	}
+
+	for i := 0; i < datas.Len(); i++ {
+		elem := reflect.Indirect(datas.Index(i))
+		if !elem.IsValid() || elem.Type() != m.elemType {
+			continue
+		}
+
+		err := f(elem)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+// hookCalls records the hooks run by the hook items
+var hookCalls []string
+
+// errHook is returned by the hook named by the name of the hook item
+var errHook = errors.New("hook failed")
+
+type hookItem struct {
+	ID        int       `db:"id"`
+	Name      string    `db:"name"`
+	Owner     int       `db:"owner"`
+	CreatedAt time.Time `db:"created_at,insertonly"`
+	UpdatedAt int       `db:"updated_at"`
+}
+
+const hookItemSchema = `CREATE TABLE hook_item (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL,
+	owner INT NOT NULL, created_at DATETIME NOT NULL, updated_at INT NOT NULL)`
+
+func (i *hookItem) hook(name string) error {
+	hookCalls = append(hookCalls, name)
+	if i.Name == name {
+		return errHook
+	}
+	return nil
+}
+
+func (i *hookItem) BeforeInsert(ctx context.Context) error { return i.hook("BeforeInsert") }
+func (i *hookItem) AfterInsert(ctx context.Context) error  { return i.hook("AfterInsert") }
+func (i *hookItem) BeforeUpdate(ctx context.Context) error { return i.hook("BeforeUpdate") }
+func (i *hookItem) AfterUpdate(ctx context.Context) error  { return i.hook("AfterUpdate") }
+func (i *hookItem) BeforeDelete(ctx context.Context) error { return i.hook("BeforeDelete") }
+func (i *hookItem) AfterDelete(ctx context.Context) error  { return i.hook("AfterDelete") }
+
+// hookStorages returns the storages of the hook items on sqlite and in memory
+func hookStorages(t *testing.T) map[string]GenericStorage {
+	t.Helper()
+
+	return map[string]GenericStorage{
+		"sqlite": NewPostgresStorage(openSQLite(t, hookItemSchema), "hook_item", hookItem{}),
+		"memory": NewMemoryStorage("hook_item", hookItem{}),
+	}
+}
+
+// storedHookItems returns the stored hook items by id
+func storedHookItems(t *testing.T, storage GenericStorage) []hookItem {
+	t.Helper()
+
+	items := []hookItem{}
+	err := storage.WhereQuery(context.Background(), &items, NewQuery().OrderBy("id", Asc))
+	if err != nil {
+		t.Fatalf("WhereQuery: %v", err)
+	}
+	return items
+}
+
+func TestHooksAreCalled(t *testing.T) {
+	for name, storage := range hookStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			hookCalls = nil
+
+			item := &hookItem{Name: "a"}
+			err := storage.Insert(ctx, item)
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			item.Name = "b"
+			err = storage.Update(ctx, item)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			err = storage.DeleteHard(ctx, item.ID)
+			if err != nil {
+				t.Fatalf("DeleteHard: %v", err)
+			}
+			// a missing element has no hook to run
+			err = storage.DeleteHard(ctx, item.ID)
+			if err != nil {
+				t.Fatalf("DeleteHard of a missing element: %v", err)
+			}
+
+			want := []string{"BeforeInsert", "AfterInsert", "BeforeUpdate", "AfterUpdate", "BeforeDelete", "AfterDelete"}
+			if !slices.Equal(hookCalls, want) {
+				t.Errorf("called %v, want %v", hookCalls, want)
+			}
+		})
+	}
+}
+
+func TestHookErrorsAbortTheOperation(t *testing.T) {
+	tests := []struct {
+		hook      string
+		operation func(ctx context.Context, storage GenericStorage, item *hookItem) error
+		wantNames []string
+	}{
+		{"BeforeInsert", func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			return storage.Insert(ctx, &hookItem{Name: "BeforeInsert"})
+		}, []string{"stored"}},
+		{"AfterInsert", func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			return storage.Insert(ctx, &hookItem{Name: "AfterInsert"})
+		}, []string{"stored"}},
+		{"AfterUpdate", func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			item.Name = "AfterUpdate"
+			return storage.Update(ctx, item)
+		}, []string{"stored"}},
+		{"AfterDelete", func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			err := storage.UpdateFields(ctx, &hookItem{ID: item.ID, Name: "AfterDelete"}, "name")
+			if err != nil {
+				return err
+			}
+			return storage.DeleteHard(ctx, item.ID)
+		}, []string{"AfterDelete"}},
+	}
+
+	for name := range hookStorages(t) {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.hook, func(t *testing.T) {
+				storage := hookStorages(t)[name]
+				ctx := context.Background()
+				item := &hookItem{Name: "stored"}
+				err := storage.Insert(ctx, item)
+				if err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+
+				err = tt.operation(ctx, storage, item)
+				if !errors.Is(err, errHook) {
+					t.Errorf("error = %v, want %v", err, errHook)
+				}
+
+				// the changes made before the failing hook are rolled back
+				got := []string{}
+				for _, stored := range storedHookItems(t, storage) {
+					got = append(got, stored.Name)
+				}
+				if !slices.Equal(got, tt.wantNames) {
+					t.Errorf("stored %v, want %v", got, tt.wantNames)
+				}
+			})
+		}
+	}
+}
+
+func TestInsertStamps(t *testing.T) {
+	for name, storage := range hookStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), appcontext.KeyOwner, 7)
+			createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			start := time.Now()
+
+			err := storage.InsertMany(ctx, []*hookItem{
+				{Name: "stamped"},
+				{Name: "kept", Owner: 3, CreatedAt: createdAt, UpdatedAt: 1},
+			})
+			if err != nil {
+				t.Fatalf("InsertMany: %v", err)
+			}
+			err = storage.Insert(context.Background(), &hookItem{Name: "without owner"})
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+
+			items := storedHookItems(t, storage)
+			if len(items) != 3 {
+				t.Fatalf("stored %d items, want 3", len(items))
+			}
+
+			stamped := items[0]
+			if stamped.Owner != 7 {
+				t.Errorf("owner = %d, want the owner of the context", stamped.Owner)
+			}
+			if stamped.CreatedAt.Before(start.Truncate(time.Second)) || stamped.CreatedAt.After(time.Now()) {
+				t.Errorf("created_at = %s, want the time of the insert", stamped.CreatedAt)
+			}
+			if stamped.UpdatedAt < int(start.Unix()) {
+				t.Errorf("updated_at = %d, want the unix time of the insert", stamped.UpdatedAt)
+			}
+
+			kept := items[1]
+			if kept.Owner != 3 || !kept.CreatedAt.Equal(createdAt) || kept.UpdatedAt != 1 {
+				t.Errorf("stored %+v, want the values set by the caller kept", kept)
+			}
+
+			if items[2].Owner != 0 {
+				t.Errorf("owner = %d, want none without owner in the context", items[2].Owner)
+			}
+		})
+	}
+}
+
+func TestUpdateStamps(t *testing.T) {
+	updates := map[string]func(ctx context.Context, storage GenericStorage, item *hookItem) error{
+		"Update": func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			item.Name = "updated"
+			return storage.Update(ctx, item)
+		},
+		"UpdateFields": func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			item.Name = "updated"
+			return storage.UpdateFields(ctx, item, "name")
+		},
+		"UpdateWhere": func(ctx context.Context, storage GenericStorage, item *hookItem) error {
+			set := map[string]interface{}{"name": "updated"}
+			_, err := storage.UpdateWhere(ctx, set, "id = :id", map[string]interface{}{"id": item.ID})
+			if len(set) != 1 {
+				t.Errorf("the set of the caller is %v, want it unchanged", set)
+			}
+			return err
+		},
+	}
+
+	for name := range hookStorages(t) {
+		for update, f := range updates {
+			t.Run(name+"/"+update, func(t *testing.T) {
+				storage := hookStorages(t)[name]
+				ctx := context.Background()
+				createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+				start := time.Now()
+
+				item := &hookItem{Name: "stored", Owner: 3, CreatedAt: createdAt, UpdatedAt: 1}
+				err := storage.Insert(ctx, item)
+				if err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+
+				err = f(ctx, storage, item)
+				if err != nil {
+					t.Fatalf("%s: %v", update, err)
+				}
+
+				stored := storedHookItems(t, storage)[0]
+				if stored.Name != "updated" {
+					t.Errorf("name = %s, want updated", stored.Name)
+				}
+				if stored.UpdatedAt < int(start.Unix()) {
+					t.Errorf("updated_at = %d, want the unix time of the update", stored.UpdatedAt)
+				}
+				if !stored.CreatedAt.Equal(createdAt) || stored.Owner != 3 {
+					t.Errorf("stored %+v, want created_at and owner unchanged", stored)
+				}
+			})
+		}
+	}
+}
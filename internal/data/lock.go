@@ -0,0 +1,22 @@
+package data
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ErrConflict is returned when the element has been changed by someone else since it was read,
+// it's only returned for the models with a column tagged with the lock option
+var ErrConflict = fmt.Errorf("data has been changed by another request")
+
+// lockVersion returns the version held by the lock column of the element
+func (m *modelInfo) lockVersion(elem reflect.Value) (int64, error) {
+	v := reflect.ValueOf(m.value(elem, m.lockColumn))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	}
+	return 0, fmt.Errorf("lock column %q must be an integer, got %s", m.lockColumn, v.Kind())
+}
@@ -2,42 +2,339 @@ package data
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
-// Manager represents the manager to manage the data consistency
+// ErrNestedTxOptions is returned when options are given to a transaction nested in another one,
+// its savepoint runs with the options of the outer transaction
+var ErrNestedTxOptions = fmt.Errorf("options of a nested transaction can't be applied")
+
+// Manager represents the manager to manage the data consistency,
+// a manager without database runs the transactions of the memory storages, see NewMemoryManager
 type Manager struct {
 	db *sqlx.DB
 }
 
+// transaction is the transaction held by the context of RunInTransaction,
+// a memory transaction has no tx and journals how to undo the changes of the memory storages
+type transaction struct {
+	tx         *sqlx.Tx
+	savepoints int
+
+	mu            sync.Mutex
+	undo          undoLog
+	afterCommit   []func(ctx context.Context)
+	afterRollback []func(ctx context.Context)
+}
+
+// txMark is the position in the transaction a rollback returns to
+type txMark struct {
+	undo          int
+	afterCommit   int
+	afterRollback int
+}
+
+// txOptions holds the options of RunInTransaction
+type txOptions struct {
+	isolation sql.IsolationLevel
+	readOnly  bool
+	retries   int
+	backoff   time.Duration
+}
+
+// TxOption configures the transaction started by RunInTransaction
+type TxOption func(o *txOptions)
+
+// WithIsolation sets the isolation level of the transaction
+func WithIsolation(level sql.IsolationLevel) TxOption {
+	return func(o *txOptions) {
+		o.isolation = level
+	}
+}
+
+// ReadOnly starts the transaction in read only mode
+func ReadOnly() TxOption {
+	return func(o *txOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithRetry sets how many times the transaction is retried on serialization failures and deadlocks,
+// the backoff doubles after each attempt. The transactions are not retried without it,
+// f must then be safe to run more than once.
+func WithRetry(retries int, backoff time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.retries = retries
+		o.backoff = backoff
+	}
+}
+
 // RunInTransaction runs the f with the transaction queryable inside the context
-func (m *Manager) RunInTransaction(ctx context.Context, f func(tctx context.Context) error) error {
-	tx, err := m.db.Beginx()
+// When the context already holds a transaction, f runs inside a savepoint of that transaction
+// so only the changes of f are rolled back when it fails, giving it options returns ErrNestedTxOptions.
+// Otherwise a new transaction is started with the options, it's retried only with WithRetry.
+// A panic inside f rolls back the transaction and is returned as an error.
+// The callbacks registered by f with AfterCommit and AfterRollback run once the transaction,
+// or the savepoint for AfterRollback, has been committed or rolled back.
+func (m *Manager) RunInTransaction(ctx context.Context, f func(tctx context.Context) error, opts ...TxOption) error {
+	t, ok := transactionFromContext(ctx)
+	if ok {
+		if len(opts) > 0 {
+			return ErrNestedTxOptions
+		}
+		return runInSavepoint(ctx, t, f)
+	}
+
+	options := &txOptions{
+		isolation: sql.LevelDefault,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	backoff := options.backoff
+	for attempt := 0; ; attempt++ {
+		err := m.runInNewTransaction(ctx, options, f)
+		if err == nil || attempt >= options.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (m *Manager) runInNewTransaction(ctx context.Context, options *txOptions, f func(tctx context.Context) error) (err error) {
+	if m.db == nil {
+		t := &transaction{}
+		err = runInMemoryTransaction(ctx, t, f)
+		if err == nil {
+			runCallbacks(ctx, t.committed())
+		}
+		return err
+	}
+
+	tx, err := m.db.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: options.isolation,
+		ReadOnly:  options.readOnly,
+	})
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("error when creating transction: %v", err)
+		return fmt.Errorf("error when creating transction: %w", err)
 	}
 
-	ctx = NewContext(ctx, tx)
-	err = f(ctx)
+	t := &transaction{tx: tx}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			runCallbacks(ctx, t.rollbackTo(txMark{}))
+			err = fmt.Errorf("panic in transaction: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	err = f(context.WithValue(NewContext(ctx, tx), transactionKey, t))
 	if err != nil {
 		tx.Rollback()
+		runCallbacks(ctx, t.rollbackTo(txMark{}))
 		return err
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		return fmt.Errorf("error when committing transaction: %v", err)
+		runCallbacks(ctx, t.rollbackTo(txMark{}))
+		return fmt.Errorf("error when committing transaction: %w", err)
+	}
+
+	runCallbacks(ctx, t.committed())
+	return nil
+}
+
+// runInSavepoint runs f inside a savepoint of the transaction t
+func runInSavepoint(ctx context.Context, t *transaction, f func(tctx context.Context) error) (err error) {
+	if t.tx == nil {
+		return runInMemoryTransaction(ctx, t, f)
+	}
+
+	t.savepoints++
+	savepoint := fmt.Sprintf("sp_%d", t.savepoints)
+	mark := t.mark()
+
+	_, err = t.tx.ExecContext(ctx, "SAVEPOINT "+savepoint)
+	if err != nil {
+		return fmt.Errorf("error when creating savepoint: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+			runCallbacks(ctx, t.rollbackTo(mark))
+			err = fmt.Errorf("panic in transaction: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	err = f(ctx)
+	if err != nil {
+		t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+		runCallbacks(ctx, t.rollbackTo(mark))
+		return err
+	}
+
+	_, err = t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	if err != nil {
+		return fmt.Errorf("error when releasing savepoint: %w", err)
 	}
 
 	return nil
 }
 
+// runInMemoryTransaction runs f inside the memory transaction t,
+// the changes journaled by f are undone when it fails or panics
+func runInMemoryTransaction(ctx context.Context, t *transaction, f func(tctx context.Context) error) (err error) {
+	mark := t.mark()
+
+	defer func() {
+		if p := recover(); p != nil {
+			runCallbacks(ctx, t.rollbackTo(mark))
+			err = fmt.Errorf("panic in transaction: %v\n%s", p, debug.Stack())
+		}
+	}()
+
+	err = f(context.WithValue(ctx, transactionKey, t))
+	if err != nil {
+		runCallbacks(ctx, t.rollbackTo(mark))
+		return err
+	}
+
+	return nil
+}
+
+// journal records how to undo a change of a memory storage
+func (t *transaction) journal(undo func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.undo.add(undo)
+}
+
+// mark returns the position of the transaction a rollback returns to
+func (t *transaction) mark() txMark {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return txMark{
+		undo:          len(t.undo),
+		afterCommit:   len(t.afterCommit),
+		afterRollback: len(t.afterRollback),
+	}
+}
+
+// rollbackTo undoes the changes journaled after the mark and drops the callbacks registered after it,
+// it returns the AfterRollback callbacks to run
+func (t *transaction) rollbackTo(mark txMark) []func(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.undo[mark.undo:].run()
+	t.undo = t.undo[:mark.undo]
+
+	callbacks := append([]func(ctx context.Context){}, t.afterRollback[mark.afterRollback:]...)
+	t.afterCommit = t.afterCommit[:mark.afterCommit]
+	t.afterRollback = t.afterRollback[:mark.afterRollback]
+	return callbacks
+}
+
+// committed returns the AfterCommit callbacks to run once the transaction is committed
+func (t *transaction) committed() []func(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.afterCommit
+}
+
+// AfterCommit registers fn to run once the transaction of the context is committed,
+// e.g. to invalidate a cache or notify another service only of the changes that are persisted.
+// fn is dropped when the transaction, or the savepoint it was registered in, is rolled back.
+// It runs right away when the context holds no transaction started by RunInTransaction.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	t, ok := transactionFromContext(ctx)
+	if !ok {
+		runCallbacks(ctx, []func(ctx context.Context){fn})
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.afterCommit = append(t.afterCommit, fn)
+}
+
+// AfterRollback registers fn to run once the transaction of the context is rolled back,
+// or the savepoint it was registered in. It's a no-op when the context holds no transaction.
+func AfterRollback(ctx context.Context, fn func(ctx context.Context)) {
+	t, ok := transactionFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.afterRollback = append(t.afterRollback, fn)
+}
+
+// runCallbacks runs the callbacks registered with AfterCommit or AfterRollback,
+// with a context that is not cancelled with the request. A panicking callback is logged
+// so the other callbacks still run.
+func runCallbacks(ctx context.Context, callbacks []func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	for _, fn := range callbacks {
+		func() {
+			defer func() {
+				if p := recover(); p != nil {
+					log.Printf("panic in transaction callback: %v\n%s", p, debug.Stack())
+				}
+			}()
+			fn(ctx)
+		}()
+	}
+}
+
+// transactionFromContext returns the transaction started by RunInTransaction from the context
+func transactionFromContext(ctx context.Context) (*transaction, bool) {
+	t, ok := ctx.Value(transactionKey).(*transaction)
+	return t, ok
+}
+
+// retryable reports whether the transaction failed on a serialization failure or a deadlock
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213
+	}
+	return false
+}
+
 // NewManager creates a new manager
 func NewManager(db *sqlx.DB) *Manager {
 	return &Manager{
 		db: db,
 	}
 }
+
+// NewMemoryManager creates a new manager running the transactions of the memory storages,
+// the changes of a rolled back transaction are undone but the transactions are not isolated
+func NewMemoryManager() *Manager {
+	return &Manager{}
+}
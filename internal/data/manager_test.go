@@ -0,0 +1,373 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type txItem struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+const txItemSchema = `CREATE TABLE tx_item (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL)`
+
+// txSetup is a manager and a storage whose changes it makes transactional
+type txSetup struct {
+	manager *Manager
+	storage GenericStorage
+}
+
+// txSetups returns the manager of a sqlite database and the memory manager, with a storage of tx items
+func txSetups(t *testing.T) map[string]txSetup {
+	t.Helper()
+
+	db := openSQLite(t, txItemSchema)
+	return map[string]txSetup{
+		"sqlite": {manager: NewManager(db), storage: NewPostgresStorage(db, "tx_item", txItem{})},
+		"memory": {manager: NewMemoryManager(), storage: NewMemoryStorage("tx_item", txItem{})},
+	}
+}
+
+// names returns the names of the stored tx items
+func names(t *testing.T, storage GenericStorage) []string {
+	t.Helper()
+
+	items := []txItem{}
+	err := storage.WhereQuery(context.Background(), &items, NewQuery().OrderBy("id", Asc))
+	if err != nil {
+		t.Fatalf("WhereQuery: %v", err)
+	}
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func TestRunInTransaction(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name    string
+		run     func(ctx context.Context, s txSetup) error
+		wantErr bool
+		want    []string
+	}{
+		{
+			name: "commit",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					return s.storage.Insert(tctx, &txItem{Name: "a"})
+				})
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "rollback on error",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					err := s.storage.Insert(tctx, &txItem{Name: "a"})
+					if err != nil {
+						return err
+					}
+					return errFailed
+				})
+			},
+			wantErr: true,
+			want:    []string{},
+		},
+		{
+			name: "rollback on panic",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					s.storage.Insert(tctx, &txItem{Name: "a"})
+					panic("boom")
+				})
+			},
+			wantErr: true,
+			want:    []string{},
+		},
+		{
+			name: "failed savepoint only rolls back its changes",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					err := s.storage.Insert(tctx, &txItem{Name: "outer"})
+					if err != nil {
+						return err
+					}
+
+					err = s.manager.RunInTransaction(tctx, func(sctx context.Context) error {
+						s.storage.Insert(sctx, &txItem{Name: "inner"})
+						return errFailed
+					})
+					if !errors.Is(err, errFailed) {
+						return err
+					}
+					return s.storage.Insert(tctx, &txItem{Name: "after"})
+				})
+			},
+			want: []string{"outer", "after"},
+		},
+		{
+			name: "panicking savepoint only rolls back its changes",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					s.storage.Insert(tctx, &txItem{Name: "outer"})
+					err := s.manager.RunInTransaction(tctx, func(sctx context.Context) error {
+						s.storage.Insert(sctx, &txItem{Name: "inner"})
+						panic("boom")
+					})
+					if err == nil {
+						return errors.New("the panic of the savepoint wasn't returned")
+					}
+					return nil
+				})
+			},
+			want: []string{"outer"},
+		},
+		{
+			name: "committed savepoint is rolled back with its transaction",
+			run: func(ctx context.Context, s txSetup) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					err := s.manager.RunInTransaction(tctx, func(sctx context.Context) error {
+						return s.storage.Insert(sctx, &txItem{Name: "inner"})
+					})
+					if err != nil {
+						return err
+					}
+					return errFailed
+				})
+			},
+			wantErr: true,
+			want:    []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		for name, setup := range txSetups(t) {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				err := tt.run(context.Background(), setup)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("RunInTransaction() error = %v, want error %v", err, tt.wantErr)
+				}
+				got := names(t, setup.storage)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("stored %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestRunInTransactionRetries(t *testing.T) {
+	serialization := &pq.Error{Code: "40001"}
+
+	tests := []struct {
+		name         string
+		opts         []TxOption
+		failures     int
+		err          error
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"succeeds after serialization failures", []TxOption{WithRetry(3, time.Millisecond)}, 2, serialization, 3, false},
+		{"gives up after the retries", []TxOption{WithRetry(2, time.Millisecond)}, 5, serialization, 3, true},
+		{"without retry", []TxOption{WithRetry(0, 0)}, 1, serialization, 1, true},
+		{"not retried by default", nil, 1, serialization, 1, true},
+		{"other errors are not retried", []TxOption{WithRetry(3, time.Millisecond)}, 1, errors.New("failed"), 1, true},
+		{"deadlocks are retried", []TxOption{WithRetry(3, time.Millisecond)}, 1, &pq.Error{Code: "40P01"}, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup := txSetups(t)["sqlite"]
+
+			attempts := 0
+			err := setup.manager.RunInTransaction(context.Background(), func(tctx context.Context) error {
+				attempts++
+				err := setup.storage.Insert(tctx, &txItem{Name: "a"})
+				if err != nil {
+					return err
+				}
+				if attempts <= tt.failures {
+					return tt.err
+				}
+				return nil
+			}, tt.opts...)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RunInTransaction() error = %v, want error %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("ran %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+
+			// the failed attempts are rolled back
+			want := 1
+			if tt.wantErr {
+				want = 0
+			}
+			if got := len(names(t, setup.storage)); got != want {
+				t.Errorf("stored %d items, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRunInTransactionNestedOptions(t *testing.T) {
+	for name, setup := range txSetups(t) {
+		t.Run(name, func(t *testing.T) {
+			err := setup.manager.RunInTransaction(context.Background(), func(tctx context.Context) error {
+				return setup.manager.RunInTransaction(tctx, func(ctx context.Context) error {
+					return setup.storage.Insert(ctx, &txItem{Name: "a"})
+				}, WithRetry(3, time.Millisecond))
+			})
+			if !errors.Is(err, ErrNestedTxOptions) {
+				t.Errorf("RunInTransaction() error = %v, want %v", err, ErrNestedTxOptions)
+			}
+			if got := names(t, setup.storage); len(got) != 0 {
+				t.Errorf("stored %v, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestRunInTransactionReadOnly(t *testing.T) {
+	setup := txSetups(t)["sqlite"]
+
+	err := setup.manager.RunInTransaction(context.Background(), func(tctx context.Context) error {
+		_, ok := transactionFromContext(tctx)
+		if !ok {
+			return errors.New("the context holds no transaction")
+		}
+		return nil
+	}, ReadOnly())
+	if err != nil {
+		t.Errorf("RunInTransaction() error = %v", err)
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, s txSetup, record func(event string)) error
+		want []string
+	}{
+		{
+			name: "commit runs the commit callbacks after the commit",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					AfterCommit(tctx, func(context.Context) { record("commit") })
+					AfterRollback(tctx, func(context.Context) { record("rollback") })
+					record("body")
+					return nil
+				})
+			},
+			want: []string{"body", "commit"},
+		},
+		{
+			name: "rollback runs the rollback callbacks",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					AfterCommit(tctx, func(context.Context) { record("commit") })
+					AfterRollback(tctx, func(context.Context) { record("rollback") })
+					return errFailed
+				})
+			},
+			want: []string{"rollback"},
+		},
+		{
+			name: "failed savepoint drops its commit callbacks",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					AfterCommit(tctx, func(context.Context) { record("outer commit") })
+					s.manager.RunInTransaction(tctx, func(sctx context.Context) error {
+						AfterCommit(sctx, func(context.Context) { record("inner commit") })
+						AfterRollback(sctx, func(context.Context) { record("inner rollback") })
+						return errFailed
+					})
+					return nil
+				})
+			},
+			want: []string{"inner rollback", "outer commit"},
+		},
+		{
+			name: "committed savepoint waits for its transaction",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					s.manager.RunInTransaction(tctx, func(sctx context.Context) error {
+						AfterCommit(sctx, func(context.Context) { record("inner commit") })
+						AfterRollback(sctx, func(context.Context) { record("inner rollback") })
+						return nil
+					})
+					record("outer body")
+					return errFailed
+				})
+			},
+			want: []string{"outer body", "inner rollback"},
+		},
+		{
+			name: "a panicking callback doesn't stop the others",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				return s.manager.RunInTransaction(ctx, func(tctx context.Context) error {
+					AfterCommit(tctx, func(context.Context) { panic("boom") })
+					AfterCommit(tctx, func(context.Context) { record("commit") })
+					return nil
+				})
+			},
+			want: []string{"commit"},
+		},
+		{
+			name: "without transaction the commit callbacks run right away",
+			run: func(ctx context.Context, s txSetup, record func(event string)) error {
+				AfterCommit(ctx, func(context.Context) { record("commit") })
+				AfterRollback(ctx, func(context.Context) { record("rollback") })
+				record("after")
+				return nil
+			},
+			want: []string{"commit", "after"},
+		},
+	}
+
+	for _, tt := range tests {
+		for name, setup := range txSetups(t) {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				got := []string{}
+				tt.run(context.Background(), setup, func(event string) {
+					got = append(got, event)
+				})
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("ran %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestAfterCommitSeesTheCommittedChanges(t *testing.T) {
+	for name, setup := range txSetups(t) {
+		t.Run(name, func(t *testing.T) {
+			var seen []string
+			err := setup.manager.RunInTransaction(context.Background(), func(tctx context.Context) error {
+				AfterCommit(tctx, func(ctx context.Context) {
+					seen = names(t, setup.storage)
+				})
+				return setup.storage.Insert(tctx, &txItem{Name: "a"})
+			})
+			if err != nil {
+				t.Fatalf("RunInTransaction: %v", err)
+			}
+			if !slices.Equal(seen, []string{"a"}) {
+				t.Errorf("the commit callback saw %v, want [a]", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,1137 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riskibarqy/go-template/utils"
+)
+
+// ErrUnsupported is returned by the memory storage for the queries it can't evaluate
+var ErrUnsupported = fmt.Errorf("operation is not supported by the memory storage")
+
+// MemoryStorage is the thread-safe in-memory implementation of GenericStorage,
+// made for the tests and the local development without a database.
+// It maps the elements with the same db tags as PostgresStorage, generates auto-increment ids
+// and supports soft delete, optimistic locking and the hooks. The structured queries are fully supported,
+// the raw where of Single, Where, Count and UpdateWhere is limited to the subset parsed by parseWhere,
+// and SelectWithQuery returns ErrUnsupported.
+// Inside the transactions of a Manager created by NewMemoryManager the changes are undone on rollback,
+// but they are visible to the other goroutines before the commit.
+type MemoryStorage struct {
+	*modelInfo
+	tableName string
+	auditor   *Auditor
+
+	mu     sync.RWMutex
+	rows   map[int64]reflect.Value
+	lastID int64
+}
+
+// undoLog holds the functions reverting the changes, in the order of the changes
+type undoLog []func()
+
+// add records the function reverting a change
+func (u *undoLog) add(f func()) {
+	*u = append(*u, f)
+}
+
+// run reverts the changes from the latest to the earliest
+func (u undoLog) run() {
+	for i := len(u) - 1; i >= 0; i-- {
+		u[i]()
+	}
+}
+
+// Single queries an element according to the query & argument provided
+func (r *MemoryStorage) Single(ctx context.Context, elem interface{}, where string, arg map[string]interface{}) error {
+	q, err := parseWhere(where, arg)
+	if err != nil {
+		return err
+	}
+
+	return r.SingleQuery(ctx, elem, q)
+}
+
+// Where queries the elements according to the query & argument provided
+func (r *MemoryStorage) Where(ctx context.Context, elems interface{}, where string, arg map[string]interface{}) error {
+	q, err := parseWhere(where, arg)
+	if err != nil {
+		return err
+	}
+
+	return r.WhereQuery(ctx, elems, q)
+}
+
+// SingleQuery queries an element according to the structured query
+func (r *MemoryStorage) SingleQuery(ctx context.Context, elem interface{}, q *Query) error {
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.selectRows(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+
+	reflect.ValueOf(elem).Elem().Set(cloneRow(rows[0]))
+	return nil
+}
+
+// WhereQuery queries the elements according to the structured query
+func (r *MemoryStorage) WhereQuery(ctx context.Context, elems interface{}, q *Query) error {
+	rows, err := r.selectRows(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	return r.scan(elems, rows)
+}
+
+// Count counts the elements matching the query & argument provided
+func (r *MemoryStorage) Count(ctx context.Context, where string, arg map[string]interface{}) (int, error) {
+	q, err := parseWhere(where, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.CountQuery(ctx, q)
+}
+
+// FindPage queries a page of elements according to the structured query
+// and returns the total number of elements matching the query regardless of its limit & offset
+func (r *MemoryStorage) FindPage(ctx context.Context, elems interface{}, q *Query) (int, error) {
+	err := r.WhereQuery(ctx, elems, q)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.CountQuery(ctx, q)
+}
+
+// CountQuery counts the elements matching the conditions of the structured query,
+// its ordering, limit, offset and cursor are ignored
+func (r *MemoryStorage) CountQuery(ctx context.Context, q *Query) (int, error) {
+	cq := NewQuery(q.conditions...)
+	cq.deleted = q.deleted
+
+	rows, err := r.selectRows(ctx, cq)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// FindCursor queries a keyset page of elements according to the structured query,
+// starting after the cursor given to Query.After.
+// It returns the cursor of the next page, or an empty string when it's the last page.
+func (r *MemoryStorage) FindCursor(ctx context.Context, elems interface{}, q *Query) (string, error) {
+	cq := *q
+	cq.keyset = true
+	if q.limit > 0 {
+		// fetch one more element to know whether there is a next page
+		cq.limit = q.limit + 1
+	}
+
+	err := r.WhereQuery(ctx, elems, &cq)
+	if err != nil {
+		return "", err
+	}
+
+	datas := reflect.Indirect(reflect.ValueOf(elems))
+	if q.limit <= 0 || datas.Len() <= q.limit {
+		return "", nil
+	}
+
+	datas.Set(datas.Slice(0, q.limit))
+	last := datas.Index(q.limit - 1)
+	key := q.keysetOrder(r.pk)
+	return encodeCursor(key, r.value(last, key.column), r.value(last, r.pk))
+}
+
+// Each passes the elements matching the structured query to fn as PostgresStorage.Each,
+// the matching rows are selected at once and copied one at a time
+func (r *MemoryStorage) Each(ctx context.Context, q *Query, fn func(elem interface{}) error) error {
+	rows, err := r.selectRows(ctx, eachQuery(q, r.pk))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = fn(cloneRow(row).Addr().Interface())
+		if err == ErrStop {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectWithQuery is not supported by the memory storage, it returns ErrUnsupported
+func (r *MemoryStorage) SelectWithQuery(ctx context.Context, elems interface{}, query string, arg map[string]interface{}) error {
+	return fmt.Errorf("%w: select with query on %s", ErrUnsupported, r.tableName)
+}
+
+// FindByID finds an element by its id
+func (r *MemoryStorage) FindByID(ctx context.Context, elem interface{}, id interface{}) error {
+	return r.Single(ctx, elem, fmt.Sprintf(`%s = :%s`, Postgres.Quote(r.pk), r.pk), map[string]interface{}{
+		r.pk: id,
+	})
+}
+
+// FindAll finds all elements from the storage.
+func (r *MemoryStorage) FindAll(ctx context.Context, elems interface{}, page int, limit int) error {
+	return r.Where(ctx, elems, fmt.Sprintf(`true ORDER BY %s DESC LIMIT :limit OFFSET :offset`, Postgres.Quote(r.pk)), map[string]interface{}{
+		"limit":  limit,
+		"offset": (page - 1) * limit,
+	})
+}
+
+// Insert inserts a new element and sets its generated id,
+// an element with a non-zero id is stored with that id unless it already exists.
+// The element is stamped and its hooks run as in PostgresStorage.Insert.
+func (r *MemoryStorage) Insert(ctx context.Context, elem interface{}) error {
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(elem).Elem()
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.beforeInsert(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.write(ctx, func(undo *undoLog) error {
+			return r.insert(undo, v)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = r.auditor.record(ctx, r.modelInfo, r.tableName, AuditInsert, reflect.Value{}, v)
+		if err != nil {
+			return err
+		}
+
+		return r.afterInsert(ctx, v)
+	})
+}
+
+// InsertMany inserts the elements and sets their generated ids,
+// either all the elements are inserted or none of them.
+func (r *MemoryStorage) InsertMany(ctx context.Context, elems interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.eachElem(elems, func(elem reflect.Value) error {
+			return r.beforeInsert(ctx, elem)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = r.insertMany(ctx, elems)
+		if err != nil {
+			return err
+		}
+
+		return r.eachElem(elems, func(elem reflect.Value) error {
+			return r.afterInsert(ctx, elem)
+		})
+	})
+}
+
+// insertMany inserts the elements without running their hooks
+func (r *MemoryStorage) insertMany(ctx context.Context, elems interface{}) error {
+	datas := reflect.Indirect(reflect.ValueOf(elems))
+	err := r.checkSlice(datas)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, func(undo *undoLog) error {
+		for i := 0; i < datas.Len(); i++ {
+			err := r.insert(undo, reflect.Indirect(datas.Index(i)))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.recordEach(ctx, r.modelInfo, r.tableName, AuditInsert, elems)
+}
+
+// Upsert inserts the elements, or updates the existing elements when they conflict on the conflictColumns.
+// It accepts the same arguments and runs the same hooks as PostgresStorage.Upsert.
+func (r *MemoryStorage) Upsert(ctx context.Context, elems interface{}, conflictColumns []string, updateColumns []string) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.eachElem(elems, func(elem reflect.Value) error {
+			return r.beforeInsert(ctx, elem)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = r.upsert(ctx, elems, conflictColumns, updateColumns)
+		if err != nil {
+			return err
+		}
+
+		return r.eachElem(elems, func(elem reflect.Value) error {
+			return r.afterInsert(ctx, elem)
+		})
+	})
+}
+
+// upsert upserts the elements without running their hooks
+func (r *MemoryStorage) upsert(ctx context.Context, elems interface{}, conflictColumns []string, updateColumns []string) error {
+	if len(conflictColumns) == 0 {
+		return fmt.Errorf("upsert into %s needs at least one conflict column", r.tableName)
+	}
+	for _, column := range conflictColumns {
+		if !contains(r.columns, column) {
+			return fmt.Errorf("unknown conflict column %q for %s", column, r.tableName)
+		}
+	}
+	err := r.checkConflictTenant(ctx, conflictColumns)
+	if err != nil {
+		return err
+	}
+
+	if len(updateColumns) == 0 {
+		for _, column := range r.updatable {
+			if column != createdAtColumn && !contains(conflictColumns, column) {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+	}
+	// without column to update the conflicting rows are left as is, as ON CONFLICT DO NOTHING
+	doNothing := true
+	for _, column := range updateColumns {
+		if !contains(r.updatable, column) {
+			return fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+		if column != r.lockColumn {
+			doNothing = false
+		}
+	}
+
+	datas := reflect.ValueOf(elems)
+	if datas.Kind() == reflect.Ptr && datas.Elem().Kind() == reflect.Struct {
+		datas = reflect.Append(reflect.MakeSlice(reflect.SliceOf(datas.Type()), 0, 1), datas)
+	}
+	datas = reflect.Indirect(datas)
+	err = r.checkSlice(datas)
+	if err != nil {
+		return err
+	}
+
+	err = r.write(ctx, func(undo *undoLog) error {
+		for i := 0; i < datas.Len(); i++ {
+			item := reflect.Indirect(datas.Index(i))
+
+			existing, ok, err := r.conflicting(item, conflictColumns)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				err = r.insert(undo, item)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if doNothing {
+				continue
+			}
+
+			row := cloneRow(existing)
+			for _, column := range updateColumns {
+				if column != r.lockColumn {
+					r.field(row, column).Set(r.field(item, column))
+				}
+			}
+			err = r.bumpVersion(row)
+			if err != nil {
+				return err
+			}
+
+			r.put(undo, row)
+			item.Set(cloneRow(row))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// recorded as PostgresStorage.Upsert, which doesn't know the previous values of the updated rows
+	return r.auditor.recordEach(ctx, r.modelInfo, r.tableName, AuditUpsert, elems)
+}
+
+// Update updates the element, with the same optimistic locking, stamping and hooks as PostgresStorage.Update
+func (r *MemoryStorage) Update(ctx context.Context, elem interface{}) error {
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(elem).Elem()
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.beforeUpdate(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.update(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		return r.afterUpdate(ctx, v)
+	})
+}
+
+// update updates the element without running its hooks
+func (r *MemoryStorage) update(ctx context.Context, v reflect.Value) error {
+	var existing reflect.Value
+	err := r.write(ctx, func(undo *undoLog) error {
+		var err error
+		existing, err = r.existing(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		row := cloneRow(v)
+		for _, column := range r.columns {
+			// the readonly and insertonly columns keep their stored values
+			if column != r.pk && !contains(r.updatable, column) && column != r.lockColumn {
+				r.field(row, column).Set(r.field(existing, column))
+			}
+		}
+		err = r.bumpVersion(row)
+		if err != nil {
+			return err
+		}
+
+		r.put(undo, row)
+		v.Set(cloneRow(row))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditUpdate, existing, v)
+}
+
+// UpdateFields updates only the columns of the element, the element is then refreshed with the stored row.
+// The columns, the optimistic locking, the stamping and the hooks are handled as in PostgresStorage.UpdateFields.
+func (r *MemoryStorage) UpdateFields(ctx context.Context, elem interface{}, columns ...string) error {
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("update fields of %s needs at least one column", r.tableName)
+	}
+	for _, column := range columns {
+		if !contains(r.updatable, column) || column == r.lockColumn {
+			return fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+	}
+
+	v := reflect.ValueOf(elem).Elem()
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.beforeUpdate(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.updateFields(ctx, v, r.updateColumns(columns))
+		if err != nil {
+			return err
+		}
+
+		return r.afterUpdate(ctx, v)
+	})
+}
+
+// updateFields updates the columns of the element without running its hooks
+func (r *MemoryStorage) updateFields(ctx context.Context, v reflect.Value, columns []string) error {
+	var existing reflect.Value
+	err := r.write(ctx, func(undo *undoLog) error {
+		var err error
+		existing, err = r.existing(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		row := cloneRow(existing)
+		for _, column := range columns {
+			r.field(row, column).Set(r.field(v, column))
+		}
+		err = r.bumpVersion(row)
+		if err != nil {
+			return err
+		}
+
+		r.put(undo, row)
+		v.Set(cloneRow(row))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditUpdate, existing, v)
+}
+
+// UpdateWhere sets the columns of the set to their values for every element matching
+// the query & argument provided, and returns the number of updated elements.
+// The columns are validated and stamped as in PostgresStorage.UpdateWhere.
+func (r *MemoryStorage) UpdateWhere(ctx context.Context, set map[string]interface{}, where string, arg map[string]interface{}) (int, error) {
+	if len(set) == 0 {
+		return 0, fmt.Errorf("update where of %s needs at least one column", r.tableName)
+	}
+	for column := range set {
+		if !contains(r.updatable, column) || column == r.lockColumn {
+			return 0, fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+	}
+
+	set = r.updateSet(set)
+
+	q, err := parseWhere(where, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	err = r.write(ctx, func(undo *undoLog) error {
+		rows, err := r.match(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, existing := range rows {
+			row := cloneRow(existing)
+			for column, value := range set {
+				err = setValue(r.field(row, column), value)
+				if err != nil {
+					return fmt.Errorf("invalid value of %q for %s: %w", column, r.tableName, err)
+				}
+			}
+			err = r.bumpVersion(row)
+			if err != nil {
+				return err
+			}
+
+			r.put(undo, row)
+		}
+		updated = len(rows)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// Delete soft deletes the element by its id, it returns ErrNotFound when no element was deleted
+// as PostgresStorage.Delete and an element that is already deleted keeps its deletion time.
+// The delete hooks run as in PostgresStorage.Delete.
+func (r *MemoryStorage) Delete(ctx context.Context, id interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.deleteHooked(ctx, r, id, false, r.delete)
+	})
+}
+
+// delete soft deletes the element without running its hooks
+func (r *MemoryStorage) delete(ctx context.Context, id interface{}) error {
+	if !r.softDelete {
+		return fmt.Errorf("%s is not soft deletable", r.tableName)
+	}
+
+	key, err := r.idKey(id)
+	if err != nil {
+		return err
+	}
+
+	var existing, deleted reflect.Value
+	err = r.write(ctx, func(undo *undoLog) error {
+		row, ok := r.rows[key]
+		if !ok || r.deleted(row) || !r.tenantVisible(ctx, row) {
+			return ErrNotFound
+		}
+
+		existing, deleted = row, cloneRow(row)
+		err := setValue(r.field(deleted, softDeleteColumn), utils.Now())
+		if err != nil {
+			return err
+		}
+
+		r.put(undo, deleted)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditDelete, existing, deleted)
+}
+
+// DeleteHard removes the element by its id, the delete hooks run as in PostgresStorage.DeleteHard
+func (r *MemoryStorage) DeleteHard(ctx context.Context, id interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.deleteHooked(ctx, r, id, true, r.deleteHard)
+	})
+}
+
+// deleteHard removes the element without running its hooks
+func (r *MemoryStorage) deleteHard(ctx context.Context, id interface{}) error {
+	key, err := r.idKey(id)
+	if err != nil {
+		return err
+	}
+
+	var existing reflect.Value
+	err = r.write(ctx, func(undo *undoLog) error {
+		row, ok := r.rows[key]
+		if !ok || !r.tenantVisible(ctx, row) {
+			return nil
+		}
+
+		existing = row
+		r.remove(undo, key)
+		return nil
+	})
+	if err != nil || !existing.IsValid() {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditDeleteHard, existing, reflect.Value{})
+}
+
+// Restore restores the soft deleted element by its id.
+// It returns ErrNotFound when there is no soft deleted element with the id.
+func (r *MemoryStorage) Restore(ctx context.Context, id interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.restore(ctx, id)
+	})
+}
+
+// restore restores the soft deleted element within the memory transaction of the context, if any
+func (r *MemoryStorage) restore(ctx context.Context, id interface{}) error {
+	if !r.softDelete {
+		return fmt.Errorf("%s is not soft deletable", r.tableName)
+	}
+
+	key, err := r.idKey(id)
+	if err != nil {
+		return err
+	}
+
+	var existing, restored reflect.Value
+	err = r.write(ctx, func(undo *undoLog) error {
+		var ok bool
+		existing, ok = r.rows[key]
+		if !ok || !r.deleted(existing) || !r.tenantVisible(ctx, existing) {
+			return ErrNotFound
+		}
+
+		restored = cloneRow(existing)
+		r.field(restored, softDeleteColumn).Set(reflect.Zero(r.fieldType(softDeleteColumn)))
+		r.put(undo, restored)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditRestore, existing, restored)
+}
+
+// Purge removes the elements that were soft deleted longer than the retention ago
+// and returns the number of purged elements
+func (r *MemoryStorage) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	if !r.softDelete {
+		return 0, fmt.Errorf("%s is not soft deletable", r.tableName)
+	}
+
+	q := NewQuery(Lt(softDeleteColumn, utils.Now()-int(retention.Seconds()))).OnlyDeleted()
+
+	var purged []reflect.Value
+	err := r.write(ctx, func(undo *undoLog) error {
+		rows, err := r.match(ctx, q)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			key, err := r.idKey(r.value(row, r.pk))
+			if err != nil {
+				return err
+			}
+			r.remove(undo, key)
+		}
+		purged = rows
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// audited as PostgresStorage.Purge, which hard deletes the elements one by one
+	for i, row := range purged {
+		err = r.auditor.record(ctx, r.modelInfo, r.tableName, AuditDeleteHard, row, reflect.Value{})
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(purged), nil
+}
+
+// SetAuditor records the changes of the storage with the auditor, as PostgresStorage.SetAuditor
+func (r *MemoryStorage) SetAuditor(auditor *Auditor) *MemoryStorage {
+	r.auditor = auditor
+	return r
+}
+
+// hooked runs f within the memory transaction of the context, or within a new one
+// when the model has hooks or the storage is audited, so their changes are undone with the operation
+func (r *MemoryStorage) hooked(ctx context.Context, f func(ctx context.Context) error) error {
+	if !r.hooks && r.auditor == nil {
+		return f(ctx)
+	}
+	if _, ok := transactionFromContext(ctx); ok {
+		return f(ctx)
+	}
+	return NewMemoryManager().RunInTransaction(ctx, f)
+}
+
+// write runs f under the write lock. The changes of f are reverted when it fails,
+// otherwise they're journaled into the memory transaction of the context, if any.
+func (r *MemoryStorage) write(ctx context.Context, f func(undo *undoLog) error) error {
+	undo := undoLog{}
+
+	r.mu.Lock()
+	err := f(&undo)
+	if err != nil {
+		undo.run()
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	t, ok := transactionFromContext(ctx)
+	if ok && t.tx == nil && len(undo) > 0 {
+		t.journal(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			undo.run()
+		})
+	}
+
+	return nil
+}
+
+// insert stores a copy of the element, generating its id when it's zero,
+// the element is then refreshed with the stored row. It must be called under the write lock.
+// As with a postgres sequence, the generated ids are not reused when the insert is undone.
+func (r *MemoryStorage) insert(undo *undoLog, elem reflect.Value) error {
+	row := cloneRow(elem)
+
+	key, err := r.idKey(r.value(row, r.pk))
+	if err != nil {
+		return err
+	}
+	if key == 0 {
+		r.lastID++
+		key = r.lastID
+		err = setValue(r.field(row, r.pk), key)
+		if err != nil {
+			return err
+		}
+	}
+	if _, ok := r.rows[key]; ok {
+		return r.constraintError(ErrAlreadyExist, "", r.pk, ErrAlreadyExist)
+	}
+	if key > r.lastID {
+		r.lastID = key
+	}
+
+	if r.lockColumn != "" {
+		version, err := r.lockVersion(row)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			// a new row starts at version 1
+			err = setValue(r.field(row, r.lockColumn), 1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	r.put(undo, row)
+	elem.Set(cloneRow(row))
+	return nil
+}
+
+// existing returns the stored row of the element, it must be called under the write lock.
+// It returns ErrNotFound when the row doesn't exist or is out of the deleted scope of the context,
+// and ErrConflict when the version of the element is not the version of the row.
+func (r *MemoryStorage) existing(ctx context.Context, elem reflect.Value) (reflect.Value, error) {
+	key, err := r.idKey(r.value(elem, r.pk))
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	row, ok := r.rows[key]
+	if !ok || !r.visible(ctx, row) {
+		return reflect.Value{}, ErrNotFound
+	}
+
+	if r.lockColumn != "" {
+		version, err := r.lockVersion(elem)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		current, err := r.lockVersion(row)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if version != current {
+			return reflect.Value{}, ErrConflict
+		}
+	}
+
+	return row, nil
+}
+
+// conflicting returns the stored row having the same values as the element on the columns,
+// it must be called under the write lock
+func (r *MemoryStorage) conflicting(elem reflect.Value, columns []string) (reflect.Value, bool, error) {
+	conditions := []Condition{}
+	for _, column := range columns {
+		conditions = append(conditions, Eq(column, r.value(elem, column)))
+	}
+	condition := And(conditions...)
+
+	for _, key := range r.keys() {
+		row := r.rows[key]
+		matched, err := condition.match(&memoryRow{info: r.modelInfo, elem: row})
+		if err != nil {
+			return reflect.Value{}, false, err
+		}
+		if matched {
+			return row, true, nil
+		}
+	}
+	return reflect.Value{}, false, nil
+}
+
+// bumpVersion increments the version of the lock column of the row, if any
+func (r *MemoryStorage) bumpVersion(row reflect.Value) error {
+	if r.lockColumn == "" {
+		return nil
+	}
+
+	version, err := r.lockVersion(row)
+	if err != nil {
+		return err
+	}
+	return setValue(r.field(row, r.lockColumn), version+1)
+}
+
+// put stores the row by its id and records how to revert it, it must be called under the write lock
+func (r *MemoryStorage) put(undo *undoLog, row reflect.Value) {
+	key, _ := r.idKey(r.value(row, r.pk))
+	previous, existed := r.rows[key]
+	undo.add(func() {
+		if existed {
+			r.rows[key] = previous
+		} else {
+			delete(r.rows, key)
+		}
+	})
+	r.rows[key] = row
+}
+
+// remove removes the row by its id and records how to revert it, it must be called under the write lock
+func (r *MemoryStorage) remove(undo *undoLog, key int64) {
+	previous, existed := r.rows[key]
+	if !existed {
+		return
+	}
+	undo.add(func() {
+		r.rows[key] = previous
+	})
+	delete(r.rows, key)
+}
+
+// selectRows returns the rows of the query under the read lock
+func (r *MemoryStorage) selectRows(ctx context.Context, q *Query) ([]reflect.Value, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.match(ctx, q)
+}
+
+// match returns the rows of the query ordered and limited as the query,
+// it must be called under the lock
+func (r *MemoryStorage) match(ctx context.Context, q *Query) ([]reflect.Value, error) {
+	// compiling validates the columns, the sort directions and the cursor as PostgresStorage does
+	_, _, _, err := q.compile(Postgres, r.modelInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withScope(ctx, q.deleted)
+	condition := And(q.conditions...)
+	if q.keyset && q.cursor != "" {
+		seek, err := q.seekCondition(r.pk)
+		if err != nil {
+			return nil, err
+		}
+		condition = And(condition, seek)
+	}
+
+	rows := []reflect.Value{}
+	for _, key := range r.keys() {
+		row := r.rows[key]
+		if !r.visible(ctx, row) {
+			continue
+		}
+
+		matched, err := condition.match(&memoryRow{info: r.modelInfo, elem: row})
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			rows = append(rows, row)
+		}
+	}
+
+	orders, offset := q.ordering(r.pk)
+	err = sortRows(r.modelInfo, rows, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset >= len(rows) {
+		return []reflect.Value{}, nil
+	}
+	rows = rows[offset:]
+	if q.limit > 0 && q.limit < len(rows) {
+		rows = rows[:q.limit]
+	}
+
+	return rows, nil
+}
+
+// keys returns the ids of the stored rows in ascending order
+func (r *MemoryStorage) keys() []int64 {
+	keys := make([]int64, 0, len(r.rows))
+	for key := range r.rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// visible reports whether the row is in the deleted scope and belongs to the tenant of the context
+func (r *MemoryStorage) visible(ctx context.Context, row reflect.Value) bool {
+	if !r.tenantVisible(ctx, row) {
+		return false
+	}
+	if !r.softDelete {
+		return true
+	}
+
+	switch scopeFromContext(ctx) {
+	case scopeWithDeleted:
+		return true
+	case scopeOnlyDeleted:
+		return r.deleted(row)
+	default:
+		return !r.deleted(row)
+	}
+}
+
+// deleted reports whether the row is soft deleted
+func (r *MemoryStorage) deleted(row reflect.Value) bool {
+	return r.softDelete && normalize(r.value(row, softDeleteColumn)) != nil
+}
+
+// idKey converts the id into the key of the stored rows
+func (r *MemoryStorage) idKey(id interface{}) (int64, error) {
+	switch v := normalize(id).(type) {
+	case int64:
+		return v, nil
+	case string:
+		key, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err == nil {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid id %v for %s, the memory storage only supports integer ids", id, r.tableName)
+}
+
+// scan copies the rows into elems, a pointer to a slice of the model or of pointers to the model
+func (r *MemoryStorage) scan(elems interface{}, rows []reflect.Value) error {
+	v := reflect.ValueOf(elems)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("expected a pointer to a slice of %s, got %T", r.elemType, elems)
+	}
+
+	datas := v.Elem()
+	err := r.checkSlice(datas)
+	if err != nil {
+		return err
+	}
+
+	result := reflect.MakeSlice(datas.Type(), 0, len(rows))
+	for _, row := range rows {
+		item := cloneRow(row)
+		if datas.Type().Elem().Kind() == reflect.Ptr {
+			item = item.Addr()
+		}
+		result = reflect.Append(result, item)
+	}
+	datas.Set(result)
+
+	return nil
+}
+
+// cloneRow copies the element so the stored rows don't share the pointers, maps and slices of the callers
+func cloneRow(elem reflect.Value) reflect.Value {
+	row := reflect.New(elem.Type()).Elem()
+	row.Set(elem)
+
+	for i := 0; i < row.NumField(); i++ {
+		field := row.Field(i)
+		if !field.CanSet() || field.IsZero() {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.Ptr:
+			p := reflect.New(field.Type().Elem())
+			p.Elem().Set(field.Elem())
+			field.Set(p)
+		case reflect.Map:
+			m := reflect.MakeMapWithSize(field.Type(), field.Len())
+			iter := field.MapRange()
+			for iter.Next() {
+				m.SetMapIndex(iter.Key(), iter.Value())
+			}
+			field.Set(m)
+		case reflect.Slice:
+			s := reflect.MakeSlice(field.Type(), field.Len(), field.Len())
+			reflect.Copy(s, field)
+			field.Set(s)
+		case reflect.Struct:
+			// the embedded structs, and the json structs, are copied field by field too
+			field.Set(cloneRow(field))
+		}
+	}
+	return row
+}
+
+// setValue sets the field to the value as the database would store it,
+// converting between the numeric types, pointers and the json of the map fields
+func setValue(field reflect.Value, value interface{}) error {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && v.Kind() == reflect.Ptr && v.Type() != field.Type() {
+		if v.IsNil() {
+			v = reflect.Value{}
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if v.Type().AssignableTo(field.Type()) {
+		field.Set(v)
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		p := reflect.New(field.Type().Elem())
+		err := setValue(p.Elem(), v.Interface())
+		if err != nil {
+			return err
+		}
+		field.Set(p)
+		return nil
+	}
+
+	if s, ok := v.Interface().(string); ok && field.Kind() == reflect.Map {
+		m := reflect.New(field.Type())
+		err := json.Unmarshal([]byte(s), m.Interface())
+		if err != nil {
+			return err
+		}
+		field.Set(m.Elem())
+		return nil
+	}
+
+	if (numeric(v.Kind()) && numeric(field.Kind())) || (v.Kind() == reflect.String && field.Kind() == reflect.String) {
+		field.Set(v.Convert(field.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("can't store %T into %s", value, field.Type())
+}
+
+// numeric reports whether the kind is an integer or a float
+func numeric(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// NewMemoryStorage creates a new in-memory storage of the model of elem
+func NewMemoryStorage(tableName string, elem interface{}) *MemoryStorage {
+	return &MemoryStorage{
+		modelInfo: modelInfoOf(reflect.TypeOf(elem)),
+		tableName: tableName,
+		rows:      map[int64]reflect.Value{},
+	}
+}
@@ -0,0 +1,456 @@
+package data
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memoryRow is a row of the memory storage matched against the conditions
+type memoryRow struct {
+	info *modelInfo
+	elem reflect.Value
+}
+
+// value returns the normalized value of the column of the row
+func (r *memoryRow) value(column string) (interface{}, error) {
+	if _, ok := r.info.fieldIndexes[column]; !ok {
+		return nil, fmt.Errorf("unknown column %q", column)
+	}
+	return normalize(r.info.value(r.elem, column)), nil
+}
+
+func (cond comparison) match(row *memoryRow) (bool, error) {
+	value, err := row.value(cond.column)
+	if err != nil {
+		return false, err
+	}
+
+	// as in SQL, a comparison with NULL never matches
+	target := normalize(cond.value)
+	if value == nil || target == nil {
+		return false, nil
+	}
+
+	if cond.operator == "ILIKE" || cond.operator == "LIKE" {
+		return like(value, target, cond.operator == "ILIKE")
+	}
+
+	c, err := compareValues(value, target)
+	if err != nil {
+		return false, err
+	}
+
+	switch cond.operator {
+	case "=":
+		return c == 0, nil
+	case "<>":
+		return c != 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	}
+	return false, fmt.Errorf("unsupported operator %q", cond.operator)
+}
+
+func (cond in) match(row *memoryRow) (bool, error) {
+	value, err := row.value(cond.column)
+	if err != nil {
+		return false, err
+	}
+
+	values := reflect.ValueOf(cond.values)
+	if values.Kind() != reflect.Slice {
+		return false, fmt.Errorf("IN condition on %q expects a slice, got %T", cond.column, cond.values)
+	}
+	if value == nil {
+		return false, nil
+	}
+
+	for i := 0; i < values.Len(); i++ {
+		target := normalize(values.Index(i).Interface())
+		if target == nil {
+			continue
+		}
+
+		c, err := compareValues(value, target)
+		if err != nil {
+			return false, err
+		}
+		if c == 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (cond between) match(row *memoryRow) (bool, error) {
+	from, err := comparison{column: cond.column, operator: ">=", value: cond.from}.match(row)
+	if err != nil || !from {
+		return false, err
+	}
+	return comparison{column: cond.column, operator: "<=", value: cond.to}.match(row)
+}
+
+func (cond null) match(row *memoryRow) (bool, error) {
+	value, err := row.value(cond.column)
+	if err != nil {
+		return false, err
+	}
+	return (value == nil) != cond.not, nil
+}
+
+func (cond group) match(row *memoryRow) (bool, error) {
+	// OR stops at the first match, AND at the first mismatch
+	or := cond.operator == "OR"
+	for _, condition := range cond.conditions {
+		matched, err := condition.match(row)
+		if err != nil {
+			return false, err
+		}
+		if matched == or {
+			return or, nil
+		}
+	}
+	return !or, nil
+}
+
+// seekCondition returns the keyset predicate compiled by seek as a condition,
+// so it can be matched by the memory storage
+func (q *Query) seekCondition(pk string) (Condition, error) {
+	key := q.keysetOrder(pk)
+	position, err := decodeCursor(q.cursor, key)
+	if err != nil {
+		return nil, err
+	}
+
+	after := Gt
+	if key.direction == Desc {
+		after = Lt
+	}
+
+	id := after(pk, cursorValue(position.ID))
+	if key.column == pk {
+		return id, nil
+	}
+
+	value := cursorValue(position.Key)
+	return Or(after(key.column, value), And(Eq(key.column, value), id)), nil
+}
+
+// normalize dereferences the value and converts it to int64, float64, string, bool or time.Time when possible,
+// so the values of different go types can be compared. A nil pointer is normalized to nil.
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch x := v.Interface().(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		if f, err := x.Float64(); err == nil {
+			return f
+		}
+		return x.String()
+	case time.Time:
+		return x
+	case []byte:
+		return string(x)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return v.Interface()
+}
+
+// compareValues compares two normalized values, the strings are parsed when compared with numbers
+func compareValues(a interface{}, b interface{}) (int, error) {
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, y), nil
+		case float64:
+			return cmp.Compare(float64(x), y), nil
+		case string:
+			if f, err := strconv.ParseFloat(y, 64); err == nil {
+				return cmp.Compare(float64(x), f), nil
+			}
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, float64(y)), nil
+		case float64:
+			return cmp.Compare(x, y), nil
+		case string:
+			if f, err := strconv.ParseFloat(y, 64); err == nil {
+				return cmp.Compare(x, f), nil
+			}
+		}
+	case string:
+		switch y := b.(type) {
+		case string:
+			return strings.Compare(x, y), nil
+		case int64, float64:
+			c, err := compareValues(b, a)
+			return -c, err
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, nil
+			case !x:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	}
+	return 0, fmt.Errorf("can't compare %T with %T", a, b)
+}
+
+// like reports whether the value matches the SQL LIKE pattern
+func like(value interface{}, pattern interface{}, insensitive bool) (bool, error) {
+	s, ok := value.(string)
+	p, ok2 := pattern.(string)
+	if !ok || !ok2 {
+		return false, fmt.Errorf("LIKE expects strings, got %T and %T", value, pattern)
+	}
+
+	expr := strings.Builder{}
+	expr.WriteString("(?s)")
+	if insensitive {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for _, r := range p {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+// sortRows sorts the rows by the orders, NULL is greater than any value as in postgres
+func sortRows(info *modelInfo, rows []reflect.Value, orders []order) error {
+	var err error
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range orders {
+			a := normalize(info.value(rows[i], o.column))
+			b := normalize(info.value(rows[j], o.column))
+
+			var c int
+			switch {
+			case a == nil && b == nil:
+				c = 0
+			case a == nil:
+				c = 1
+			case b == nil:
+				c = -1
+			default:
+				var cerr error
+				c, cerr = compareValues(a, b)
+				if cerr != nil && err == nil {
+					err = cerr
+				}
+			}
+
+			if o.direction == Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return err
+}
+
+// patterns of the where subset understood by the memory storage
+var (
+	wherePattern      = regexp.MustCompile(`(?is)^(.*?)(?:\s+ORDER\s+BY\s+(.+?))?(?:\s+LIMIT\s+(\S+))?(?:\s+OFFSET\s+(\S+))?\s*$`)
+	andPattern        = regexp.MustCompile(`(?i)\s+AND\s+`)
+	truePattern       = regexp.MustCompile(`(?i)^(TRUE|1\s*=\s*1)$`)
+	comparisonPattern = regexp.MustCompile(`(?i)^"?(\w+)"?\s*(=|<>|!=|<=|>=|<|>|\s+ILIKE\s+|\s+LIKE\s+)\s*:(\w+)$`)
+	nullPattern       = regexp.MustCompile(`(?i)^"?(\w+)"?\s+IS\s+(NOT\s+)?NULL$`)
+	inPattern         = regexp.MustCompile(`(?i)^"?(\w+)"?\s+IN\s*\(\s*:(\w+)\s*\)$`)
+	orderPattern      = regexp.MustCompile(`(?i)^"?(\w+)"?(?:\s+(ASC|DESC))?$`)
+)
+
+// parseWhere parses the where & argument given to the raw queries into a Query.
+// The predicate must be TRUE or a conjunction of comparisons (=, <>, !=, <, <=, >, >=, LIKE, ILIKE)
+// of a column with a named parameter, IS [NOT] NULL and IN (:param), it may be followed by
+// ORDER BY, LIMIT and OFFSET. Anything else returns ErrUnsupported.
+func parseWhere(where string, arg map[string]interface{}) (*Query, error) {
+	parts := wherePattern.FindStringSubmatch(strings.TrimSpace(where))
+	if parts == nil {
+		return nil, fmt.Errorf("%w: where clause %q", ErrUnsupported, where)
+	}
+
+	q := NewQuery()
+	predicate := unwrap(parts[1])
+	if !truePattern.MatchString(predicate) {
+		for _, part := range andPattern.Split(predicate, -1) {
+			condition, err := parseCondition(unwrap(part), arg)
+			if err != nil {
+				return nil, err
+			}
+			q.Where(condition)
+		}
+	}
+
+	if parts[2] != "" {
+		for _, clause := range strings.Split(parts[2], ",") {
+			o := orderPattern.FindStringSubmatch(strings.TrimSpace(clause))
+			if o == nil {
+				return nil, fmt.Errorf("%w: order by %q", ErrUnsupported, clause)
+			}
+			direction := Asc
+			if strings.EqualFold(o[2], "DESC") {
+				direction = Desc
+			}
+			q.OrderBy(o[1], direction)
+		}
+	}
+
+	var err error
+	if parts[3] != "" {
+		q.limit, err = parseInt(parts[3], arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if parts[4] != "" {
+		q.offset, err = parseInt(parts[4], arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return q, nil
+}
+
+// parseCondition parses a single predicate of the where
+func parseCondition(predicate string, arg map[string]interface{}) (Condition, error) {
+	if m := comparisonPattern.FindStringSubmatch(predicate); m != nil {
+		value, err := namedArg(m[3], arg)
+		if err != nil {
+			return nil, err
+		}
+
+		operator := strings.ToUpper(strings.TrimSpace(m[2]))
+		if operator == "!=" {
+			operator = "<>"
+		}
+		return comparison{column: m[1], operator: operator, value: value}, nil
+	}
+
+	if m := nullPattern.FindStringSubmatch(predicate); m != nil {
+		return null{column: m[1], not: m[2] != ""}, nil
+	}
+
+	if m := inPattern.FindStringSubmatch(predicate); m != nil {
+		values, err := namedArg(m[2], arg)
+		if err != nil {
+			return nil, err
+		}
+		return In(m[1], values), nil
+	}
+
+	return nil, fmt.Errorf("%w: where clause %q", ErrUnsupported, predicate)
+}
+
+// parseInt returns the integer of a LIMIT or OFFSET, either a literal or a named parameter
+func parseInt(s string, arg map[string]interface{}) (int, error) {
+	if !strings.HasPrefix(s, ":") {
+		return strconv.Atoi(s)
+	}
+
+	value, err := namedArg(s[1:], arg)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := normalize(value).(int64)
+	if !ok {
+		return 0, fmt.Errorf("expected an integer for %s, got %T", s, value)
+	}
+	return int(i), nil
+}
+
+// namedArg returns the value of the named parameter
+func namedArg(name string, arg map[string]interface{}) (interface{}, error) {
+	value, ok := arg[name]
+	if !ok {
+		return nil, fmt.Errorf("could not find name %s in %#v", name, arg)
+	}
+	return value, nil
+}
+
+// unwrap trims the spaces and the parentheses wrapping the whole predicate
+func unwrap(predicate string) string {
+	predicate = strings.TrimSpace(predicate)
+	for strings.HasPrefix(predicate, "(") && strings.HasSuffix(predicate, ")") {
+		depth := 0
+		for i, r := range predicate {
+			switch r {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			// the first parenthesis is closed before the end, it doesn't wrap the whole predicate
+			if depth == 0 && i < len(predicate)-1 {
+				return predicate
+			}
+		}
+		predicate = strings.TrimSpace(predicate[1 : len(predicate)-1])
+	}
+	return predicate
+}
@@ -0,0 +1,430 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+// conformanceItem maps every column option the memory storage must handle as the postgres storage
+type conformanceItem struct {
+	ID        int     `db:"id"`
+	Name      string  `db:"name"`
+	Age       int     `db:"age"`
+	Email     *string `db:"email"`
+	Version   int     `db:"version,lock"`
+	ClientID  int     `db:"client_id,tenant"`
+	DeletedAt *int    `db:"deleted_at"`
+	CreatedAt int     `db:"created_at,insertonly"`
+	UpdatedAt *int    `db:"updated_at"`
+}
+
+const conformanceItemSchema = `CREATE TABLE conformance_item (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	age INT NOT NULL,
+	email TEXT,
+	version INT NOT NULL,
+	client_id INT NOT NULL,
+	deleted_at INT,
+	created_at INT NOT NULL,
+	updated_at INT
+)`
+
+// conformanceStorages returns the memory storage and the sqlite-backed postgres storage of the conformance items,
+// the tests run the same cases against both so the memory storage behaves as the storage it stands for
+func conformanceStorages(t *testing.T) map[string]GenericStorage {
+	t.Helper()
+
+	return map[string]GenericStorage{
+		"memory": NewMemoryStorage("conformance_item", conformanceItem{}),
+		"sqlite": NewPostgresStorage(openSQLite(t, conformanceItemSchema), "conformance_item", conformanceItem{}),
+	}
+}
+
+// tenantContext returns the context of the client
+func tenantContext(clientID int) context.Context {
+	return context.WithValue(context.Background(), appcontext.KeyClientID, clientID)
+}
+
+// seedConformance inserts alice (20), bob (30), carol (40) without email and dave (50) for the first client
+func seedConformance(t *testing.T, storage GenericStorage) []*conformanceItem {
+	t.Helper()
+
+	email := func(s string) *string { return &s }
+	items := []*conformanceItem{
+		{Name: "alice", Age: 20, Email: email("alice@example.com")},
+		{Name: "bob", Age: 30, Email: email("bob@example.com")},
+		{Name: "carol", Age: 40},
+		{Name: "dave", Age: 50, Email: email("dave@example.com")},
+	}
+	err := storage.InsertMany(tenantContext(1), items)
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	return items
+}
+
+// itemNames returns the names of the items
+func itemNames(items []conformanceItem) []string {
+	result := []string{}
+	for _, item := range items {
+		result = append(result, item.Name)
+	}
+	return result
+}
+
+func TestConformanceWhere(t *testing.T) {
+	tests := []struct {
+		name  string
+		where string
+		arg   map[string]interface{}
+		want  []string
+	}{
+		{"true", "TRUE ORDER BY id", nil, []string{"alice", "bob", "carol", "dave"}},
+		{"equal", "name = :name", map[string]interface{}{"name": "bob"}, []string{"bob"}},
+		{"quoted column", `"name" = :name`, map[string]interface{}{"name": "bob"}, []string{"bob"}},
+		{"not equal", "age <> :age ORDER BY id", map[string]interface{}{"age": 30}, []string{"alice", "carol", "dave"}},
+		{"bang equal", "age != :age ORDER BY id", map[string]interface{}{"age": 30}, []string{"alice", "carol", "dave"}},
+		{"greater", "age > :age ORDER BY id", map[string]interface{}{"age": 30}, []string{"carol", "dave"}},
+		{"greater or equal", "age >= :age ORDER BY id", map[string]interface{}{"age": 30}, []string{"bob", "carol", "dave"}},
+		{"lower", "age < :age", map[string]interface{}{"age": 30}, []string{"alice"}},
+		{"lower or equal", "age <= :age ORDER BY id", map[string]interface{}{"age": 30}, []string{"alice", "bob"}},
+		{"conjunction", "age >= :from AND age < :to ORDER BY id", map[string]interface{}{"from": 30, "to": 50}, []string{"bob", "carol"}},
+		{"parenthesized", "(age > :age) AND (name <> :name)", map[string]interface{}{"age": 20, "name": "bob"}, []string{"carol", "dave"}},
+		{"like", "name LIKE :pattern ORDER BY id", map[string]interface{}{"pattern": "%a%"}, []string{"alice", "carol", "dave"}},
+		{"is null", "email IS NULL", nil, []string{"carol"}},
+		{"is not null", "email IS NOT NULL ORDER BY id", nil, []string{"alice", "bob", "dave"}},
+		{"in", "id IN (:ids) ORDER BY id", map[string]interface{}{"ids": []int{2, 4}}, []string{"bob", "dave"}},
+		{"string compared with number", "age > :age", map[string]interface{}{"age": "45"}, []string{"dave"}},
+		{"order desc, limit and offset", "TRUE ORDER BY age DESC LIMIT 2 OFFSET 1", nil, []string{"carol", "bob"}},
+		{"named limit", "TRUE ORDER BY age LIMIT :limit", map[string]interface{}{"limit": 1}, []string{"alice"}},
+	}
+
+	for name, storage := range conformanceStorages(t) {
+		seedConformance(t, storage)
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				arg := tt.arg
+				if arg == nil {
+					arg = map[string]interface{}{}
+				}
+
+				items := []conformanceItem{}
+				err := storage.Where(tenantContext(1), &items, tt.where, arg)
+				if err != nil {
+					t.Fatalf("Where: %v", err)
+				}
+				if got := itemNames(items); !slices.Equal(got, tt.want) {
+					t.Errorf("Where(%q) = %v, want %v", tt.where, got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestMemoryWhereUnsupported(t *testing.T) {
+	storage := NewMemoryStorage("conformance_item", conformanceItem{})
+
+	wheres := []string{
+		"LOWER(name) = :name",
+		"name = :name OR age = :age",
+		"age > 3",
+		"name = :name ORDER BY LOWER(name)",
+	}
+	for _, where := range wheres {
+		items := []conformanceItem{}
+		err := storage.Where(tenantContext(1), &items, where, map[string]interface{}{"name": "a", "age": 1})
+		if !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Where(%q) error = %v, want ErrUnsupported", where, err)
+		}
+	}
+
+	err := storage.Where(tenantContext(1), &[]conformanceItem{}, "name = :missing", map[string]interface{}{})
+	if err == nil {
+		t.Errorf("Where() with a missing argument succeeded, want an error")
+	}
+}
+
+func TestConformanceStructuredQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		want  []string
+	}{
+		{"or", NewQuery(Or(Eq("name", "alice"), Gt("age", 45))).OrderBy("id", Asc), []string{"alice", "dave"}},
+		{"ilike", NewQuery(ILike("name", "%AR%")), []string{"carol"}},
+		{"between", NewQuery(Between("age", 30, 40)).OrderBy("id", Asc), []string{"bob", "carol"}},
+		{"empty in", NewQuery(In("id", []int{})), []string{}},
+		{"not null and ne", NewQuery(NotNull("email"), Ne("name", "bob")).OrderBy("age", Desc), []string{"dave", "alice"}},
+		{"page", NewQuery().OrderBy("age", Asc).Page(2, 3), []string{"dave"}},
+	}
+
+	for name, storage := range conformanceStorages(t) {
+		seedConformance(t, storage)
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				items := []conformanceItem{}
+				err := storage.WhereQuery(tenantContext(1), &items, tt.query)
+				if err != nil {
+					t.Fatalf("WhereQuery: %v", err)
+				}
+				if got := itemNames(items); !slices.Equal(got, tt.want) {
+					t.Errorf("WhereQuery() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestConformanceInsertUpdateDelete(t *testing.T) {
+	for name, storage := range conformanceStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+
+			item := &conformanceItem{Name: "alice", Age: 20}
+			err := storage.Insert(ctx, item)
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			if item.ID == 0 || item.Version != 1 || item.ClientID != 1 || item.CreatedAt == 0 {
+				t.Errorf("Insert() = %+v, want the id, the first version, the client and the creation time", item)
+			}
+
+			item.Name = "alicia"
+			item.CreatedAt = 1
+			err = storage.Update(ctx, item)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			stored := &conformanceItem{}
+			err = storage.FindByID(ctx, stored, item.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			if stored.Name != "alicia" || stored.Version != 2 || stored.CreatedAt == 1 || stored.UpdatedAt == nil {
+				t.Errorf("the updated row is %+v, want the new name, the second version and the insert only created_at kept", stored)
+			}
+
+			err = storage.UpdateFields(ctx, &conformanceItem{ID: item.ID, Age: 21, Version: 2}, "age")
+			if err != nil {
+				t.Fatalf("UpdateFields: %v", err)
+			}
+			err = storage.FindByID(ctx, stored, item.ID)
+			if err != nil || stored.Age != 21 || stored.Name != "alicia" || stored.Version != 3 {
+				t.Errorf("after UpdateFields the row is %+v (%v), want only the age changed", stored, err)
+			}
+
+			affected, err := storage.UpdateWhere(ctx, map[string]interface{}{"age": 30}, "name = :name", map[string]interface{}{"name": "alicia"})
+			if err != nil || affected != 1 {
+				t.Errorf("UpdateWhere() = %d, %v, want 1 row", affected, err)
+			}
+
+			err = storage.DeleteHard(ctx, item.ID)
+			if err != nil {
+				t.Fatalf("DeleteHard: %v", err)
+			}
+			err = storage.FindByID(WithDeleted(ctx), stored, item.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID() after DeleteHard error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestConformanceOptimisticLock(t *testing.T) {
+	for name, storage := range conformanceStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+			items := seedConformance(t, storage)
+
+			first, second := *items[0], *items[0]
+			first.Name = "first"
+			err := storage.Update(ctx, &first)
+			if err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			second.Name = "second"
+			err = storage.Update(ctx, &second)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("Update() of a stale version error = %v, want ErrConflict", err)
+			}
+			err = storage.UpdateFields(ctx, &second, "name")
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("UpdateFields() of a stale version error = %v, want ErrConflict", err)
+			}
+
+			stored := &conformanceItem{}
+			err = storage.FindByID(ctx, stored, first.ID)
+			if err != nil || stored.Name != "first" {
+				t.Errorf("the row is %q (%v), want the first update kept", stored.Name, err)
+			}
+
+			err = storage.Update(ctx, &conformanceItem{ID: 999, Name: "ghost", Version: 1})
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Update() of a missing row error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestConformanceSoftDelete(t *testing.T) {
+	for name, storage := range conformanceStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := tenantContext(1)
+			items := seedConformance(t, storage)
+
+			err := storage.Delete(ctx, items[1].ID)
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			// nothing is deleted, the deleted row keeps its deletion time
+			for _, missing := range []struct {
+				name string
+				ctx  context.Context
+				id   int
+			}{
+				{"an already deleted row", ctx, items[1].ID},
+				{"a missing row", ctx, 1000},
+				{"a row of another tenant", tenantContext(2), items[0].ID},
+			} {
+				err = storage.Delete(missing.ctx, missing.id)
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("Delete() of %s error = %v, want ErrNotFound", missing.name, err)
+				}
+			}
+
+			scopes := []struct {
+				name string
+				ctx  context.Context
+				want []string
+			}{
+				{"default", ctx, []string{"alice", "carol", "dave"}},
+				{"with deleted", WithDeleted(ctx), []string{"alice", "bob", "carol", "dave"}},
+				{"only deleted", OnlyDeleted(ctx), []string{"bob"}},
+			}
+			for _, scope := range scopes {
+				items := []conformanceItem{}
+				err = storage.WhereQuery(scope.ctx, &items, NewQuery().OrderBy("id", Asc))
+				if err != nil {
+					t.Fatalf("WhereQuery: %v", err)
+				}
+				if got := itemNames(items); !slices.Equal(got, scope.want) {
+					t.Errorf("%s scope = %v, want %v", scope.name, got, scope.want)
+				}
+			}
+
+			count, err := storage.CountQuery(ctx, NewQuery().OnlyDeleted())
+			if err != nil || count != 1 {
+				t.Errorf("CountQuery() of the deleted = %d, %v, want 1", count, err)
+			}
+
+			stored := &conformanceItem{}
+			err = storage.FindByID(ctx, stored, items[1].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID() of a deleted row error = %v, want ErrNotFound", err)
+			}
+
+			err = storage.Restore(ctx, items[1].ID)
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			err = storage.FindByID(ctx, stored, items[1].ID)
+			if err != nil || stored.DeletedAt != nil {
+				t.Errorf("FindByID() after Restore = %+v, %v, want the restored row", stored, err)
+			}
+
+			err = storage.Restore(ctx, items[1].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Restore() of a row that isn't deleted error = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestConformanceTenantScoping(t *testing.T) {
+	for name, storage := range conformanceStorages(t) {
+		t.Run(name, func(t *testing.T) {
+			items := seedConformance(t, storage)
+			other := &conformanceItem{Name: "eve", Age: 60}
+			err := storage.Insert(tenantContext(2), other)
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			if other.ClientID != 2 {
+				t.Errorf("the item of the second client is stamped with the client %d", other.ClientID)
+			}
+
+			count, err := storage.Count(tenantContext(1), "TRUE", map[string]interface{}{})
+			if err != nil || count != 4 {
+				t.Errorf("Count() of the first client = %d, %v, want 4", count, err)
+			}
+			count, err = storage.Count(WithoutTenant(context.Background()), "TRUE", map[string]interface{}{})
+			if err != nil || count != 5 {
+				t.Errorf("Count() without tenant = %d, %v, want 5", count, err)
+			}
+			count, err = storage.Count(context.Background(), "TRUE", map[string]interface{}{})
+			if err != nil || count != 0 {
+				t.Errorf("Count() without client = %d, %v, want no row", count, err)
+			}
+
+			stored := &conformanceItem{}
+			err = storage.FindByID(tenantContext(2), stored, items[0].ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("FindByID() of another client error = %v, want ErrNotFound", err)
+			}
+
+			intruder := *items[0]
+			intruder.Name = "intruder"
+			err = storage.Update(tenantContext(2), &intruder)
+			if err == nil {
+				t.Errorf("Update() of the row of another client succeeded")
+			}
+			affected, err := storage.UpdateWhere(tenantContext(2), map[string]interface{}{"age": 0}, "TRUE", map[string]interface{}{})
+			if err != nil || affected != 1 {
+				t.Errorf("UpdateWhere() of the second client = %d, %v, want only its row", affected, err)
+			}
+
+			err = storage.Insert(context.Background(), &conformanceItem{Name: "nobody"})
+			if !errors.Is(err, ErrNoTenant) {
+				t.Errorf("Insert() without client error = %v, want ErrNoTenant", err)
+			}
+			err = storage.Insert(tenantContext(1), &conformanceItem{Name: "mallory", ClientID: 2})
+			if !errors.Is(err, ErrTenantMismatch) {
+				t.Errorf("Insert() for another client error = %v, want ErrTenantMismatch", err)
+			}
+		})
+	}
+}
+
+// numberedItem has a primary key given by the inserts, the memory storage only supports integer keys
+type numberedItem struct {
+	Number int    `db:"number,pk"`
+	Name   string `db:"name"`
+}
+
+func TestConformanceDuplicateKey(t *testing.T) {
+	db := openSQLite(t, `CREATE TABLE numbered_item (number INT PRIMARY KEY, name TEXT NOT NULL)`)
+	storages := map[string]GenericStorage{
+		"memory": NewMemoryStorage("numbered_item", numberedItem{}),
+		"sqlite": NewPostgresStorage(db, "numbered_item", numberedItem{}),
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			err := storage.Insert(context.Background(), &numberedItem{Number: 7, Name: "A"})
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			err = storage.Insert(context.Background(), &numberedItem{Number: 7, Name: "B"})
+			if !errors.Is(err, ErrAlreadyExist) {
+				t.Errorf("Insert() of a duplicate key error = %v, want ErrAlreadyExist", err)
+			}
+		})
+	}
+}
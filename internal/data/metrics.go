@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// QueryMetrics records the duration and the errors of the queries as prometheus metrics,
+// labeled by the table of the storage and the Operation, and logs the queries slower than its threshold.
+// The storages record their queries with it once given to PostgresStorage.SetMetrics.
+type QueryMetrics struct {
+	duration      *prometheus.HistogramVec
+	errors        *prometheus.CounterVec
+	slowThreshold time.Duration
+}
+
+// NewQueryMetrics creates the query metrics and registers them with the registerer, prometheus.DefaultRegisterer on nil.
+// The metrics already registered by a previous call are reused, so the storages of both calls record to the same metrics.
+// The queries slower than the slowThreshold are logged, zero disables the log.
+func NewQueryMetrics(registerer prometheus.Registerer, slowThreshold time.Duration) (*QueryMetrics, error) {
+	duration, err := registerCollector(registerer, prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "A histogram of latencies for database queries.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"table", "operation"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	errorsTotal, err := registerCollector(registerer, prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_query_errors_total",
+			Help: "A counter for database queries that failed.",
+		},
+		[]string{"table", "operation"},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueryMetrics{
+		duration:      duration,
+		errors:        errorsTotal,
+		slowThreshold: slowThreshold,
+	}, nil
+}
+
+// RegisterDBStats exports the connection pool statistics of the database, sql.DBStats, as prometheus gauges
+// labeled with the name, e.g. "primary" or "replica_1", registered with the registerer, prometheus.DefaultRegisterer on nil.
+// A name already registered keeps exporting the statistics of its first database.
+func RegisterDBStats(registerer prometheus.Registerer, db *sqlx.DB, name string) error {
+	_, err := registerCollector(registerer, collectors.NewDBStatsCollector(db.DB, name))
+	return err
+}
+
+// registerCollector registers the collector with the registerer, prometheus.DefaultRegisterer on nil,
+// and returns the collector already registered in its place, if any
+func registerCollector[C prometheus.Collector](registerer prometheus.Registerer, collector C) (C, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	err := registerer.Register(collector)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		existing, ok := alreadyRegistered.ExistingCollector.(C)
+		if !ok {
+			return collector, fmt.Errorf("register the metrics: %w", err)
+		}
+		return existing, nil
+	}
+	if err != nil {
+		return collector, fmt.Errorf("register the metrics: %w", err)
+	}
+	return collector, nil
+}
+
+// Instrument decorates the queryer so its queries are recorded as queries of the table,
+// the operation is taken from the context of the queries. It returns q itself on nil metrics.
+func (m *QueryMetrics) Instrument(q Queryer, table string) Queryer {
+	if m == nil {
+		return q
+	}
+	return &instrumentedQueryer{
+		Queryer: q,
+		metrics: m,
+		table:   table,
+	}
+}
+
+// observe records the query that started at start and failed with err, if any
+func (m *QueryMetrics) observe(ctx context.Context, table string, query string, args []interface{}, start time.Time, err error) {
+	elapsed := time.Since(start)
+
+	op := string(operationFromContext(ctx))
+	if op == "" {
+		op = "Other"
+	}
+
+	m.duration.WithLabelValues(table, op).Observe(elapsed.Seconds())
+	if err != nil && err != sql.ErrNoRows {
+		m.errors.WithLabelValues(table, op).Inc()
+	}
+
+	if m.slowThreshold > 0 && elapsed >= m.slowThreshold {
+		// the arguments may hold personal data and secrets, only their number is logged
+		log.Printf("Slow query on %s %s took %s: %s [%d args redacted]",
+			table, op, elapsed, strings.Join(strings.Fields(query), " "), len(args))
+	}
+}
+
+// instrumentedQueryer records the queries of its Queryer with the metrics.
+// The prepared statements are not recorded, the storages don't prepare their queries.
+type instrumentedQueryer struct {
+	Queryer
+	metrics *QueryMetrics
+	table   string
+}
+
+func (q *instrumentedQueryer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return q.ExecContext(context.Background(), query, args...)
+}
+
+func (q *instrumentedQueryer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := q.Queryer.ExecContext(ctx, query, args...)
+	q.metrics.observe(ctx, q.table, query, args, start, err)
+	return result, err
+}
+
+func (q *instrumentedQueryer) MustExec(query string, args ...interface{}) sql.Result {
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+func (q *instrumentedQueryer) Select(dest interface{}, query string, args ...interface{}) error {
+	return q.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (q *instrumentedQueryer) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := q.Queryer.SelectContext(ctx, dest, query, args...)
+	q.metrics.observe(ctx, q.table, query, args, start, err)
+	return err
+}
+
+func (q *instrumentedQueryer) Get(dest interface{}, query string, args ...interface{}) error {
+	return q.GetContext(context.Background(), dest, query, args...)
+}
+
+func (q *instrumentedQueryer) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := q.Queryer.GetContext(ctx, dest, query, args...)
+	q.metrics.observe(ctx, q.table, query, args, start, err)
+	return err
+}
+
+// QueryxContext records the time until the first rows are available, not the time to read all of them
+func (q *instrumentedQueryer) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := q.Queryer.QueryxContext(ctx, query, args...)
+	q.metrics.observe(ctx, q.table, query, args, start, err)
+	return rows, err
+}
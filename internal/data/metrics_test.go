@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNewQueryMetricsReusesTheRegisteredMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	first, err := NewQueryMetrics(registry, 0)
+	if err != nil {
+		t.Fatalf("NewQueryMetrics: %v", err)
+	}
+	second, err := NewQueryMetrics(registry, 0)
+	if err != nil {
+		t.Fatalf("NewQueryMetrics again: %v", err)
+	}
+	if first.duration != second.duration || first.errors != second.errors {
+		t.Fatalf("NewQueryMetrics() again created other metrics, want the registered ones")
+	}
+
+	db := openSQLite(t, `CREATE TABLE metric_item (id INTEGER PRIMARY KEY)`)
+	q := second.Instrument(db, "metric_item")
+	_, err = q.ExecContext(context.Background(), `INSERT INTO metric_item (id) VALUES (1)`)
+	if err != nil {
+		t.Fatalf("ExecContext: %v", err)
+	}
+	_, err = q.ExecContext(context.Background(), `INSERT INTO missing_table (id) VALUES (1)`)
+	if err == nil {
+		t.Fatalf("ExecContext() on a missing table succeeded")
+	}
+
+	if got := testutil.ToFloat64(first.errors.WithLabelValues("metric_item", "Other")); got != 1 {
+		t.Errorf("db_query_errors_total = %v, want 1", got)
+	}
+	if got := testutil.CollectAndCount(first.duration); got != 1 {
+		t.Errorf("db_query_duration_seconds has %d series, want 1", got)
+	}
+}
+
+func TestNewQueryMetricsConflictingRegistration(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Another counter of the same name.",
+	}))
+
+	_, err := NewQueryMetrics(registry, 0)
+	if err == nil {
+		t.Errorf("NewQueryMetrics() over a conflicting metric succeeded, want an error")
+	}
+}
+
+func TestRegisterDBStatsTwice(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	db := openSQLite(t)
+
+	for i := 0; i < 2; i++ {
+		err := RegisterDBStats(registry, db, "primary")
+		if err != nil {
+			t.Fatalf("RegisterDBStats() call %d: %v", i+1, err)
+		}
+	}
+	err := RegisterDBStats(registry, db, "replica_1")
+	if err != nil {
+		t.Fatalf("RegisterDBStats(replica_1): %v", err)
+	}
+}
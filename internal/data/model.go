@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// modelInfo holds the column metadata of a model type.
+//
+// The fields are mapped to the columns by their db tag, `db:"name,option,..."`, with the options:
+//   - pk: the primary key, otherwise it's the "id" column which is generated by the database
+//   - readonly: never written by the storage, e.g. a serial primary key or a column with a database default
+//   - insertonly: written by the inserts but never updated, e.g. created_at
+//   - json: stored as json, for the struct, slice and map fields
+//   - lock: the version of the optimistic locking, see PostgresStorage.Update
+//   - tenant: the client owning the row, the rows are scoped to the appcontext.ClientID of the context,
+//     see WithoutTenant. It's filled by the inserts and never updated.
+//
+// A tag without name, e.g. `db:",pk"`, maps the lower-cased field name as sqlx does.
+// The fields of the structs embedded by value without db tag, e.g. a shared Timestamps base,
+// are mapped as if they were fields of the model.
+type modelInfo struct {
+	elemType reflect.Type
+	columns  []string
+	// fieldIndexes are the index paths of the fields of the columns, through the embedded structs
+	fieldIndexes map[string][]int
+	pk           string
+	// insertable are the columns written by the inserts, updatable the ones written by the updates
+	insertable   []string
+	updatable    []string
+	jsonColumns  []string
+	softDelete   bool
+	lockColumn   string
+	tenantColumn string
+	insertParams string
+	// hooks reports whether the model implements a hook, deleteHooks a delete hook
+	hooks       bool
+	deleteHooks bool
+}
+
+// modelInfos caches the modelInfo by its reflect.Type
+var modelInfos sync.Map
+
+// modelInfoOf returns the column metadata of the model type,
+// it's only computed once per type and shared by every storage of that type
+func modelInfoOf(elemType reflect.Type) *modelInfo {
+	if info, ok := modelInfos.Load(elemType); ok {
+		return info.(*modelInfo)
+	}
+
+	info := &modelInfo{
+		elemType:     elemType,
+		fieldIndexes: map[string][]int{},
+		pk:           idColumn,
+		hooks: implements(elemType, beforeInsertHook, afterInsertHook, beforeUpdateHook,
+			afterUpdateHook, beforeDeleteHook, afterDeleteHook),
+		deleteHooks: implements(elemType, beforeDeleteHook, afterDeleteHook),
+	}
+
+	fields := modelFields(elemType, nil)
+	for _, f := range fields {
+		if f.has("pk") {
+			info.pk = f.name
+		}
+	}
+	for _, f := range fields {
+		info.columns = append(info.columns, f.name)
+		info.fieldIndexes[f.name] = f.index
+
+		// without pk option, the id is a serial column
+		readonly := f.has("readonly") || (f.name == info.pk && !f.has("pk"))
+		if !readonly {
+			info.insertable = append(info.insertable, f.name)
+		}
+		if !readonly && !f.has("insertonly") && !f.has("tenant") && f.name != info.pk {
+			info.updatable = append(info.updatable, f.name)
+		}
+		if f.has("json") || f.typ == reflect.TypeOf(map[string]interface{}{}) {
+			info.jsonColumns = append(info.jsonColumns, f.name)
+		}
+		if f.has("lock") {
+			info.lockColumn = f.name
+		}
+		if f.has("tenant") {
+			info.tenantColumn = f.name
+		}
+	}
+	info.softDelete = contains(info.columns, softDeleteColumn)
+	info.insertParams = insertParams(info, 0)
+
+	actual, _ := modelInfos.LoadOrStore(elemType, info)
+	return actual.(*modelInfo)
+}
+
+// modelField is a field of a model mapped to a column
+type modelField struct {
+	name    string
+	index   []int
+	typ     reflect.Type
+	options []string
+}
+
+// has reports whether the db tag of the field has the option
+func (f modelField) has(option string) bool {
+	return contains(f.options, option)
+}
+
+// modelFields returns the mapped fields of the struct type, walking the structs embedded by value,
+// the index paths are prefixed with the index of the embedding field
+func modelFields(structType reflect.Type, prefix []int) []modelField {
+	fields := []modelField{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		index := append(append([]int{}, prefix...), i)
+
+		name, options := columnTag(field)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("db") == "" {
+			fields = append(fields, modelFields(field.Type, index)...)
+			continue
+		}
+		if emptyTag(name) {
+			continue
+		}
+
+		fields = append(fields, modelField{
+			name:    name,
+			index:   index,
+			typ:     field.Type,
+			options: options,
+		})
+	}
+	return fields
+}
+
+// value returns the value of the column from the element, elem is the model or a pointer to it
+func (m *modelInfo) value(elem reflect.Value, column string) interface{} {
+	index, ok := m.fieldIndexes[column]
+	if !ok {
+		return nil
+	}
+	return reflect.Indirect(elem).FieldByIndex(index).Interface()
+}
+
+// field returns the field of the column of the element, elem is the model or a pointer to it
+func (m *modelInfo) field(elem reflect.Value, column string) reflect.Value {
+	return reflect.Indirect(elem).FieldByIndex(m.fieldIndexes[column])
+}
+
+// fieldType returns the type of the field of the column
+func (m *modelInfo) fieldType(column string) reflect.Type {
+	return m.elemType.FieldByIndex(m.fieldIndexes[column]).Type
+}
+
+// jsonName returns the json name of the field of the column, the column itself when the field has no json name
+func (m *modelInfo) jsonName(column string) string {
+	name, _, _ := strings.Cut(m.elemType.FieldByIndex(m.fieldIndexes[column]).Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return column
+	}
+	return name
+}
+
+// dbValue returns the value of the column of the element to be stored in the database,
+// the json columns are marshaled
+func (m *modelInfo) dbValue(elem reflect.Value, column string) interface{} {
+	value := m.value(elem, column)
+	if !contains(m.jsonColumns, column) {
+		return value
+	}
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// columnTag returns the column name and the options of the db tag of the field,
+// e.g. `db:"version,lock"` is the column "version" with the option "lock"
+func columnTag(field reflect.StructField) (string, []string) {
+	parts := strings.Split(field.Tag.Get("db"), ",")
+	if parts[0] == "" && len(parts) > 1 {
+		parts[0] = strings.ToLower(field.Name)
+	}
+	return parts[0], parts[1:]
+}
+
+// checkElem returns an error when elem is not a pointer to the model
+func (m *modelInfo) checkElem(elem interface{}) error {
+	if reflect.TypeOf(elem) != reflect.PtrTo(m.elemType) {
+		return fmt.Errorf("expected *%s, got %T", m.elemType, elem)
+	}
+	return nil
+}
+
+// checkSlice returns an error when datas is not a slice of the model or of pointers to the model
+func (m *modelInfo) checkSlice(datas reflect.Value) error {
+	if datas.Kind() != reflect.Slice {
+		return fmt.Errorf("expected a slice of %s, got %s", m.elemType, datas.Type())
+	}
+
+	itemType := datas.Type().Elem()
+	if itemType != m.elemType && itemType != reflect.PtrTo(m.elemType) {
+		return fmt.Errorf("expected a slice of %s, got %s", m.elemType, datas.Type())
+	}
+	return nil
+}
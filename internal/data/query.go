@@ -0,0 +1,423 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SortDirection represents the direction of a query ordering
+type SortDirection string
+
+// Sort directions
+const (
+	Asc  SortDirection = "ASC"
+	Desc SortDirection = "DESC"
+)
+
+// softDeleteColumn is the column marking a row as soft deleted
+const softDeleteColumn = "deleted_at"
+
+// idColumn is the default primary key column, see modelInfo
+const idColumn = "id"
+
+// Condition represents a typed filter of a Query,
+// it's compiled into SQL by the postgres storage and matched against the rows by the memory storage
+type Condition interface {
+	compile(c *compiler) (string, error)
+	match(row *memoryRow) (bool, error)
+}
+
+// compiler turns the conditions into named-parameter SQL of the dialect,
+// it only accepts the columns that are mapped by the model
+type compiler struct {
+	dialect Dialect
+	columns []string
+	// pk is the primary key of the model, it breaks the ties of keyset pagination
+	pk   string
+	args map[string]interface{}
+}
+
+// column validates the column against the model and returns it quoted
+func (c *compiler) column(column string) (string, error) {
+	if !contains(c.columns, column) {
+		return "", fmt.Errorf("unknown column %q", column)
+	}
+	return c.dialect.Quote(column), nil
+}
+
+// bind stores the value as a new argument and returns its named parameter
+func (c *compiler) bind(value interface{}) string {
+	name := fmt.Sprintf("q%d", len(c.args)+1)
+	c.args[name] = value
+	return ":" + name
+}
+
+type comparison struct {
+	column   string
+	operator string
+	value    interface{}
+}
+
+func (cond comparison) compile(c *compiler) (string, error) {
+	column, err := c.column(cond.column)
+	if err != nil {
+		return "", err
+	}
+	if cond.operator == "ILIKE" {
+		return c.dialect.ILike(column, c.bind(cond.value)), nil
+	}
+	return fmt.Sprintf("%s %s %s", column, cond.operator, c.bind(cond.value)), nil
+}
+
+// Eq matches the rows where column = value
+func Eq(column string, value interface{}) Condition {
+	return comparison{column: column, operator: "=", value: value}
+}
+
+// Ne matches the rows where column <> value
+func Ne(column string, value interface{}) Condition {
+	return comparison{column: column, operator: "<>", value: value}
+}
+
+// Gt matches the rows where column > value
+func Gt(column string, value interface{}) Condition {
+	return comparison{column: column, operator: ">", value: value}
+}
+
+// Gte matches the rows where column >= value
+func Gte(column string, value interface{}) Condition {
+	return comparison{column: column, operator: ">=", value: value}
+}
+
+// Lt matches the rows where column < value
+func Lt(column string, value interface{}) Condition {
+	return comparison{column: column, operator: "<", value: value}
+}
+
+// Lte matches the rows where column <= value
+func Lte(column string, value interface{}) Condition {
+	return comparison{column: column, operator: "<=", value: value}
+}
+
+// ILike matches the rows where column matches the pattern case-insensitively
+func ILike(column string, pattern string) Condition {
+	return comparison{column: column, operator: "ILIKE", value: pattern}
+}
+
+type in struct {
+	column string
+	values interface{}
+}
+
+func (cond in) compile(c *compiler) (string, error) {
+	column, err := c.column(cond.column)
+	if err != nil {
+		return "", err
+	}
+
+	values := reflect.ValueOf(cond.values)
+	if values.Kind() != reflect.Slice {
+		return "", fmt.Errorf("IN condition on %q expects a slice, got %T", cond.column, cond.values)
+	}
+	if values.Len() == 0 {
+		return "FALSE", nil
+	}
+	return fmt.Sprintf("%s IN (%s)", column, c.bind(cond.values)), nil
+}
+
+// In matches the rows where column is one of the values, values must be a slice
+func In(column string, values interface{}) Condition {
+	return in{column: column, values: values}
+}
+
+type between struct {
+	column string
+	from   interface{}
+	to     interface{}
+}
+
+func (cond between) compile(c *compiler) (string, error) {
+	column, err := c.column(cond.column)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s BETWEEN %s AND %s", column, c.bind(cond.from), c.bind(cond.to)), nil
+}
+
+// Between matches the rows where column is between from and to inclusively
+func Between(column string, from interface{}, to interface{}) Condition {
+	return between{column: column, from: from, to: to}
+}
+
+type null struct {
+	column string
+	not    bool
+}
+
+func (cond null) compile(c *compiler) (string, error) {
+	column, err := c.column(cond.column)
+	if err != nil {
+		return "", err
+	}
+	if cond.not {
+		return fmt.Sprintf("%s IS NOT NULL", column), nil
+	}
+	return fmt.Sprintf("%s IS NULL", column), nil
+}
+
+// IsNull matches the rows where column is null
+func IsNull(column string) Condition {
+	return null{column: column}
+}
+
+// NotNull matches the rows where column is not null
+func NotNull(column string) Condition {
+	return null{column: column, not: true}
+}
+
+type group struct {
+	operator   string
+	conditions []Condition
+}
+
+func (cond group) compile(c *compiler) (string, error) {
+	if len(cond.conditions) == 0 {
+		if cond.operator == "OR" {
+			return "FALSE", nil
+		}
+		return "TRUE", nil
+	}
+
+	predicates := []string{}
+	for _, condition := range cond.conditions {
+		predicate, err := condition.compile(c)
+		if err != nil {
+			return "", err
+		}
+		predicates = append(predicates, "("+predicate+")")
+	}
+	return strings.Join(predicates, " "+cond.operator+" "), nil
+}
+
+// And matches the rows matching all the conditions
+func And(conditions ...Condition) Condition {
+	return group{operator: "AND", conditions: conditions}
+}
+
+// Or matches the rows matching at least one of the conditions
+func Or(conditions ...Condition) Condition {
+	return group{operator: "OR", conditions: conditions}
+}
+
+type order struct {
+	column    string
+	direction SortDirection
+}
+
+// Query represents a structured select query,
+// it's compiled into the named-parameter SQL of the dialect run by the generic storage.
+// Rows that are soft deleted are excluded unless WithDeleted or OnlyDeleted is called
+// on the query or on the context.
+type Query struct {
+	conditions []Condition
+	orders     []order
+	limit      int
+	offset     int
+	deleted    deletedScope
+	keyset     bool
+	cursor     string
+}
+
+// Where adds the conditions to the query, all of them must match
+func (q *Query) Where(conditions ...Condition) *Query {
+	q.conditions = append(q.conditions, conditions...)
+	return q
+}
+
+// OrderBy adds an ordering to the query
+func (q *Query) OrderBy(column string, direction SortDirection) *Query {
+	q.orders = append(q.orders, order{column: column, direction: direction})
+	return q
+}
+
+// Limit limits the number of rows returned, zero means no limit
+func (q *Query) Limit(limit int) *Query {
+	q.limit = limit
+	return q
+}
+
+// Offset skips the first offset rows
+func (q *Query) Offset(offset int) *Query {
+	q.offset = offset
+	return q
+}
+
+// Page sets the limit and the offset of the page, the first page is 1
+func (q *Query) Page(page int, limit int) *Query {
+	if page < 1 {
+		page = 1
+	}
+	q.limit = limit
+	q.offset = (page - 1) * limit
+	return q
+}
+
+// After switches the query to keyset pagination and starts right after the cursor,
+// an empty cursor starts from the first element.
+// In keyset mode the rows are ordered by the first ordering of the query and then by the primary key
+// in the same direction, the other orderings and the offset are ignored. The sort column can't be nullable,
+// as the rows with a null key can't be compared with the cursor, and a cursor is only accepted
+// by a query with the same ordering as the query it was created from.
+func (q *Query) After(cursor string) *Query {
+	q.keyset = true
+	q.cursor = cursor
+	return q
+}
+
+// keysetOrder returns the ordering used by keyset pagination, by default the primary key descending
+func (q *Query) keysetOrder(pk string) order {
+	if len(q.orders) > 0 {
+		return q.orders[0]
+	}
+	return order{column: pk, direction: Desc}
+}
+
+// checkKeyset checks the keyset ordering can be paginated, its column must not hold a null
+func (q *Query) checkKeyset(m *modelInfo) error {
+	key := q.keysetOrder(m.pk)
+	if !contains(m.columns, key.column) {
+		return fmt.Errorf("unknown column %q", key.column)
+	}
+	if key.column != m.pk && nullable(m.fieldType(key.column)) {
+		return fmt.Errorf("keyset pagination can't sort by the nullable column %q", key.column)
+	}
+	return nil
+}
+
+// seek compiles the keyset predicate selecting the rows after the cursor
+func (q *Query) seek(c *compiler) (string, error) {
+	key := q.keysetOrder(c.pk)
+	position, err := decodeCursor(q.cursor, key)
+	if err != nil {
+		return "", err
+	}
+
+	operator := ">"
+	if key.direction == Desc {
+		operator = "<"
+	}
+
+	id, err := c.column(c.pk)
+	if err != nil {
+		return "", err
+	}
+	if key.column == c.pk {
+		return fmt.Sprintf("%s %s %s", id, operator, c.bind(cursorValue(position.ID))), nil
+	}
+
+	column, err := c.column(key.column)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("(%s, %s) %s (%s, %s)", column, id, operator,
+		c.bind(cursorValue(position.Key)), c.bind(cursorValue(position.ID))), nil
+}
+
+// cursorValue converts the decoded json numbers back into their textual form
+func cursorValue(v interface{}) interface{} {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return v
+}
+
+// WithDeleted includes the soft deleted rows in the query
+func (q *Query) WithDeleted() *Query {
+	q.deleted = scopeWithDeleted
+	return q
+}
+
+// OnlyDeleted only queries the soft deleted rows
+func (q *Query) OnlyDeleted() *Query {
+	q.deleted = scopeOnlyDeleted
+	return q
+}
+
+// ordering returns the orderings and the offset the query runs with,
+// keyset pagination orders by its key then by the primary key and ignores the offset
+func (q *Query) ordering(pk string) ([]order, int) {
+	if !q.keyset {
+		return q.orders, q.offset
+	}
+
+	key := q.keysetOrder(pk)
+	orders := []order{key}
+	if key.column != pk {
+		orders = append(orders, order{column: pk, direction: key.direction})
+	}
+	return orders, 0
+}
+
+// compile builds the WHERE predicate and the ORDER BY / LIMIT / OFFSET tail of the query
+func (q *Query) compile(dialect Dialect, m *modelInfo) (string, string, map[string]interface{}, error) {
+	c := &compiler{
+		dialect: dialect,
+		columns: m.columns,
+		pk:      m.pk,
+		args:    map[string]interface{}{},
+	}
+
+	where, err := And(q.conditions...).compile(c)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if q.keyset {
+		err = q.checkKeyset(m)
+		if err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	orders, offset := q.ordering(c.pk)
+	if q.keyset && q.cursor != "" {
+		predicate, err := q.seek(c)
+		if err != nil {
+			return "", "", nil, err
+		}
+		where = fmt.Sprintf("(%s) AND (%s)", where, predicate)
+	}
+
+	tail := []string{}
+	if len(orders) > 0 {
+		clauses := []string{}
+		for _, o := range orders {
+			column, err := c.column(o.column)
+			if err != nil {
+				return "", "", nil, err
+			}
+			if o.direction != Asc && o.direction != Desc {
+				return "", "", nil, fmt.Errorf("invalid sort direction %q", o.direction)
+			}
+			clauses = append(clauses, fmt.Sprintf("%s %s", column, o.direction))
+		}
+		tail = append(tail, "ORDER BY "+strings.Join(clauses, ","))
+	}
+	if q.limit > 0 {
+		tail = append(tail, "LIMIT "+c.bind(q.limit))
+	}
+	if offset > 0 {
+		tail = append(tail, "OFFSET "+c.bind(offset))
+	}
+
+	return where, strings.Join(tail, " "), c.args, nil
+}
+
+// NewQuery creates a new query matching all the conditions
+func NewQuery(conditions ...Condition) *Query {
+	return &Query{
+		conditions: conditions,
+	}
+}
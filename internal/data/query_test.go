@@ -0,0 +1,162 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type queryItem struct {
+	ID    int     `db:"id"`
+	Name  string  `db:"name"`
+	Age   int     `db:"age"`
+	Email *string `db:"email"`
+}
+
+func TestQueryCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   *Query
+		where   string
+		tail    string
+		args    map[string]interface{}
+	}{
+		{
+			name:    "no condition",
+			dialect: Postgres,
+			query:   NewQuery(),
+			where:   "TRUE",
+			args:    map[string]interface{}{},
+		},
+		{
+			name:    "comparisons",
+			dialect: Postgres,
+			query:   NewQuery(Eq("name", "a"), Gt("age", 18)).Where(Lte("age", 65)),
+			where:   `("name" = :q1) AND ("age" > :q2) AND ("age" <= :q3)`,
+			args:    map[string]interface{}{"q1": "a", "q2": 18, "q3": 65},
+		},
+		{
+			name:    "or of groups",
+			dialect: Postgres,
+			query:   NewQuery(Or(Eq("name", "a"), And(Ne("age", 1), IsNull("email")))),
+			where:   `(("name" = :q1) OR (("age" <> :q2) AND ("email" IS NULL)))`,
+			args:    map[string]interface{}{"q1": "a", "q2": 1},
+		},
+		{
+			name:    "empty groups",
+			dialect: Postgres,
+			query:   NewQuery(Or(), And()),
+			where:   `(FALSE) AND (TRUE)`,
+			args:    map[string]interface{}{},
+		},
+		{
+			name:    "in, between and not null",
+			dialect: Postgres,
+			query:   NewQuery(In("id", []int{1, 2}), In("age", []int{}), Between("age", 1, 9), NotNull("email")),
+			where:   `("id" IN (:q1)) AND (FALSE) AND ("age" BETWEEN :q2 AND :q3) AND ("email" IS NOT NULL)`,
+			args:    map[string]interface{}{"q1": []int{1, 2}, "q2": 1, "q3": 9},
+		},
+		{
+			name:    "postgres ilike",
+			dialect: Postgres,
+			query:   NewQuery(ILike("name", "%a%")),
+			where:   `("name" ILIKE :q1)`,
+			args:    map[string]interface{}{"q1": "%a%"},
+		},
+		{
+			name:    "mysql ilike and quoting",
+			dialect: MySQL,
+			query:   NewQuery(ILike("name", "%a%")),
+			where:   "(LOWER(`name`) LIKE LOWER(:q1))",
+			args:    map[string]interface{}{"q1": "%a%"},
+		},
+		{
+			name:    "ordering and page",
+			dialect: Postgres,
+			query:   NewQuery().OrderBy("age", Desc).OrderBy("id", Asc).Page(3, 10),
+			where:   "TRUE",
+			tail:    `ORDER BY "age" DESC,"id" ASC LIMIT :q1 OFFSET :q2`,
+			args:    map[string]interface{}{"q1": 10, "q2": 20},
+		},
+		{
+			name:    "keyset without cursor orders by the key then the id and drops the offset",
+			dialect: Postgres,
+			query:   NewQuery().OrderBy("age", Asc).OrderBy("name", Desc).Offset(5).Limit(2).After(""),
+			where:   "TRUE",
+			tail:    `ORDER BY "age" ASC,"id" ASC LIMIT :q1`,
+			args:    map[string]interface{}{"q1": 2},
+		},
+		{
+			name:    "keyset after a cursor of the primary key",
+			dialect: Postgres,
+			query:   NewQuery().After(mustCursor(t, order{column: "id", direction: Desc}, 7, 7)),
+			where:   `(TRUE) AND ("id" < :q1)`,
+			tail:    `ORDER BY "id" DESC`,
+			args:    map[string]interface{}{"q1": "7"},
+		},
+		{
+			name:    "keyset after a cursor of another column",
+			dialect: Postgres,
+			query:   NewQuery(Eq("name", "a")).OrderBy("age", Asc).After(mustCursor(t, order{column: "age", direction: Asc}, 30, 4)),
+			where:   `(("name" = :q1)) AND (("age", "id") > (:q2, :q3))`,
+			tail:    `ORDER BY "age" ASC,"id" ASC`,
+			args:    map[string]interface{}{"q1": "a", "q2": "30", "q3": "4"},
+		},
+	}
+
+	m := modelInfoOf(reflect.TypeOf(queryItem{}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, tail, args, err := tt.query.compile(tt.dialect, m)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			if where != tt.where {
+				t.Errorf("where = %s\nwant    %s", where, tt.where)
+			}
+			if tail != tt.tail {
+				t.Errorf("tail = %s\nwant   %s", tail, tt.tail)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v\nwant   %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestQueryCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		want  string
+	}{
+		{"unknown column", NewQuery(Eq("password", "x")), `unknown column "password"`},
+		{"unknown nested column", NewQuery(Or(Eq("name", "a"), IsNull("token"))), `unknown column "token"`},
+		{"unknown order column", NewQuery().OrderBy("rank", Asc), `unknown column "rank"`},
+		{"invalid direction", NewQuery().OrderBy("age", "SIDEWAYS"), `invalid sort direction`},
+		{"in without slice", NewQuery(In("id", 1)), `expects a slice`},
+		{"invalid cursor", NewQuery().After("%%%"), ErrInvalidCursor.Error()},
+	}
+
+	m := modelInfoOf(reflect.TypeOf(queryItem{}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := tt.query.compile(Postgres, m)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("compile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// mustCursor encodes the cursor of the keyset ordering
+func mustCursor(t *testing.T, key order, value interface{}, id interface{}) string {
+	t.Helper()
+
+	cursor, err := encodeCursor(key, value, id)
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+	return cursor
+}
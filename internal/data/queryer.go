@@ -10,16 +10,28 @@ import (
 type key int
 
 const (
-	txKey key = 0
+	txKey          key = 0
+	scopeKey       key = 1
+	transactionKey key = 2
+	primaryKey     key = 3
+	noTenantKey    key = 4
+	operationKey   key = 5
 )
 
 // Queryer represents the database commands interface
+// The storages only use the context variants so the queries are cancelled with their context.
 type Queryer interface {
 	PrepareNamed(query string) (*sqlx.NamedStmt, error)
+	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
 	Rebind(query string) string
 	MustExec(query string, args ...interface{}) sql.Result
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	Select(dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 	Get(dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
 }
 
 // NewContext creates a new data context
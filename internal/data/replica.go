@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// replica is a read replica and its last known health
+type replica struct {
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// ReplicaSet routes the read queries to its healthy replicas in round robin
+type ReplicaSet struct {
+	replicas []*replica
+	next     atomic.Uint32
+	stop     chan struct{}
+}
+
+// WithPrimary makes the storage queries run with the context read from the primary,
+// use it for the flows that must read their own writes
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey, true)
+}
+
+// primaryFromContext reports whether the context must read from the primary
+func primaryFromContext(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey).(bool)
+	return primary
+}
+
+// pick returns the next healthy replica, or nil when none is healthy
+func (rs *ReplicaSet) pick() Queryer {
+	if rs == nil {
+		return nil
+	}
+
+	for range rs.replicas {
+		r := rs.replicas[int(rs.next.Add(1))%len(rs.replicas)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// check pings every replica and updates its health
+func (rs *ReplicaSet) check(timeout time.Duration) {
+	for i, r := range rs.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err := r.db.PingContext(ctx)
+		cancel()
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) != healthy {
+			if healthy {
+				log.Printf("Database replica %d is back", i)
+			} else {
+				log.Printf("Database replica %d is down: %v", i, err)
+			}
+		}
+	}
+}
+
+// Close stops the health checks of the replicas, it doesn't close their connections
+func (rs *ReplicaSet) Close() {
+	close(rs.stop)
+}
+
+// NewReplicaSet creates a new replica set of the dbs and checks their health every interval
+func NewReplicaSet(interval time.Duration, dbs ...*sqlx.DB) *ReplicaSet {
+	rs := &ReplicaSet{
+		stop: make(chan struct{}),
+	}
+	for _, db := range dbs {
+		r := &replica{db: db}
+		r.healthy.Store(true)
+		rs.replicas = append(rs.replicas, r)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-ticker.C:
+				rs.check(interval)
+			}
+		}
+	}()
+
+	return rs
+}
@@ -0,0 +1,150 @@
+package data
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// openNamed opens a sqlite database of tx items holding a single item of the name
+func openNamed(t *testing.T, name string) *sqlx.DB {
+	t.Helper()
+
+	db := openSQLite(t, txItemSchema)
+	_, err := db.Exec(`INSERT INTO tx_item (name) VALUES (?)`, name)
+	if err != nil {
+		t.Fatalf("insert %s: %v", name, err)
+	}
+	return db
+}
+
+// newReplicaSet creates a replica set of the dbs whose health is only checked by the test
+func newReplicaSet(t *testing.T, dbs ...*sqlx.DB) *ReplicaSet {
+	t.Helper()
+
+	rs := NewReplicaSet(time.Hour, dbs...)
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func TestReplicaRouting(t *testing.T) {
+	primary := openNamed(t, "primary")
+	replica := openNamed(t, "replica")
+	storage := NewPostgresStorage(primary, "tx_item", txItem{}).SetReplicas(newReplicaSet(t, replica))
+	ctx := context.Background()
+
+	t.Run("reads go to the replica", func(t *testing.T) {
+		if got := names(t, storage); !slices.Equal(got, []string{"replica"}) {
+			t.Errorf("read %v, want the replica", got)
+		}
+
+		item := txItem{}
+		err := storage.Single(ctx, &item, "name = :name", map[string]interface{}{"name": "replica"})
+		if err != nil {
+			t.Errorf("Single() error = %v", err)
+		}
+	})
+
+	t.Run("WithPrimary reads from the primary", func(t *testing.T) {
+		items := []txItem{}
+		err := storage.Where(WithPrimary(ctx), &items, "1 = 1", map[string]interface{}{})
+		if err != nil {
+			t.Fatalf("Where: %v", err)
+		}
+		if len(items) != 1 || items[0].Name != "primary" {
+			t.Errorf("read %v, want the primary", items)
+		}
+	})
+
+	t.Run("writes go to the primary", func(t *testing.T) {
+		err := storage.Insert(ctx, &txItem{Name: "written"})
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+
+		for db, want := range map[*sqlx.DB]int{primary: 2, replica: 1} {
+			count := 0
+			err = db.Get(&count, `SELECT COUNT(*) FROM tx_item`)
+			if err != nil {
+				t.Fatalf("count: %v", err)
+			}
+			if count != want {
+				t.Errorf("counted %d items, want %d", count, want)
+			}
+		}
+	})
+
+	t.Run("reads inside a transaction go to the primary", func(t *testing.T) {
+		err := NewManager(primary).RunInTransaction(ctx, func(tctx context.Context) error {
+			count, err := storage.Count(tctx, "1 = 1", map[string]interface{}{})
+			if err != nil {
+				return err
+			}
+			if count != 2 {
+				t.Errorf("counted %d items, want the 2 of the primary", count)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("RunInTransaction() error = %v", err)
+		}
+	})
+}
+
+func TestReplicaRoundRobin(t *testing.T) {
+	primary := openNamed(t, "primary")
+	storage := NewPostgresStorage(primary, "tx_item", txItem{}).
+		SetReplicas(newReplicaSet(t, openNamed(t, "first"), openNamed(t, "second")))
+
+	read := map[string]int{}
+	for i := 0; i < 4; i++ {
+		for _, name := range names(t, storage) {
+			read[name]++
+		}
+	}
+	if read["first"] != 2 || read["second"] != 2 {
+		t.Errorf("read %v, want each replica twice", read)
+	}
+}
+
+func TestReplicaFallbackToThePrimary(t *testing.T) {
+	primary := openNamed(t, "primary")
+
+	t.Run("without replica", func(t *testing.T) {
+		storage := NewPostgresStorage(primary, "tx_item", txItem{}).SetReplicas(newReplicaSet(t))
+		if got := names(t, storage); !slices.Equal(got, []string{"primary"}) {
+			t.Errorf("read %v, want the primary", got)
+		}
+	})
+
+	t.Run("without replica set", func(t *testing.T) {
+		storage := NewPostgresStorage(primary, "tx_item", txItem{})
+		if got := names(t, storage); !slices.Equal(got, []string{"primary"}) {
+			t.Errorf("read %v, want the primary", got)
+		}
+	})
+
+	t.Run("replicas down", func(t *testing.T) {
+		down := openNamed(t, "down")
+		up := openNamed(t, "up")
+		rs := newReplicaSet(t, down, up)
+		storage := NewPostgresStorage(primary, "tx_item", txItem{}).SetReplicas(rs)
+
+		down.Close()
+		rs.check(time.Second)
+		for i := 0; i < 3; i++ {
+			if got := names(t, storage); !slices.Equal(got, []string{"up"}) {
+				t.Errorf("read %v, want the healthy replica", got)
+			}
+		}
+
+		up.Close()
+		rs.check(time.Second)
+		if got := names(t, storage); !slices.Equal(got, []string{"primary"}) {
+			t.Errorf("read %v, want the primary", got)
+		}
+	})
+}
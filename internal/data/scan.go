@@ -0,0 +1,137 @@
+package data
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// jsonScanner scans a json column into its field
+type jsonScanner struct {
+	field reflect.Value
+}
+
+// Scan implements sql.Scanner
+func (s jsonScanner) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		s.field.Set(reflect.Zero(s.field.Type()))
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into the json field %s", src, s.field.Type())
+	}
+
+	value := reflect.New(s.field.Type())
+	err := json.Unmarshal(b, value.Interface())
+	if err != nil {
+		return err
+	}
+	s.field.Set(value.Elem())
+	return nil
+}
+
+// isModel reports whether dest is a pointer to the model or to a slice of the model or of pointers to the model
+func (m *modelInfo) isModel(dest interface{}) bool {
+	t := reflect.TypeOf(dest)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return false
+	}
+
+	t = t.Elem()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	return t == m.elemType
+}
+
+// scanRow scans the current row into elem, an addressable model.
+// The fields are found by the column metadata of the model, so the embedded and the json fields are scanned.
+func (m *modelInfo) scanRow(rows *sqlx.Rows, columns []string, elem reflect.Value) error {
+	dests := make([]interface{}, len(columns))
+	for i, column := range columns {
+		if _, ok := m.fieldIndexes[column]; !ok {
+			return fmt.Errorf("missing destination name %s in %s", column, m.elemType)
+		}
+
+		field := m.field(elem, column)
+		if contains(m.jsonColumns, column) {
+			dests[i] = jsonScanner{field: field}
+		} else {
+			dests[i] = field.Addr().Interface()
+		}
+	}
+	return rows.Scan(dests...)
+}
+
+// scanOne scans the first row into elem, a pointer to the model, and closes the rows.
+// It returns sql.ErrNoRows when there is no row.
+func (m *modelInfo) scanOne(rows *sqlx.Rows, elem interface{}) error {
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	err = m.scanRow(rows, columns, reflect.ValueOf(elem).Elem())
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// scanAll scans the rows into elems, a pointer to a slice of the model or of pointers to the model,
+// and closes the rows
+func (m *modelInfo) scanAll(rows *sqlx.Rows, elems interface{}) error {
+	defer rows.Close()
+
+	datas := reflect.ValueOf(elems).Elem()
+	err := m.checkSlice(datas)
+	if err != nil {
+		return err
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	result := reflect.MakeSlice(datas.Type(), 0, 0)
+	for rows.Next() {
+		elem := reflect.New(m.elemType)
+		err = m.scanRow(rows, columns, elem.Elem())
+		if err != nil {
+			return err
+		}
+
+		if datas.Type().Elem().Kind() == reflect.Ptr {
+			result = reflect.Append(result, elem)
+		} else {
+			result = reflect.Append(result, elem.Elem())
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	datas.Set(result)
+	return nil
+}
@@ -0,0 +1,198 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// storages are the storages created by NewPostgresStorage, verified by VerifySchema
+var storages struct {
+	mu   sync.Mutex
+	list []*PostgresStorage
+}
+
+// SchemaIssue is a difference between the model of a storage and its table
+type SchemaIssue struct {
+	Table   string
+	Column  string
+	Message string
+}
+
+func (i SchemaIssue) String() string {
+	if i.Column == "" {
+		return fmt.Sprintf("%s: %s", i.Table, i.Message)
+	}
+	return fmt.Sprintf("%s.%s: %s", i.Table, i.Column, i.Message)
+}
+
+// tableColumn is a column of a table as described by the database
+type tableColumn struct {
+	Name     string `db:"column_name"`
+	DataType string `db:"data_type"`
+	Nullable bool   `db:"nullable"`
+}
+
+// register adds the storage to the storages verified by VerifySchema
+func register(r *PostgresStorage) {
+	storages.mu.Lock()
+	defer storages.mu.Unlock()
+	storages.list = append(storages.list, r)
+}
+
+// VerifySchema compares the columns of the models of every storage created by NewPostgresStorage
+// with the columns of their table in the primary database, and returns the missing tables and columns,
+// the columns whose type doesn't match the type of their field, and the nullable columns of the
+// fields that can't hold a null. It's meant to run at startup, so a renamed column isn't first
+// noticed by a failing request.
+func VerifySchema(ctx context.Context) ([]SchemaIssue, error) {
+	storages.mu.Lock()
+	list := append([]*PostgresStorage{}, storages.list...)
+	storages.mu.Unlock()
+
+	issues := []SchemaIssue{}
+	verified := map[string]bool{}
+	for _, r := range list {
+		key := fmt.Sprintf("%p %s %s", r.db, r.tableName, r.elemType)
+		if verified[key] {
+			continue
+		}
+		verified[key] = true
+
+		tableIssues, err := r.verifySchema(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("verify the schema of %s: %w", r.tableName, err)
+		}
+		issues = append(issues, tableIssues...)
+	}
+	return issues, nil
+}
+
+// verifySchema compares the columns of the model with the columns of the table
+func (r *PostgresStorage) verifySchema(ctx context.Context) ([]SchemaIssue, error) {
+	ctx, cancel := withOperation(ctx, OpSelect)
+	defer cancel()
+
+	query, args, err := sqlx.Named(r.dialect.Columns(), map[string]interface{}{"table": r.tableName})
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []*tableColumn{}
+	err = r.selectInto(ctx, r.db, &columns, r.db.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return []SchemaIssue{{Table: r.tableName, Message: "table is missing"}}, nil
+	}
+
+	byName := map[string]*tableColumn{}
+	for _, column := range columns {
+		byName[strings.ToLower(column.Name)] = column
+	}
+
+	issues := []SchemaIssue{}
+	for _, name := range r.columns {
+		column, ok := byName[strings.ToLower(name)]
+		if !ok {
+			issues = append(issues, SchemaIssue{Table: r.tableName, Column: name, Message: "column is missing"})
+			continue
+		}
+
+		fieldType := r.fieldType(name)
+		if !typeMatches(fieldType, column.DataType, contains(r.jsonColumns, name)) {
+			issues = append(issues, SchemaIssue{
+				Table:   r.tableName,
+				Column:  name,
+				Message: fmt.Sprintf("column type %s doesn't match the field type %s", column.DataType, fieldType),
+			})
+		}
+		if column.Nullable && name != r.pk && !nullable(fieldType) {
+			issues = append(issues, SchemaIssue{
+				Table:   r.tableName,
+				Column:  name,
+				Message: fmt.Sprintf("column is nullable but the field type %s can't hold a null", fieldType),
+			})
+		}
+	}
+	return issues, nil
+}
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+// the words of the column types of the databases matching a kind of field
+var (
+	intTypes    = []string{"int", "serial", "numeric", "decimal"}
+	floatTypes  = []string{"real", "double", "float", "numeric", "decimal"}
+	stringTypes = []string{"char", "text", "clob", "uuid", "enum", "citext", "user-defined"}
+	boolTypes   = []string{"bool", "bit", "tinyint", "int"}
+	jsonTypes   = []string{"json", "text", "char", "clob"}
+	timeTypes   = []string{"time", "date"}
+	bytesTypes  = []string{"bytea", "blob", "binary"}
+)
+
+// typeMatches reports whether the column type can be scanned into the field type,
+// the fields scanning themselves and the undeclared types of sqlite match any type
+func typeMatches(fieldType reflect.Type, dataType string, json bool) bool {
+	dataType = strings.ToLower(dataType)
+	if dataType == "" {
+		return true
+	}
+
+	if fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if reflect.PtrTo(fieldType).Implements(scannerType) {
+		return true
+	}
+
+	var words []string
+	switch {
+	case json:
+		words = jsonTypes
+	case fieldType == timeType:
+		words = timeTypes
+	case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Uint8:
+		words = bytesTypes
+	default:
+		switch fieldType.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			words = intTypes
+		case reflect.Float32, reflect.Float64:
+			words = floatTypes
+		case reflect.String:
+			words = stringTypes
+		case reflect.Bool:
+			words = boolTypes
+		default:
+			return true
+		}
+	}
+
+	for _, word := range words {
+		if strings.Contains(dataType, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// nullable reports whether the field type can hold a null
+func nullable(fieldType reflect.Type) bool {
+	switch fieldType.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return true
+	}
+	return reflect.PtrTo(fieldType).Implements(scannerType)
+}
@@ -0,0 +1,153 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+type schemaItem struct {
+	ID        int            `db:"id"`
+	Name      string         `db:"name"`
+	Score     float64        `db:"score"`
+	Active    bool           `db:"active"`
+	Note      *string        `db:"note"`
+	Settings  map[string]int `db:"settings,json"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+// resetStorages empties the storages verified by VerifySchema for the test and restores them afterwards
+func resetStorages(t *testing.T) {
+	t.Helper()
+
+	storages.mu.Lock()
+	saved := storages.list
+	storages.list = nil
+	storages.mu.Unlock()
+
+	t.Cleanup(func() {
+		storages.mu.Lock()
+		storages.list = saved
+		storages.mu.Unlock()
+	})
+}
+
+func TestVerifySchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   []string
+	}{
+		{
+			name: "matching table",
+			schema: `CREATE TABLE schema_item (id INTEGER PRIMARY KEY, name VARCHAR(100) NOT NULL, score REAL NOT NULL,
+				active BOOLEAN NOT NULL, note TEXT, settings TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+			want: []string{},
+		},
+		{
+			name:   "missing table",
+			schema: `CREATE TABLE other_item (id INTEGER PRIMARY KEY)`,
+			want:   []string{"schema_item: table is missing"},
+		},
+		{
+			name: "missing column",
+			schema: `CREATE TABLE schema_item (id INTEGER PRIMARY KEY, name VARCHAR(100) NOT NULL, score REAL NOT NULL,
+				active BOOLEAN NOT NULL, settings TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+			want: []string{"schema_item.note: column is missing"},
+		},
+		{
+			name: "mismatching types",
+			schema: `CREATE TABLE schema_item (id INTEGER PRIMARY KEY, name INT NOT NULL, score REAL NOT NULL,
+				active BOOLEAN NOT NULL, note TEXT, settings BLOB NOT NULL, created_at INT NOT NULL)`,
+			want: []string{
+				"schema_item.name: column type INT doesn't match the field type string",
+				"schema_item.settings: column type BLOB doesn't match the field type map[string]int",
+				"schema_item.created_at: column type INT doesn't match the field type time.Time",
+			},
+		},
+		{
+			name: "nullable column of a field that can't hold a null",
+			schema: `CREATE TABLE schema_item (id INTEGER PRIMARY KEY, name VARCHAR(100), score REAL NOT NULL,
+				active BOOLEAN NOT NULL, note TEXT, settings TEXT NOT NULL, created_at DATETIME NOT NULL)`,
+			want: []string{"schema_item.name: column is nullable but the field type string can't hold a null"},
+		},
+		{
+			name: "undeclared sqlite types match any field",
+			schema: `CREATE TABLE schema_item (id INTEGER PRIMARY KEY, name NOT NULL, score NOT NULL,
+				active NOT NULL, note, settings NOT NULL, created_at NOT NULL)`,
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetStorages(t)
+			NewPostgresStorage(openSQLite(t, tt.schema), "schema_item", schemaItem{})
+
+			issues, err := VerifySchema(context.Background())
+			if err != nil {
+				t.Fatalf("VerifySchema: %v", err)
+			}
+			got := []string{}
+			for _, issue := range issues {
+				got = append(got, issue.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("VerifySchema() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySchemaOnceADatabaseAndTable(t *testing.T) {
+	resetStorages(t)
+	db := openSQLite(t, `CREATE TABLE other_item (id INTEGER PRIMARY KEY)`)
+	NewPostgresStorage(db, "schema_item", schemaItem{})
+	NewPostgresStorage(db, "schema_item", schemaItem{})
+
+	issues, err := VerifySchema(context.Background())
+	if err != nil {
+		t.Fatalf("VerifySchema: %v", err)
+	}
+	if len(issues) != 1 {
+		t.Errorf("VerifySchema() = %v, want the missing table once", issues)
+	}
+}
+
+func TestTypeMatches(t *testing.T) {
+	tests := []struct {
+		field    interface{}
+		dataType string
+		json     bool
+		want     bool
+	}{
+		{0, "integer", false, true},
+		{0, "bigint", false, true},
+		{0, "character varying", false, false},
+		{"", "character varying", false, true},
+		{"", "uuid", false, true},
+		{"", "integer", false, false},
+		{1.5, "double precision", false, true},
+		{1.5, "numeric", false, true},
+		{true, "boolean", false, true},
+		{true, "tinyint", false, true},
+		{time.Time{}, "timestamp with time zone", false, true},
+		{time.Time{}, "integer", false, false},
+		{[]byte{}, "bytea", false, true},
+		{map[string]int{}, "jsonb", true, true},
+		{map[string]int{}, "integer", true, false},
+		{sql.NullString{}, "integer", false, true},
+		{new(int), "integer", false, true},
+		{0, "", false, true},
+	}
+
+	for _, tt := range tests {
+		fieldType := reflect.TypeOf(tt.field)
+		if got := typeMatches(fieldType, tt.dataType, tt.json); got != tt.want {
+			t.Errorf("typeMatches(%s, %q, json %v) = %v, want %v", fieldType, tt.dataType, tt.json, got, tt.want)
+		}
+	}
+}
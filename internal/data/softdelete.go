@@ -0,0 +1,175 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/riskibarqy/go-template/utils"
+)
+
+// deletedScope represents which rows of a soft deletable model are visible
+type deletedScope int
+
+const (
+	// scopeDefault hides the soft deleted rows
+	scopeDefault deletedScope = iota
+	// scopeWithDeleted shows every row
+	scopeWithDeleted
+	// scopeOnlyDeleted only shows the soft deleted rows
+	scopeOnlyDeleted
+)
+
+// WithDeleted makes the storage queries run with the context include the soft deleted rows
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey, scopeWithDeleted)
+}
+
+// OnlyDeleted makes the storage queries run with the context only return the soft deleted rows
+func OnlyDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey, scopeOnlyDeleted)
+}
+
+// withScope returns the context with the scope, the default scope keeps the scope of the context
+func withScope(ctx context.Context, scope deletedScope) context.Context {
+	if scope == scopeDefault {
+		return ctx
+	}
+	return context.WithValue(ctx, scopeKey, scope)
+}
+
+// scopeFromContext returns the deleted scope of the context
+func scopeFromContext(ctx context.Context) deletedScope {
+	scope, _ := ctx.Value(scopeKey).(deletedScope)
+	return scope
+}
+
+// scope returns the predicate hiding the rows that are out of the deleted scope
+// or that belong to another tenant than the one of the context, it's empty when every row is visible
+func (r *PostgresStorage) scope(ctx context.Context) string {
+	predicates := []string{}
+	if deleted := r.deletedPredicate(ctx); deleted != "" {
+		predicates = append(predicates, deleted)
+	}
+	if tenant := r.tenantPredicate(ctx); tenant != "" {
+		predicates = append(predicates, tenant)
+	}
+	return strings.Join(predicates, " AND ")
+}
+
+// deletedPredicate returns the predicate hiding the rows that are out of the deleted scope of the context
+func (r *PostgresStorage) deletedPredicate(ctx context.Context) string {
+	if !r.softDelete {
+		return ""
+	}
+
+	switch scopeFromContext(ctx) {
+	case scopeWithDeleted:
+		return ""
+	case scopeOnlyDeleted:
+		return fmt.Sprintf(`%s IS NOT NULL`, r.quote(softDeleteColumn))
+	default:
+		return fmt.Sprintf(`%s IS NULL`, r.quote(softDeleteColumn))
+	}
+}
+
+// andScope returns the scope predicate prefixed with AND, to be appended to a WHERE clause
+func (r *PostgresStorage) andScope(ctx context.Context) string {
+	scope := r.scope(ctx)
+	if scope == "" {
+		return ""
+	}
+	return " AND " + scope
+}
+
+// from returns the source of the select queries,
+// it's the table itself or a subquery of the table limited to the rows in scope.
+// The subquery is aliased with the table name so the WHERE clause given by the caller,
+// including its ORDER BY and LIMIT, is applied as is.
+func (r *PostgresStorage) from(ctx context.Context) string {
+	table := r.quote(r.tableName)
+	scope := r.scope(ctx)
+	if scope == "" {
+		return table
+	}
+	return fmt.Sprintf(`(SELECT * FROM %s WHERE %s) AS %s`, table, scope, table)
+}
+
+// Restore restores the soft deleted element by its id.
+// It returns ErrNotFound when there is no soft deleted element with the id.
+func (r *PostgresStorage) Restore(ctx context.Context, id interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.restore(ctx, id)
+	})
+}
+
+// restore restores the soft deleted element within the transaction of the context, if any
+func (r *PostgresStorage) restore(ctx context.Context, id interface{}) error {
+	ctx, cancel := withOperation(ctx, OpUpdate)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	if !r.softDelete {
+		return fmt.Errorf("%s is not soft deletable", r.tableName)
+	}
+
+	existingElem, err := r.audited(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.execNamed(ctx, db, fmt.Sprintf(`UPDATE %s SET %s = NULL WHERE %s AND %s IS NOT NULL%s`,
+		r.quote(r.tableName), r.quote(softDeleteColumn), r.idWhere(), r.quote(softDeleteColumn), r.andTenant(ctx)), map[string]interface{}{
+		r.pk: id,
+	})
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	if !existingElem.IsValid() {
+		return nil
+	}
+
+	restoredElem, err := r.withDeletedAt(existingElem, nil)
+	if err != nil {
+		return err
+	}
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditRestore, existingElem, restoredElem)
+}
+
+// Purge hard deletes the elements that were soft deleted longer than the retention ago
+// using DeleteHard, and returns the number of purged elements.
+// Run it inside Manager.RunInTransaction to purge all or nothing.
+func (r *PostgresStorage) Purge(ctx context.Context, retention time.Duration) (int, error) {
+	if !r.softDelete {
+		return 0, fmt.Errorf("%s is not soft deletable", r.tableName)
+	}
+
+	// the query selects the soft deleted rows of the tenant of the context itself
+	ids := []interface{}{}
+	err := r.SelectWithQuery(WithoutTenant(WithDeleted(WithPrimary(ctx))), &ids, fmt.Sprintf(`SELECT %s FROM %s WHERE %s < :before%s`,
+		r.quote(r.pk), r.quote(r.tableName), r.quote(softDeleteColumn), r.andTenant(ctx)), map[string]interface{}{
+		"before": utils.Now() - int(retention.Seconds()),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		err = r.DeleteHard(ctx, id)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(ids), nil
+}
@@ -3,18 +3,19 @@ package data
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/riskibarqy/go-template/utils"
 )
 
-// ErrNotEnough declare specific error for Not Enough
-// ErrExisted declare specific error for data already exist
+// ErrNotFound is returned when no data matches the query,
+// ErrAlreadyExist when the data violates a unique constraint, see ConstraintError
 var (
 	ErrNotFound     = fmt.Errorf("data is not found")
 	ErrAlreadyExist = fmt.Errorf("data already exists")
@@ -25,43 +26,180 @@ var (
 type GenericStorage interface {
 	Single(ctx context.Context, elem interface{}, where string, arg map[string]interface{}) error
 	Where(ctx context.Context, elems interface{}, where string, arg map[string]interface{}) error
+	SingleQuery(ctx context.Context, elem interface{}, q *Query) error
+	WhereQuery(ctx context.Context, elems interface{}, q *Query) error
+	Count(ctx context.Context, where string, arg map[string]interface{}) (int, error)
+	FindPage(ctx context.Context, elems interface{}, q *Query) (int, error)
+	FindCursor(ctx context.Context, elems interface{}, q *Query) (string, error)
+	Each(ctx context.Context, q *Query, fn func(elem interface{}) error) error
+	CountQuery(ctx context.Context, q *Query) (int, error)
 	SelectWithQuery(ctx context.Context, elem interface{}, query string, args map[string]interface{}) error
 	FindByID(ctx context.Context, elem interface{}, id interface{}) error
 	FindAll(ctx context.Context, elems interface{}, page int, limit int) error
 	Insert(ctx context.Context, elem interface{}) error
-	// InsertMany(ctx context.Context, elem interface{}) error
+	InsertMany(ctx context.Context, elems interface{}) error
+	Upsert(ctx context.Context, elems interface{}, conflictColumns []string, updateColumns []string) error
 	Update(ctx context.Context, elem interface{}) error
+	UpdateFields(ctx context.Context, elem interface{}, columns ...string) error
+	UpdateWhere(ctx context.Context, set map[string]interface{}, where string, arg map[string]interface{}) (int, error)
 	Delete(ctx context.Context, id interface{}) error
 	DeleteHard(ctx context.Context, id interface{}) error
+	Restore(ctx context.Context, id interface{}) error
+	Purge(ctx context.Context, retention time.Duration) (int, error)
 }
 
-// PostgresStorage is the postgres implementation of generic Storage
+// PostgresStorage is the SQL implementation of generic Storage.
+// It's named after postgres, its default dialect, and runs on every Dialect.
 type PostgresStorage struct {
-	db              Queryer
-	tableName       string
-	elemType        reflect.Type
+	*modelInfo
+	// db is the primary, a database rather than a Queryer so hooked can start its transactions
+	db        *sqlx.DB
+	replicas  *ReplicaSet
+	tableName string
+	dialect   Dialect
+	auditor   *Auditor
+	metrics   *QueryMetrics
+
+	// the column lists quoted with the dialect
 	selectFields    string
 	insertFields    string
-	insertParams    string
 	updateSetFields string
 }
 
-// Single queries an element according to the query & argument provided
-func (r *PostgresStorage) Single(ctx context.Context, elem interface{}, where string, arg map[string]interface{}) error {
-	db := r.db
+// SetDialect sets the dialect of the storage,
+// it's otherwise chosen from the driver of the database given to NewPostgresStorage
+func (r *PostgresStorage) SetDialect(dialect Dialect) *PostgresStorage {
+	r.dialect = dialect
+	r.selectFields = selectFields(r.modelInfo, dialect)
+	r.insertFields = insertFields(r.modelInfo, dialect)
+	r.updateSetFields = updateSetFields(r.modelInfo, dialect)
+	return r
+}
+
+// quote quotes the identifier with the dialect of the storage
+func (r *PostgresStorage) quote(identifier string) string {
+	return r.dialect.Quote(identifier)
+}
+
+// idWhere is the predicate selecting a row by its primary key, the key is bound to the parameter named after it
+func (r *PostgresStorage) idWhere() string {
+	return fmt.Sprintf(`%s = :%s`, r.quote(r.pk), r.pk)
+}
+
+// SetReplicas routes the read queries of the storage to the replicas,
+// except the ones inside a transaction or with a WithPrimary context
+func (r *PostgresStorage) SetReplicas(replicas *ReplicaSet) *PostgresStorage {
+	r.replicas = replicas
+	return r
+}
+
+// SetMetrics records the queries of the storage with the metrics, labeled with the table of the storage
+func (r *PostgresStorage) SetMetrics(metrics *QueryMetrics) *PostgresStorage {
+	r.metrics = metrics
+	return r
+}
+
+// reader returns the queryer of the read queries
+func (r *PostgresStorage) reader(ctx context.Context) Queryer {
+	return r.metrics.Instrument(r.source(ctx), r.tableName)
+}
+
+// source returns the database of the read queries: the transaction of the context,
+// a healthy replica unless the context is WithPrimary, or the primary
+func (r *PostgresStorage) source(ctx context.Context) Queryer {
 	tx, ok := TxFromContext(ctx)
 	if ok {
-		db = tx
+		return tx
 	}
 
-	statement, err := db.PrepareNamed(fmt.Sprintf(`SELECT %s FROM "%s" WHERE %s`,
-		r.selectFields, r.tableName, where))
+	if !primaryFromContext(ctx) {
+		replica := r.replicas.pick()
+		if replica != nil {
+			return replica
+		}
+	}
+
+	return r.db
+}
+
+// writer returns the queryer of the write queries, the transaction of the context or the primary
+func (r *PostgresStorage) writer(ctx context.Context) Queryer {
+	tx, ok := TxFromContext(ctx)
+	if ok {
+		return r.metrics.Instrument(tx, r.tableName)
+	}
+
+	return r.metrics.Instrument(r.db, r.tableName)
+}
+
+// get runs the query and scans its first row into elem, it returns sql.ErrNoRows when there is no row.
+// The models are scanned with their column metadata, the other destinations by sqlx.
+func (r *PostgresStorage) get(ctx context.Context, db Queryer, elem interface{}, query string, args ...interface{}) error {
+	if !r.isModel(elem) {
+		return r.translateError(db.GetContext(ctx, elem, query, args...))
+	}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return r.translateError(err)
+	}
+	return r.translateError(r.scanOne(rows, elem))
+}
+
+// getNamed runs the named query as get
+func (r *PostgresStorage) getNamed(ctx context.Context, db Queryer, elem interface{}, query string, arg map[string]interface{}) error {
+	query, args, err := sqlx.Named(query, arg)
 	if err != nil {
 		return err
 	}
-	defer statement.Close()
+	return r.get(ctx, db, elem, db.Rebind(query), args...)
+}
+
+// execNamed runs the named statement
+func (r *PostgresStorage) execNamed(ctx context.Context, db Queryer, query string, arg map[string]interface{}) (sql.Result, error) {
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	result, err := db.ExecContext(ctx, db.Rebind(query), args...)
+	return result, r.translateError(err)
+}
 
-	err = statement.Get(elem, arg)
+// selectInto runs the query and scans its rows into elems as get
+func (r *PostgresStorage) selectInto(ctx context.Context, db Queryer, elems interface{}, query string, args ...interface{}) error {
+	if !r.isModel(elems) {
+		return r.translateError(db.SelectContext(ctx, elems, query, args...))
+	}
+
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return r.translateError(err)
+	}
+	return r.translateError(r.scanAll(rows, elems))
+}
+
+// Single queries an element according to the query & argument provided
+// The soft deleted elements are hidden unless the context is WithDeleted or OnlyDeleted
+func (r *PostgresStorage) Single(ctx context.Context, elem interface{}, where string, arg map[string]interface{}) error {
+	ctx, cancel := withOperation(ctx, OpSingle)
+	defer cancel()
+
+	db := r.reader(ctx)
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, r.selectFields, r.from(ctx), where)
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+
+	query = db.Rebind(query)
+
+	err = r.get(ctx, db, elem, query, args...)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrNotFound
@@ -73,14 +211,14 @@ func (r *PostgresStorage) Single(ctx context.Context, elem interface{}, where st
 }
 
 // Where queries the elements according to the query & argument provided
+// The soft deleted elements are hidden unless the context is WithDeleted or OnlyDeleted
 func (r *PostgresStorage) Where(ctx context.Context, elems interface{}, where string, arg map[string]interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
-	}
+	ctx, cancel := withOperation(ctx, OpWhere)
+	defer cancel()
+
+	db := r.reader(ctx)
 
-	query := fmt.Sprintf(`SELECT %s FROM "%s" WHERE %s`, r.selectFields, r.tableName, where)
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s`, r.selectFields, r.from(ctx), where)
 	query, args, err := sqlx.Named(query, arg)
 	if err != nil {
 		return err
@@ -93,7 +231,7 @@ func (r *PostgresStorage) Where(ctx context.Context, elems interface{}, where st
 
 	query = db.Rebind(query)
 
-	err = db.Select(elems, query, args...)
+	err = r.selectInto(ctx, db, elems, query, args...)
 	if err != nil {
 		return err
 	}
@@ -101,14 +239,133 @@ func (r *PostgresStorage) Where(ctx context.Context, elems interface{}, where st
 	return nil
 }
 
+// SingleQuery queries an element according to the structured query
+func (r *PostgresStorage) SingleQuery(ctx context.Context, elem interface{}, q *Query) error {
+	where, tail, args, err := q.compile(r.dialect, r.modelInfo)
+	if err != nil {
+		return err
+	}
+
+	return r.Single(withScope(ctx, q.deleted), elem, strings.TrimSpace(where+" "+tail), args)
+}
+
+// WhereQuery queries the elements according to the structured query
+func (r *PostgresStorage) WhereQuery(ctx context.Context, elems interface{}, q *Query) error {
+	where, tail, args, err := q.compile(r.dialect, r.modelInfo)
+	if err != nil {
+		return err
+	}
+
+	return r.Where(withScope(ctx, q.deleted), elems, strings.TrimSpace(where+" "+tail), args)
+}
+
+// Count counts the elements matching the query & argument provided
+func (r *PostgresStorage) Count(ctx context.Context, where string, arg map[string]interface{}) (int, error) {
+	ctx, cancel := withOperation(ctx, OpCount)
+	defer cancel()
+
+	db := r.reader(ctx)
+
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, r.from(ctx), where)
+	query, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	query = db.Rebind(query)
+
+	var count int
+	err = db.GetContext(ctx, &count, query, args...)
+	if err != nil {
+		return 0, r.translateError(err)
+	}
+
+	return count, nil
+}
+
+// FindPage queries a page of elements according to the structured query
+// and returns the total number of elements matching the query regardless of its limit & offset
+func (r *PostgresStorage) FindPage(ctx context.Context, elems interface{}, q *Query) (int, error) {
+	where, tail, args, err := q.compile(r.dialect, r.modelInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = withScope(ctx, q.deleted)
+	err = r.Where(ctx, elems, strings.TrimSpace(where+" "+tail), args)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Count(ctx, where, args)
+}
+
+// CountQuery counts the elements matching the conditions of the structured query,
+// its ordering, limit, offset and cursor are ignored
+func (r *PostgresStorage) CountQuery(ctx context.Context, q *Query) (int, error) {
+	cq := NewQuery(q.conditions...)
+	cq.deleted = q.deleted
+
+	where, _, args, err := cq.compile(r.dialect, r.modelInfo)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.Count(withScope(ctx, q.deleted), where, args)
+}
+
+// FindCursor queries a keyset page of elements according to the structured query,
+// starting after the cursor given to Query.After.
+// It returns the cursor of the next page, or an empty string when it's the last page.
+func (r *PostgresStorage) FindCursor(ctx context.Context, elems interface{}, q *Query) (string, error) {
+	cq := *q
+	cq.keyset = true
+	if q.limit > 0 {
+		// fetch one more element to know whether there is a next page
+		cq.limit = q.limit + 1
+	}
+
+	err := r.WhereQuery(ctx, elems, &cq)
+	if err != nil {
+		return "", err
+	}
+
+	datas := reflect.Indirect(reflect.ValueOf(elems))
+	if q.limit <= 0 || datas.Len() <= q.limit {
+		return "", nil
+	}
+
+	datas.Set(datas.Slice(0, q.limit))
+	last := datas.Index(q.limit - 1)
+	key := q.keysetOrder(r.pk)
+	return encodeCursor(key, r.value(last, key.column), r.value(last, r.pk))
+}
+
+// ErrUnscopedQuery is returned by SelectWithQuery when the context doesn't opt out of the scopes of the model
+var ErrUnscopedQuery = fmt.Errorf("query can't be scoped")
+
 // SelectWithQuery Customizable Query for Select
+// The query is run as is, it can't be limited to the tenant and the deleted scope of the context.
+// The caller opts out of them explicitly: the context must be WithoutTenant when the model has a tenant column,
+// and WithDeleted or OnlyDeleted when it's soft deletable, ErrUnscopedQuery is returned otherwise.
 func (r *PostgresStorage) SelectWithQuery(ctx context.Context, elems interface{}, query string, arg map[string]interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
+	if r.tenantColumn != "" && !withoutTenantFromContext(ctx) {
+		return fmt.Errorf("%w: the query of %s must run WithoutTenant", ErrUnscopedQuery, r.tableName)
+	}
+	if r.softDelete && scopeFromContext(ctx) == scopeDefault {
+		return fmt.Errorf("%w: the query of %s must run WithDeleted or OnlyDeleted", ErrUnscopedQuery, r.tableName)
 	}
 
+	ctx, cancel := withOperation(ctx, OpSelect)
+	defer cancel()
+
+	db := r.reader(ctx)
+
 	query, args, err := sqlx.Named(query, arg)
 	if err != nil {
 		return err
@@ -121,7 +378,7 @@ func (r *PostgresStorage) SelectWithQuery(ctx context.Context, elems interface{}
 
 	query = db.Rebind(query)
 
-	err = db.Select(elems, query, args...)
+	err = r.selectInto(ctx, db, elems, query, args...)
 	if err != nil {
 		return err
 	}
@@ -129,13 +386,10 @@ func (r *PostgresStorage) SelectWithQuery(ctx context.Context, elems interface{}
 	return nil
 }
 
-// FindByID finds an element by its id
-// it's defined in this project context that
-// the element id column in the db should be "id"
+// FindByID finds an element by its id, the value of its primary key column
 func (r *PostgresStorage) FindByID(ctx context.Context, elem interface{}, id interface{}) error {
-	where := `"id" = :id`
-	err := r.Single(ctx, elem, where, map[string]interface{}{
-		"id": id,
+	err := r.Single(ctx, elem, r.idWhere(), map[string]interface{}{
+		r.pk: id,
 	})
 	if err != nil {
 		return err
@@ -147,7 +401,7 @@ func (r *PostgresStorage) FindByID(ctx context.Context, elem interface{}, id int
 // FindAll finds all elements from the database.
 func (r *PostgresStorage) FindAll(ctx context.Context, elems interface{}, page int, limit int) error {
 	where := `true`
-	where = fmt.Sprintf(`%s ORDER BY "id" DESC LIMIT :limit OFFSET :offset`, where)
+	where = fmt.Sprintf(`%s ORDER BY %s DESC LIMIT :limit OFFSET :offset`, where, r.quote(r.pk))
 
 	err := r.Where(ctx, elems, where, map[string]interface{}{
 		"limit":  limit,
@@ -162,127 +416,399 @@ func (r *PostgresStorage) FindAll(ctx context.Context, elems interface{}, page i
 }
 
 // Insert inserts a new element into the database.
-// It assumes the primary key of the table is "id" with serial type.
-// It will set the "owner" field of the element with the current account in the context if exists.
-// It will set the "createdAt" and "updatedAt" fields with current time.
-// If immutable set true, it won't insert the updatedAt
+// The primary key is generated by the database unless the model tags it with the pk option, see modelInfo.
+// It will set the "owner" field of the element with the owner in the context if exists.
+// It will set the tenant column of the element with the client of the context, see WithoutTenant.
+// It will set the "createdAt" and "updatedAt" fields with current time when they're zero.
+// The insert hooks of the element run within the transaction of the insert.
+// When the dialect doesn't support RETURNING, the inserted row is read back by its last insert id.
 func (r *PostgresStorage) Insert(ctx context.Context, elem interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+
+	return r.hooked(ctx, func(ctx context.Context) error {
+		v := reflect.ValueOf(elem).Elem()
+		err := r.beforeInsert(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.insert(ctx, elem)
+		if err != nil {
+			return err
+		}
+
+		return r.afterInsert(ctx, v)
+	})
+}
+
+// insert inserts the element without running its hooks
+func (r *PostgresStorage) insert(ctx context.Context, elem interface{}) error {
+	ctx, cancel := withOperation(ctx, OpInsert)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
 	}
 
 	query := fmt.Sprintf(`
-	INSERT INTO "%s"(%s)
-	VALUES (%s)
-	RETURNING %s`, r.tableName, r.insertFields, r.insertParams, r.selectFields)
-	statement, err := db.PrepareNamed(query)
+	INSERT INTO %s(%s)
+	VALUES (%s)`, r.quote(r.tableName), r.insertFields, r.insertParams)
+	if !r.dialect.Returning() {
+		err = r.insertOne(ctx, db, query, r.insertArgs(elem, 0), elem)
+		if err != nil {
+			return err
+		}
+		return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditInsert, reflect.Value{}, reflect.ValueOf(elem).Elem())
+	}
+
+	err = r.getNamed(ctx, db, elem, query+" RETURNING "+r.selectFields, r.insertArgs(elem, 0))
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditInsert, reflect.Value{}, reflect.ValueOf(elem).Elem())
+}
+
+// insertOne runs the INSERT of a dialect without RETURNING, then reads the inserted row back into elem
+// by its last insert id, or by its primary key when it's not generated
+func (r *PostgresStorage) insertOne(ctx context.Context, db Queryer, query string, dbArgs map[string]interface{}, elem interface{}) error {
+	query, args, err := sqlx.Named(query, dbArgs)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.ExecContext(ctx, db.Rebind(query), args...)
+	if err != nil {
+		return r.translateError(err)
+	}
+
+	id := r.value(reflect.ValueOf(elem), r.pk)
+	if !contains(r.insertable, r.pk) {
+		id, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.FindByID(WithDeleted(WithPrimary(ctx)), elem, id)
+}
+
+// InsertMany inserts the elements into the database using multi-row INSERT statements.
+// elems must be a slice, or a pointer to a slice, of the model or of pointers to the model.
+// The elements are split into batches that stay under the postgres bind parameter limit,
+// so run it inside Manager.RunInTransaction when all the batches must be stored atomically.
+// The stored rows, including the generated ids, are written back into elems.
+// The elements are stamped and their insert hooks run as in Insert.
+func (r *PostgresStorage) InsertMany(ctx context.Context, elems interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.eachElem(elems, func(elem reflect.Value) error {
+			return r.beforeInsert(ctx, elem)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = r.insertMany(ctx, elems)
+		if err != nil {
+			return err
+		}
+
+		return r.eachElem(elems, func(elem reflect.Value) error {
+			return r.afterInsert(ctx, elem)
+		})
+	})
+}
+
+// insertMany inserts the elements without running their hooks
+func (r *PostgresStorage) insertMany(ctx context.Context, elems interface{}) error {
+	db := r.writer(ctx)
+
+	err := r.insertBatches(ctx, db, reflect.Indirect(reflect.ValueOf(elems)), "", nil)
+	if err != nil {
+		return err
+	}
+
+	return r.auditor.recordEach(ctx, r.modelInfo, r.tableName, AuditInsert, elems)
+}
+
+// Upsert inserts the elements, or updates the existing rows when they conflict on the conflictColumns.
+// elems is either a pointer to a single model or a slice of the model as accepted by InsertMany.
+// The updateColumns are overwritten with the new values on conflict, when it is empty
+// every inserted column except the conflict columns is overwritten. When no column is left to overwrite,
+// e.g. every inserted column is a conflict column, the conflicting rows are left as is,
+// postgres and sqlite don't return them so their elements are not written back.
+// A single batch must not contain two elements with the same conflict key.
+// The stored rows, including the generated ids, are written back into elems.
+// The elements are stamped and their insert hooks run as in Insert, whether they're inserted or updated,
+// the created_at column is only overwritten when it's one of the updateColumns.
+func (r *PostgresStorage) Upsert(ctx context.Context, elems interface{}, conflictColumns []string, updateColumns []string) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		err := r.eachElem(elems, func(elem reflect.Value) error {
+			return r.beforeInsert(ctx, elem)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = r.upsert(ctx, elems, conflictColumns, updateColumns)
+		if err != nil {
+			return err
+		}
+
+		return r.eachElem(elems, func(elem reflect.Value) error {
+			return r.afterInsert(ctx, elem)
+		})
+	})
+}
+
+// upsert upserts the elements without running their hooks
+func (r *PostgresStorage) upsert(ctx context.Context, elems interface{}, conflictColumns []string, updateColumns []string) error {
+	db := r.writer(ctx)
+
+	if len(conflictColumns) == 0 {
+		return fmt.Errorf("upsert into %s needs at least one conflict column", r.tableName)
+	}
+	err := r.checkConflictTenant(ctx, conflictColumns)
+	if err != nil {
+		return err
+	}
+
+	conflicts := []string{}
+	for _, column := range conflictColumns {
+		if !r.hasColumn(column) {
+			return fmt.Errorf("unknown conflict column %q for %s", column, r.tableName)
+		}
+		conflicts = append(conflicts, r.quote(column))
+	}
+
+	if len(updateColumns) == 0 {
+		for _, column := range r.updatable {
+			if column != createdAtColumn && !contains(conflictColumns, column) {
+				updateColumns = append(updateColumns, column)
+			}
+		}
+	}
+
+	sets := []string{}
+	for _, column := range updateColumns {
+		if !contains(r.updatable, column) {
+			return fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+		if column == r.lockColumn {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf(`%s = %s`, r.quote(column), r.dialect.Excluded(column)))
+	}
+	// without column to update the conflicting rows are left as is, see Dialect.OnConflict
+	if r.lockColumn != "" && len(sets) > 0 {
+		// an updated row moves to its next version
+		sets = append(sets, fmt.Sprintf(`%s = %s.%s + 1`, r.quote(r.lockColumn), r.quote(r.tableName), r.quote(r.lockColumn)))
+	}
+
+	suffix := r.dialect.OnConflict(r.quote(r.pk), conflicts, sets)
+
+	datas := reflect.ValueOf(elems)
+	if datas.Kind() == reflect.Ptr && datas.Elem().Kind() == reflect.Struct {
+		datas = reflect.Append(reflect.MakeSlice(reflect.SliceOf(datas.Type()), 0, 1), datas)
+	}
+
+	err = r.insertBatches(ctx, db, reflect.Indirect(datas), suffix, conflictColumns)
 	if err != nil {
 		return err
 	}
-	defer statement.Close()
 
-	dbArgs := r.insertArgs(elem, 0)
-	err = statement.Get(elem, dbArgs)
+	// the previous values of the updated rows are unknown, the upserts are recorded with their new values
+	return r.auditor.recordEach(ctx, r.modelInfo, r.tableName, AuditUpsert, elems)
+}
+
+// insertBatches splits the datas into batches that stay under the bind parameter limit and inserts them.
+// The keyColumns identify the returned rows, see insertBatch.
+func (r *PostgresStorage) insertBatches(ctx context.Context, db Queryer, datas reflect.Value, suffix string, keyColumns []string) error {
+	err := r.checkSlice(datas)
 	if err != nil {
 		return err
 	}
 
+	// one more column for the primary key allocated by insertBatch
+	limit := r.dialect.MaxBindParams() / (len(r.insertable) + 1)
+	for start := 0; start < datas.Len(); start += limit {
+		end := start + limit
+		if end > datas.Len() {
+			end = datas.Len()
+		}
+
+		err := r.insertBatch(ctx, db, datas.Slice(start, end), suffix, keyColumns)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// // InsertMany is function for creating many datas into specific table in database.
-// func (r *PostgresStorage) InsertMany(ctx context.Context, elem interface{}) error {
-// 	currentAccount := appcontext.CurrentAccount(ctx)
-// 	db := r.db
-// 	tx, ok := TxFromContext(ctx)
-// 	if ok {
-// 		db = tx
-// 	}
-
-// 	sqlStr := fmt.Sprintf(`
-// 	INSERT INTO "%s"(%s)
-// 	VALUES `, r.tableName, r.insertFields)
-
-// 	var dbArgs map[string]interface{}
-
-// 	datas := reflect.ValueOf(elem)
-
-// 	insertFields := strings.Split(r.insertFields, ",")
-// 	limit := 60000 / len(insertFields)
-// 	indexData := 0
-// 	if datas.Kind() == reflect.Slice {
-// 		for i := 0; i < datas.Len(); i++ {
-// 			sqlStr += fmt.Sprintf("(%s),", insertParams(r.elemType, r.isImmutable, i+1))
-// 			arg := r.insertArgs(currentAccount, 0, datas.Index(i), i+1)
-// 			if indexData == 0 {
-// 				dbArgs = arg
-// 			} else {
-// 				for k, v := range arg {
-// 					dbArgs[k] = v
-// 				}
-// 			}
-// 			indexData++
-// 			if indexData == limit {
-// 				err := r.insertData(ctx, sqlStr, dbArgs)
-// 				if err != nil {
-// 					return err
-// 				}
-
-// 				indexData = 0
-// 				sqlStr = fmt.Sprintf(`
-// 				INSERT INTO "%s"(%s)
-// 				VALUES `, r.tableName, r.insertFields)
-// 				dbArgs = map[string]interface{}{}
-// 			}
-// 		}
-// 	}
-
-// 	if datas.Kind() == reflect.Map {
-// 		for key, element := range datas.MapKeys() {
-// 			sqlStr += fmt.Sprintf("(%s),", insertParams(r.elemType, r.isImmutable, key+1))
-// 			arg := r.insertArgs(currentAccount, currentUserID, datas.MapIndex(element), key+1)
-// 			if indexData == 0 {
-// 				dbArgs = arg
-// 			} else {
-// 				for k, v := range arg {
-// 					dbArgs[k] = v
-// 				}
-// 			}
-// 			indexData++
-// 			if indexData == limit {
-// 				err := r.insertData(ctx, sqlStr, dbArgs)
-// 				if err != nil {
-// 					return err
-// 				}
-
-// 				indexData = 0
-// 				sqlStr = fmt.Sprintf(`
-// 				INSERT INTO "%s"(%s)
-// 				VALUES `, r.tableName, r.insertFields)
-// 				dbArgs = map[string]interface{}{}
-// 			}
-// 		}
-// 	}
-
-// 	sqlStr = strings.TrimSuffix(sqlStr, ",")
-
-// 	statement, err := db.PrepareNamed(sqlStr)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	defer statement.Close()
-
-// 	_, err = statement.Exec(dbArgs)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	return nil
-// }
+// insertBatch inserts the datas in a single statement, the suffix is appended after the VALUES list.
+// It writes the returned rows back into datas. The order of the rows returned by a multi-row insert
+// is not defined, so they're matched to the datas by the keyColumns, or by their primary key when
+// there is none. A generated primary key is allocated from its sequence before the insert to be known,
+// the datas are inserted one by one when the database has no sequence for it.
+// The datas whose row isn't returned, e.g. skipped by ON CONFLICT DO NOTHING, are left as is.
+// When the dialect doesn't support RETURNING, the datas are inserted one by one to read back their ids.
+func (r *PostgresStorage) insertBatch(ctx context.Context, db Queryer, datas reflect.Value, suffix string, keyColumns []string) error {
+	ctx, cancel := withOperation(ctx, OpInsert)
+	defer cancel()
+
+	if datas.Len() == 0 {
+		return nil
+	}
+	for i := 0; i < datas.Len(); i++ {
+		if data := datas.Index(i); data.Kind() == reflect.Ptr && data.IsNil() {
+			return fmt.Errorf("cannot insert nil element at index %d", i)
+		}
+	}
+
+	if !r.dialect.Returning() {
+		return r.insertEach(ctx, db, datas, suffix)
+	}
+
+	columns := r.insertable
+	if len(keyColumns) == 0 {
+		keyColumns = []string{r.pk}
+		if !contains(r.insertable, r.pk) {
+			allocated, err := r.allocateIDs(ctx, db, datas)
+			if err != nil {
+				return err
+			}
+			if !allocated {
+				return r.insertEach(ctx, db, datas, suffix)
+			}
+			columns = append([]string{r.pk}, r.insertable...)
+		}
+	}
+
+	values := []string{}
+	dbArgs := map[string]interface{}{}
+	for i := 0; i < datas.Len(); i++ {
+		values = append(values, fmt.Sprintf("(%s)", columnParams(columns, i+1)))
+		for k, v := range r.columnArgs(datas.Index(i), columns, i+1) {
+			dbArgs[k] = v
+		}
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO %s(%s)
+	VALUES %s %s
+	RETURNING %s`, r.quote(r.tableName), quoteColumns(columns, r.dialect), strings.Join(values, ","), suffix, r.selectFields)
+	query, args, err := sqlx.Named(query, dbArgs)
+	if err != nil {
+		return err
+	}
+
+	query = db.Rebind(query)
+
+	results := reflect.New(reflect.SliceOf(r.elemType))
+	err = r.selectInto(ctx, db, results.Interface(), query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows := map[string]reflect.Value{}
+	for i := 0; i < results.Elem().Len(); i++ {
+		row := results.Elem().Index(i)
+		rows[r.rowKey(row, keyColumns)] = row
+	}
+	for i := 0; i < datas.Len(); i++ {
+		data := reflect.Indirect(datas.Index(i))
+		if row, ok := rows[r.rowKey(data, keyColumns)]; ok {
+			data.Set(row)
+		}
+	}
+
+	return nil
+}
+
+// insertEach inserts the datas one by one, reading back each inserted row
+func (r *PostgresStorage) insertEach(ctx context.Context, db Queryer, datas reflect.Value, suffix string) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %s(%s)
+	VALUES (%s) %s`, r.quote(r.tableName), r.insertFields, r.insertParams, suffix)
+	for i := 0; i < datas.Len(); i++ {
+		data := datas.Index(i)
+		elem := reflect.Indirect(data).Addr().Interface()
+
+		var err error
+		if r.dialect.Returning() {
+			err = r.getNamed(ctx, db, elem, query+" RETURNING "+r.selectFields, r.insertArgs(data, 0))
+		} else {
+			err = r.insertOne(ctx, db, query, r.insertArgs(data, 0), elem)
+		}
+		// a row skipped by ON CONFLICT DO NOTHING returns nothing
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocateIDs sets the generated primary key of the datas to new values of its sequence.
+// It reports false when the database has no sequence for the primary key.
+func (r *PostgresStorage) allocateIDs(ctx context.Context, db Queryer, datas reflect.Value) (bool, error) {
+	query := r.dialect.NextIDs()
+	if query == "" {
+		return false, nil
+	}
+
+	query, args, err := sqlx.Named(query, map[string]interface{}{
+		"table": r.quote(r.tableName),
+		"pk":    r.pk,
+		"count": datas.Len(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ids := []sql.NullInt64{}
+	err = r.selectInto(ctx, db, &ids, db.Rebind(query), args...)
+	if err != nil {
+		return false, err
+	}
+	// the primary key is generated by something else than a sequence, e.g. a uuid default
+	if len(ids) != datas.Len() || !ids[0].Valid {
+		return false, nil
+	}
+
+	for i, id := range ids {
+		err = setValue(r.field(datas.Index(i), r.pk), id.Int64)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// rowKey returns the key identifying the row by the values of the columns
+func (r *PostgresStorage) rowKey(row reflect.Value, columns []string) string {
+	values := []string{}
+	for _, column := range columns {
+		values = append(values, fmt.Sprintf("%v", normalize(r.value(row, column))))
+	}
+	return strings.Join(values, "\x00")
+}
 
 func (r *PostgresStorage) insertArgs(elem interface{}, index int) map[string]interface{} {
+	return r.columnArgs(elem, r.insertable, index)
+}
+
+// columnArgs returns the named arguments of the columns of the element, suffixed with the index when it's not zero
+func (r *PostgresStorage) columnArgs(elem interface{}, columns []string, index int) map[string]interface{} {
 	res := map[string]interface{}{}
 
 	var v reflect.Value
@@ -294,27 +820,17 @@ func (r *PostgresStorage) insertArgs(elem interface{}, index int) map[string]int
 		v = reflect.ValueOf(elem).Elem()
 	}
 
-	for i := 0; i < v.NumField(); i++ {
-		dbTag := r.elemType.Field(i).Tag.Get("db")
-		if !idTag(dbTag) && !emptyTag(dbTag) {
-			var typeMapString map[string]interface{}
-			var val interface{}
-			if v.Field(i).Type() == reflect.TypeOf(typeMapString) {
-				metadataBytes, err := json.Marshal(v.Field(i).Interface())
-				if err != nil {
-					val = "{}"
-				} else {
-					val = string(metadataBytes)
-				}
-			} else {
-				val = v.Field(i).Interface()
-			}
-			res[dbTag] = val
+	for _, column := range columns {
+		val := r.dbValue(v, column)
+		if column == r.lockColumn && r.field(v, column).IsZero() {
+			// a new row starts at the first version
+			val = 1
 		}
+		res[column] = val
 	}
 
 	if index != 0 {
-		s := strconv.Itoa(index)
+		s := "_" + strconv.Itoa(index)
 		res = renamingKey(res, s)
 	}
 
@@ -332,185 +848,460 @@ func renamingKey(m map[string]interface{}, add string) map[string]interface{} {
 }
 
 // Update updates the element in the database.
-// It will update the "updatedAt" field.
+// It will update the "updatedAt" field, and the update hooks of the element run within the transaction of the update.
+// When the model has a column tagged with the lock option, e.g. `db:"version,lock"`,
+// the row is only updated if its version still equals the version of the element,
+// the version is then incremented, otherwise ErrConflict is returned.
 func (r *PostgresStorage) Update(ctx context.Context, elem interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+
+	return r.hooked(ctx, func(ctx context.Context) error {
+		v := reflect.ValueOf(elem).Elem()
+		err := r.beforeUpdate(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.update(ctx, elem)
+		if err != nil {
+			return err
+		}
+
+		return r.afterUpdate(ctx, v)
+	})
+}
+
+// update updates the element without running its hooks
+func (r *PostgresStorage) update(ctx context.Context, elem interface{}) error {
+	ctx, cancel := withOperation(ctx, OpUpdate)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
 	}
+
 	id := r.findID(elem)
 	existingElem := reflect.New(r.elemType).Interface()
-	err := r.FindByID(ctx, existingElem, id)
-
+	err = r.FindByID(WithPrimary(ctx), existingElem, id)
 	if err != nil {
 		return err
 	}
 
-	statement, err := db.PrepareNamed(fmt.Sprintf(`
-		UPDATE "%s" SET %s WHERE "id" = :id RETURNING %s`,
-		r.tableName,
+	updateArgs := r.updateArgs(elem)
+	updateArgs[r.pk] = id
+
+	where := r.idWhere()
+	if r.lockColumn != "" {
+		version, err := r.lockVersion(reflect.ValueOf(elem))
+		if err != nil {
+			return err
+		}
+
+		where += fmt.Sprintf(` AND %s = :lockVersion`, r.quote(r.lockColumn))
+		updateArgs["lockVersion"] = version
+		updateArgs[r.lockColumn] = version + 1
+	}
+
+	err = r.updateReturning(ctx, db, fmt.Sprintf(`
+		UPDATE %s SET %s WHERE %s%s`,
+		r.quote(r.tableName),
 		r.updateSetFields,
-		r.selectFields))
+		where,
+		r.andScope(ctx)), updateArgs, elem)
 	if err != nil {
+		if err == sql.ErrNoRows && r.lockColumn != "" {
+			return ErrConflict
+		}
 		return err
 	}
-	defer statement.Close()
 
-	updateArgs := r.updateArgs(existingElem, elem)
-	updateArgs["id"] = id
-	err = statement.Get(elem, updateArgs)
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditUpdate, reflect.ValueOf(existingElem).Elem(), reflect.ValueOf(elem).Elem())
+}
+
+// UpdateFields updates only the columns of the element in the database,
+// the element is then refreshed with the stored row.
+// The columns are validated against the db tags of the model and can't contain the id.
+// Optimistic locking applies as in Update, except that it returns ErrNotFound
+// when the element doesn't exist anymore.
+// The "updatedAt" field is updated along the columns and the update hooks run as in Update.
+func (r *PostgresStorage) UpdateFields(ctx context.Context, elem interface{}, columns ...string) error {
+	err := r.checkElem(elem)
 	if err != nil {
 		return err
 	}
+	if len(columns) == 0 {
+		return fmt.Errorf("update fields of %s needs at least one column", r.tableName)
+	}
 
-	return nil
+	return r.hooked(ctx, func(ctx context.Context) error {
+		v := reflect.ValueOf(elem).Elem()
+		err := r.beforeUpdate(ctx, v)
+		if err != nil {
+			return err
+		}
+
+		err = r.updateFields(ctx, elem, r.updateColumns(columns)...)
+		if err != nil {
+			return err
+		}
+
+		return r.afterUpdate(ctx, v)
+	})
 }
 
-// it assumes the id column named "id"
-func (r *PostgresStorage) findID(elem interface{}) interface{} {
-	v := reflect.ValueOf(elem).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		dbTag := r.elemType.Field(i).Tag.Get("db")
-		if idTag(dbTag) {
-			return v.Field(i).Interface()
+// updateFields updates the columns of the element without running its hooks
+func (r *PostgresStorage) updateFields(ctx context.Context, elem interface{}, columns ...string) error {
+	ctx, cancel := withOperation(ctx, OpUpdate)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	err := r.checkElem(elem)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("update fields of %s needs at least one column", r.tableName)
+	}
+
+	v := reflect.ValueOf(elem)
+	id := r.findID(elem)
+	updateArgs := map[string]interface{}{
+		r.pk: id,
+	}
+
+	var existingElem reflect.Value
+	if r.auditor != nil {
+		existing := reflect.New(r.elemType)
+		err = r.FindByID(WithPrimary(ctx), existing.Interface(), id)
+		if err != nil {
+			return err
 		}
+		existingElem = existing.Elem()
 	}
-	return nil
+
+	sets := []string{}
+	for _, column := range columns {
+		if !contains(r.updatable, column) || column == r.lockColumn {
+			return fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+		sets = append(sets, fmt.Sprintf(`%s = :%s`, r.quote(column), column))
+		updateArgs[column] = r.dbValue(v, column)
+	}
+
+	where := r.idWhere()
+	if r.lockColumn != "" {
+		version, err := r.lockVersion(v)
+		if err != nil {
+			return err
+		}
+
+		sets = append(sets, fmt.Sprintf(`%s = :%s`, r.quote(r.lockColumn), r.lockColumn))
+		where += fmt.Sprintf(` AND %s = :lockVersion`, r.quote(r.lockColumn))
+		updateArgs["lockVersion"] = version
+		updateArgs[r.lockColumn] = version + 1
+	}
+
+	err = r.updateReturning(ctx, db, fmt.Sprintf(`
+		UPDATE %s SET %s WHERE %s%s`,
+		r.quote(r.tableName),
+		strings.Join(sets, ","),
+		where,
+		r.andScope(ctx)), updateArgs, elem)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		}
+		if r.lockColumn == "" {
+			return ErrNotFound
+		}
+
+		count, err := r.Count(WithPrimary(ctx), r.idWhere(), map[string]interface{}{
+			r.pk: id,
+		})
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+		return ErrConflict
+	}
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditUpdate, existingElem, v.Elem())
 }
 
-func (r *PostgresStorage) updateArgs(existingElem interface{}, elem interface{}) map[string]interface{} {
-	res := map[string]interface{}{}
+// updateReturning runs the UPDATE of the element and refreshes the element with the updated row,
+// it returns sql.ErrNoRows when no row was updated.
+// When the dialect doesn't support RETURNING, the row is read back by its id.
+func (r *PostgresStorage) updateReturning(ctx context.Context, db Queryer, query string, updateArgs map[string]interface{}, elem interface{}) error {
+	if r.dialect.Returning() {
+		return r.getNamed(ctx, db, elem, query+" RETURNING "+r.selectFields, updateArgs)
+	}
 
-	v := reflect.ValueOf(elem).Elem()
-	ev := reflect.ValueOf(existingElem).Elem()
-	for i := 0; i < ev.NumField(); i++ {
-		dbTag := r.elemType.Field(i).Tag.Get("db")
-		if !idTag(dbTag) && !emptyTag(dbTag) {
-			var typeMapString map[string]interface{}
-			var val interface{}
-
-			if v.Field(i).Type() == reflect.TypeOf(typeMapString) {
-				metadataBytes, err := json.Marshal(v.Field(i).Interface())
-				if err != nil {
-					val = "{}"
-				} else {
-					val = string(metadataBytes)
-				}
-			} else {
-				val = v.Field(i).Interface()
-			}
-			res[dbTag] = val
+	result, err := r.execNamed(ctx, db, query, updateArgs)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// the version always changes, so no affected row means the lock didn't match
+	if affected == 0 && r.lockColumn != "" {
+		return sql.ErrNoRows
+	}
+
+	// mysql doesn't count the matched rows that were left unchanged, reading the row back tells if it exists
+	err = r.FindByID(WithPrimary(ctx), elem, updateArgs[r.pk])
+	if err == ErrNotFound {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// UpdateWhere sets the columns of the set to their values for every element matching
+// the query & argument provided, and returns the number of updated elements.
+// The columns are validated against the db tags of the model and can't contain the id,
+// the version of the lock column, if any, is incremented and the "updatedAt" field is updated.
+// The hooks of the elements are not run.
+func (r *PostgresStorage) UpdateWhere(ctx context.Context, set map[string]interface{}, where string, arg map[string]interface{}) (int, error) {
+	ctx, cancel := withOperation(ctx, OpUpdate)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	if len(set) == 0 {
+		return 0, fmt.Errorf("update where of %s needs at least one column", r.tableName)
+	}
+	set = r.updateSet(set)
+
+	updateArgs := map[string]interface{}{}
+	for k, v := range arg {
+		updateArgs[k] = v
+	}
+
+	for column := range set {
+		if !contains(r.updatable, column) || column == r.lockColumn {
+			return 0, fmt.Errorf("invalid update column %q for %s", column, r.tableName)
+		}
+	}
+
+	sets := []string{}
+	for _, column := range r.columns {
+		value, ok := set[column]
+		if !ok {
+			continue
 		}
+		// prefix the set arguments so they don't collide with the where arguments
+		sets = append(sets, fmt.Sprintf(`%s = :set_%s`, r.quote(column), column))
+		updateArgs["set_"+column] = value
+	}
+	if r.lockColumn != "" {
+		sets = append(sets, fmt.Sprintf(`%s = %s + 1`, r.quote(r.lockColumn), r.quote(r.lockColumn)))
+	}
+
+	query := fmt.Sprintf(`UPDATE %s SET %s WHERE (%s)%s`, r.quote(r.tableName), strings.Join(sets, ","), where, r.andScope(ctx))
+	query, args, err := sqlx.Named(query, updateArgs)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args, err = sqlx.In(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	query = db.Rebind(query)
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, r.translateError(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
+
+// findID returns the value of the primary key of the element
+func (r *PostgresStorage) findID(elem interface{}) interface{} {
+	return r.value(reflect.ValueOf(elem), r.pk)
+}
+
+// updateArgs returns the values of the updatable columns of the element
+func (r *PostgresStorage) updateArgs(elem interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+
+	v := reflect.ValueOf(elem)
+	for _, column := range r.updatable {
+		res[column] = r.dbValue(v, column)
 	}
 	return res
 }
 
 // Delete deletes the elem from database.
 // Delete not really deletes the elem from the db, but it will set the
-// "deletedAt" column to current time.
+// "deletedAt" column to current time. It returns ErrNotFound when no element was deleted:
+// the element doesn't exist, belongs to another tenant or is already deleted, and then keeps its deletion time.
+// Soft deleted elements are hidden from the other queries, see WithDeleted, OnlyDeleted and Restore.
+// The delete hooks of the element, if any, run within the transaction of the delete.
 func (r *PostgresStorage) Delete(ctx context.Context, id interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
-	}
-	statement, err := db.PrepareNamed(fmt.Sprintf(`UPDATE "%s" SET "deleted_at" = :deletedAt WHERE "id" = :id RETURNING %s
-	`, r.tableName, r.selectFields))
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.deleteHooked(ctx, r, id, false, r.delete)
+	})
+}
+
+// delete soft deletes the element without running its hooks
+func (r *PostgresStorage) delete(ctx context.Context, id interface{}) error {
+	ctx, cancel := withOperation(ctx, OpDelete)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	existingElem, err := r.audited(ctx, id)
 	if err != nil {
 		return err
 	}
-	defer statement.Close()
 
 	deleteArgs := map[string]interface{}{
-		"id":        id,
+		r.pk:        id,
 		"deletedAt": utils.Now(),
 	}
 
-	_, err = statement.Exec(deleteArgs)
+	result, err := r.execNamed(ctx, db, fmt.Sprintf(`UPDATE %s SET %s = :deletedAt WHERE %s AND %s IS NULL%s`,
+		r.quote(r.tableName), r.quote(softDeleteColumn), r.idWhere(), r.quote(softDeleteColumn), r.andTenant(ctx)), deleteArgs)
 	if err != nil {
 		return err
 	}
-	return nil
-}
 
-// DeleteHard hard delete the elem from database.
-func (r *PostgresStorage) DeleteHard(ctx context.Context, id interface{}) error {
-	db := r.db
-	tx, ok := TxFromContext(ctx)
-	if ok {
-		db = tx
+	// an element that was already deleted is left unchanged
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	if !existingElem.IsValid() {
+		return nil
 	}
 
-	statement, err := db.PrepareNamed(fmt.Sprintf(`
-		DELETE FROM "%s" WHERE "id" = :id
-	`, r.tableName))
+	deletedElem, err := r.withDeletedAt(existingElem, deleteArgs["deletedAt"])
 	if err != nil {
 		return err
 	}
-	defer statement.Close()
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditDelete, existingElem, deletedElem)
+}
 
-	deleteArgs := map[string]interface{}{
-		"id": id,
+// DeleteHard hard delete the elem from database.
+// The delete hooks of the element, if any, run within the transaction of the delete.
+func (r *PostgresStorage) DeleteHard(ctx context.Context, id interface{}) error {
+	return r.hooked(ctx, func(ctx context.Context) error {
+		return r.deleteHooked(ctx, r, id, true, r.deleteHard)
+	})
+}
+
+// deleteHard hard deletes the element without running its hooks
+func (r *PostgresStorage) deleteHard(ctx context.Context, id interface{}) error {
+	ctx, cancel := withOperation(ctx, OpDelete)
+	defer cancel()
+
+	db := r.writer(ctx)
+
+	existingElem, err := r.audited(ctx, id)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	_, err = statement.Exec(deleteArgs)
+	_, err = r.execNamed(ctx, db, fmt.Sprintf(`DELETE FROM %s WHERE %s%s`,
+		r.quote(r.tableName), r.idWhere(), r.andTenant(ctx)), map[string]interface{}{
+		r.pk: id,
+	})
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return r.auditor.record(ctx, r.modelInfo, r.tableName, AuditDeleteHard, existingElem, reflect.Value{})
 }
 
-// NewPostgresStorage creates a new generic postgres Storage
+// hooked runs f within the transaction of the context, or within a new transaction
+// when the model has hooks or the storage is audited, so they're committed or rolled back with the operation
+func (r *PostgresStorage) hooked(ctx context.Context, f func(ctx context.Context) error) error {
+	if !r.hooks && r.auditor == nil {
+		return f(ctx)
+	}
+	if _, ok := TxFromContext(ctx); ok {
+		return f(ctx)
+	}
+
+	// the hooks may have side effects, the transaction is not retried
+	return NewManager(r.db).RunInTransaction(ctx, f)
+}
+
+// NewPostgresStorage creates a new generic Storage, its dialect is chosen from the driver of the database.
+// Its model is compared with its table by VerifySchema.
 func NewPostgresStorage(db *sqlx.DB, tableName string, elem interface{}) *PostgresStorage {
-	elemType := reflect.TypeOf(elem)
-	return &PostgresStorage{
-		db:              db,
-		tableName:       tableName,
-		elemType:        elemType,
-		selectFields:    selectFields(elemType),
-		insertFields:    insertFields(elemType),
-		insertParams:    insertParams(elemType, 0),
-		updateSetFields: updateSetFields(elemType),
+	r := &PostgresStorage{
+		modelInfo: modelInfoOf(reflect.TypeOf(elem)),
+		db:        db,
+		tableName: tableName,
 	}
+	register(r)
+	return r.SetDialect(DialectOf(db.DriverName()))
 }
 
-func selectFields(elemType reflect.Type) string {
+// selectFields returns the quoted list of the columns of the model
+func selectFields(m *modelInfo, dialect Dialect) string {
 	dbFields := []string{}
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
-		dbTag := field.Tag.Get("db")
-		if dbTag != "" && dbTag != "-" {
-			dbFields = append(dbFields, fmt.Sprintf("\"%s\"", dbTag))
-		}
+	for _, column := range m.columns {
+		dbFields = append(dbFields, dialect.Quote(column))
 	}
 	return strings.Join(dbFields, ",")
 }
 
-func insertFields(elemType reflect.Type) string {
+// insertFields returns the quoted list of the columns written by an insert
+func insertFields(m *modelInfo, dialect Dialect) string {
+	return quoteColumns(m.insertable, dialect)
+}
+
+// quoteColumns returns the quoted list of the columns
+func quoteColumns(columns []string, dialect Dialect) string {
 	dbFields := []string{}
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
-		dbTag := field.Tag.Get("db")
-		if !idTag(dbTag) && !emptyTag(dbTag) {
-			dbFields = append(dbFields, fmt.Sprintf("\"%s\"", dbTag))
-		}
+	for _, column := range columns {
+		dbFields = append(dbFields, dialect.Quote(column))
 	}
 	return strings.Join(dbFields, ",")
 }
 
-func insertParams(elemType reflect.Type, index int) string {
+// insertParams returns the named parameters of the columns written by an insert,
+// suffixed with the index of the element in a multi-row insert when it's not zero
+func insertParams(m *modelInfo, index int) string {
+	return columnParams(m.insertable, index)
+}
+
+// columnParams returns the named parameters of the columns, suffixed with the index when it's not zero
+func columnParams(columns []string, index int) string {
 	dbParams := []string{}
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
-		dbTag := field.Tag.Get("db")
-		if !idTag(dbTag) && !emptyTag(dbTag) {
-			dbParams = append(dbParams, fmt.Sprintf(":%s", dbTag))
-		}
+	for _, column := range columns {
+		dbParams = append(dbParams, fmt.Sprintf(":%s", column))
 	}
 
 	if index != 0 {
-		s := strconv.Itoa(index)
+		s := "_" + strconv.Itoa(index)
 		for i, v := range dbParams {
 			dbParams[i] = fmt.Sprint(v, s)
 		}
@@ -519,20 +1310,27 @@ func insertParams(elemType reflect.Type, index int) string {
 	return strings.Join(dbParams, ",")
 }
 
-func updateSetFields(elemType reflect.Type) string {
+// updateSetFields returns the SET assignments of the updatable columns
+func updateSetFields(m *modelInfo, dialect Dialect) string {
 	setFields := []string{}
-	for i := 0; i < elemType.NumField(); i++ {
-		field := elemType.Field(i)
-		dbTag := field.Tag.Get("db")
-		if !idTag(dbTag) && !emptyTag(dbTag) {
-			setFields = append(setFields, fmt.Sprintf("\"%s\" = :%s", dbTag, dbTag))
-		}
+	for _, column := range m.updatable {
+		setFields = append(setFields, fmt.Sprintf("%s = :%s", dialect.Quote(column), column))
 	}
 	return strings.Join(setFields, ",")
 }
 
-func idTag(dbTag string) bool {
-	return dbTag == "id"
+// hasColumn reports whether the column is mapped by a db tag of the element
+func (r *PostgresStorage) hasColumn(column string) bool {
+	return contains(r.columns, column)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 func emptyTag(dbTag string) bool {
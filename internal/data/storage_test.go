@@ -0,0 +1,183 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type batchItem struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+type keyedItem struct {
+	Code string `db:"code,pk"`
+	Name string `db:"name"`
+	Rank int    `db:"rank"`
+}
+
+const (
+	batchItemSchema = `CREATE TABLE batch_item (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL)`
+	keyedItemSchema = `CREATE TABLE keyed_item (code TEXT PRIMARY KEY, name TEXT NOT NULL, rank INT NOT NULL DEFAULT 0)`
+)
+
+// sequenceDialect allocates the ids of the batch_item of sqlite from a fake sequence starting after the last id,
+// in the reverse order of the elements
+type sequenceDialect struct {
+	Dialect
+	start int
+}
+
+func (d sequenceDialect) NextIDs() string {
+	return fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < :count)
+		SELECT COALESCE((SELECT MAX(id) FROM batch_item), %d) + :count - n + 1 FROM seq`, d.start)
+}
+
+// nullSequenceDialect has sequences but none for the primary key, as postgres for a uuid default
+type nullSequenceDialect struct {
+	Dialect
+}
+
+func (nullSequenceDialect) NextIDs() string {
+	return `WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < :count) SELECT NULL FROM seq`
+}
+
+func TestInsertManyWritesBackTheRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		count   int
+	}{
+		{"inserted one by one without sequence", SQLite, 5},
+		{"ids allocated from the sequence", sequenceDialect{Dialect: SQLite, start: 100}, 5},
+		{"null sequence falls back to one by one", nullSequenceDialect{Dialect: SQLite}, 3},
+		{"several batches", sequenceDialect{Dialect: SQLite, start: 1000}, SQLite.MaxBindParams()/2 + 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openSQLite(t, batchItemSchema)
+			storage := NewPostgresStorage(db, "batch_item", batchItem{}).SetDialect(tt.dialect)
+
+			items := make([]*batchItem, tt.count)
+			for i := range items {
+				items[i] = &batchItem{Name: fmt.Sprintf("item %d", i)}
+			}
+			err := storage.InsertMany(context.Background(), items)
+			if err != nil {
+				t.Fatalf("InsertMany: %v", err)
+			}
+
+			ids := map[int]bool{}
+			for _, item := range items {
+				if item.ID == 0 || ids[item.ID] {
+					t.Fatalf("item %q got the id %d, want a unique generated id", item.Name, item.ID)
+				}
+				ids[item.ID] = true
+
+				stored := &batchItem{}
+				err = storage.FindByID(context.Background(), stored, item.ID)
+				if err != nil {
+					t.Fatalf("FindByID(%d): %v", item.ID, err)
+				}
+				if stored.Name != item.Name {
+					t.Errorf("the row %d is %q, written back to %q", item.ID, stored.Name, item.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertManyMatchesTheRowsByKey(t *testing.T) {
+	db := openSQLite(t, keyedItemSchema)
+	storage := NewPostgresStorage(db, "keyed_item", keyedItem{})
+
+	items := []keyedItem{{Code: "c", Name: "C"}, {Code: "a", Name: "A"}, {Code: "b", Name: "B"}}
+	err := storage.InsertMany(context.Background(), items)
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+
+	for _, item := range items {
+		if item.Name != strings.ToUpper(item.Code) {
+			t.Errorf("the item %q was written back with the row %q", item.Code, item.Name)
+		}
+	}
+}
+
+func TestUpsertMatchesTheRowsByConflictColumns(t *testing.T) {
+	db := openSQLite(t, batchItemSchema, `CREATE UNIQUE INDEX batch_item_name ON batch_item(name)`)
+	storage := NewPostgresStorage(db, "batch_item", batchItem{})
+	ctx := context.Background()
+
+	existing := &batchItem{Name: "b"}
+	err := storage.Insert(ctx, existing)
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	items := []*batchItem{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	err = storage.Upsert(ctx, items, []string{"name"}, []string{"name"})
+	if err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	if items[1].ID != existing.ID {
+		t.Errorf("the conflicting item got the id %d, want the existing id %d", items[1].ID, existing.ID)
+	}
+	for _, item := range items {
+		stored := &batchItem{}
+		err = storage.FindByID(ctx, stored, item.ID)
+		if err != nil || stored.Name != item.Name {
+			t.Errorf("the item %q got the id %d of the row %q (%v)", item.Name, item.ID, stored.Name, err)
+		}
+	}
+}
+
+type versionedItem struct {
+	ID      int    `db:"id"`
+	Name    string `db:"name"`
+	Version int    `db:"version,lock"`
+}
+
+func TestUpsertWithNothingToUpdate(t *testing.T) {
+	db := openSQLite(t, `CREATE TABLE versioned_item (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, version INT NOT NULL)`)
+	storages := map[string]GenericStorage{
+		"sqlite": NewPostgresStorage(db, "versioned_item", versionedItem{}),
+		"memory": NewMemoryStorage("versioned_item", versionedItem{}),
+	}
+	for name, storage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			existing := &versionedItem{Name: "a"}
+			err := storage.Insert(ctx, existing)
+			if err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+
+			items := []*versionedItem{{Name: "a"}, {Name: "b"}}
+			err = storage.Upsert(ctx, items, []string{"name"}, nil)
+			if err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+
+			stored := &versionedItem{}
+			err = storage.FindByID(ctx, stored, existing.ID)
+			if err != nil {
+				t.Fatalf("FindByID: %v", err)
+			}
+			if stored.Version != existing.Version {
+				t.Errorf("the conflicting row moved to the version %d, want it left at %d", stored.Version, existing.Version)
+			}
+			if items[1].ID == 0 {
+				t.Errorf("the new item wasn't written back")
+			}
+
+			count, err := storage.Count(ctx, "1 = 1", map[string]interface{}{})
+			if err != nil || count != 2 {
+				t.Errorf("Count() = %d, %v, want 2 rows", count, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+// Errors of the tenant scoping
+var (
+	ErrNoTenant       = fmt.Errorf("the context has no tenant")
+	ErrTenantMismatch = fmt.Errorf("data belongs to another tenant")
+)
+
+// WithoutTenant makes the storage queries run with the context ignore the tenant of the models,
+// for the lookups that happen before the tenant is known and the jobs spanning every tenant
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTenantKey, true)
+}
+
+// withoutTenantFromContext reports whether the context ignores the tenant
+func withoutTenantFromContext(ctx context.Context) bool {
+	without, _ := ctx.Value(noTenantKey).(bool)
+	return without
+}
+
+// tenantPredicate returns the predicate limiting the rows to the tenant of the context, appcontext.ClientID.
+// It's empty when the model has no tenant column or the context is WithoutTenant,
+// and it matches no row when the context has no tenant.
+func (r *PostgresStorage) tenantPredicate(ctx context.Context) string {
+	if r.tenantColumn == "" || withoutTenantFromContext(ctx) {
+		return ""
+	}
+
+	clientID := appcontext.ClientID(ctx)
+	if clientID == nil {
+		return "1 = 0"
+	}
+	return fmt.Sprintf(`%s = %d`, r.quote(r.tenantColumn), *clientID)
+}
+
+// andTenant returns the tenant predicate prefixed with AND, to be appended to a WHERE clause
+func (r *PostgresStorage) andTenant(ctx context.Context) string {
+	predicate := r.tenantPredicate(ctx)
+	if predicate == "" {
+		return ""
+	}
+	return " AND " + predicate
+}
+
+// stampTenant sets the tenant column of an inserted element to the tenant of the context.
+// It fails when the context has no tenant or the element already belongs to another tenant,
+// the element is kept as is when the context is WithoutTenant.
+func (m *modelInfo) stampTenant(ctx context.Context, elem reflect.Value) error {
+	if m.tenantColumn == "" || withoutTenantFromContext(ctx) {
+		return nil
+	}
+
+	clientID := appcontext.ClientID(ctx)
+	if clientID == nil {
+		return ErrNoTenant
+	}
+
+	field := m.field(elem, m.tenantColumn)
+	if !field.IsZero() && normalize(field.Interface()) != int64(*clientID) {
+		return ErrTenantMismatch
+	}
+	return setValue(field, *clientID)
+}
+
+// tenantValue returns the tenant of the row, nil when the model has no tenant column
+func (m *modelInfo) tenantValue(row reflect.Value) interface{} {
+	if m.tenantColumn == "" {
+		return nil
+	}
+	return m.value(row, m.tenantColumn)
+}
+
+// tenantVisible reports whether the row belongs to the tenant of the context, as the tenant predicate
+func (m *modelInfo) tenantVisible(ctx context.Context, row reflect.Value) bool {
+	if m.tenantColumn == "" || withoutTenantFromContext(ctx) {
+		return true
+	}
+
+	clientID := appcontext.ClientID(ctx)
+	return clientID != nil && normalize(m.value(row, m.tenantColumn)) == int64(*clientID)
+}
+
+// checkConflictTenant returns an error when the conflict columns of an upsert miss the tenant column,
+// the conflicting row could belong to another tenant otherwise
+func (m *modelInfo) checkConflictTenant(ctx context.Context, conflictColumns []string) error {
+	if m.tenantColumn == "" || withoutTenantFromContext(ctx) || contains(conflictColumns, m.tenantColumn) {
+		return nil
+	}
+	return fmt.Errorf("the conflict columns of %s must include the tenant column %q", m.elemType, m.tenantColumn)
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Operation names a storage operation
+type Operation string
+
+// Storage operations
+const (
+	OpSingle Operation = "Single"
+	OpWhere  Operation = "Where"
+	OpCount  Operation = "Count"
+	OpSelect Operation = "SelectWithQuery"
+	OpInsert Operation = "Insert"
+	OpUpdate Operation = "Update"
+	OpDelete Operation = "Delete"
+	// OpEach is only bounded by the deadline of its context, the iteration may outlast any default timeout
+	OpEach Operation = "Each"
+)
+
+// Timeouts holds the default timeouts of the storage operations,
+// zero means the operation is only bounded by the deadline of its context
+type Timeouts struct {
+	Default    time.Duration
+	Operations map[Operation]time.Duration
+}
+
+// timeouts holds the timeouts set by SetTimeouts
+var timeouts atomic.Pointer[Timeouts]
+
+// SetTimeouts sets the default timeouts of the storage operations
+func SetTimeouts(t Timeouts) {
+	timeouts.Store(&t)
+}
+
+// withOperation labels the queries run with the context with the operation, see QueryMetrics,
+// and bounds the context by the default timeout of the operation
+func withOperation(ctx context.Context, op Operation) (context.Context, context.CancelFunc) {
+	ctx = context.WithValue(ctx, operationKey, op)
+	if op == OpEach {
+		return ctx, func() {}
+	}
+	return withTimeout(ctx, op)
+}
+
+// operationFromContext returns the operation of the context
+func operationFromContext(ctx context.Context) Operation {
+	op, _ := ctx.Value(operationKey).(Operation)
+	return op
+}
+
+// withTimeout bounds the context by the default timeout of the operation,
+// a sooner deadline already set on the context is kept
+func withTimeout(ctx context.Context, op Operation) (context.Context, context.CancelFunc) {
+	t := timeouts.Load()
+	if t == nil {
+		return ctx, func() {}
+	}
+
+	timeout, ok := t.Operations[op]
+	if !ok {
+		timeout = t.Default
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,97 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// setTimeouts sets the timeouts, nil for none, for the test and restores the previous ones after it
+func setTimeouts(t *testing.T, tt *Timeouts) {
+	t.Helper()
+
+	previous := timeouts.Load()
+	timeouts.Store(tt)
+	t.Cleanup(func() {
+		timeouts.Store(previous)
+	})
+}
+
+func TestWithOperationTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts *Timeouts
+		op       Operation
+		want     time.Duration
+	}{
+		{"no timeout by default", nil, OpWhere, 0},
+		{"default timeout", &Timeouts{Default: time.Hour}, OpWhere, time.Hour},
+		{"operation override", &Timeouts{Default: time.Hour, Operations: map[Operation]time.Duration{OpInsert: time.Minute}}, OpInsert, time.Minute},
+		{"override of another operation", &Timeouts{Default: time.Hour, Operations: map[Operation]time.Duration{OpInsert: time.Minute}}, OpWhere, time.Hour},
+		{"override disabling the timeout", &Timeouts{Default: time.Hour, Operations: map[Operation]time.Duration{OpCount: 0}}, OpCount, 0},
+		{"each is never bounded", &Timeouts{Default: time.Hour, Operations: map[Operation]time.Duration{OpEach: time.Minute}}, OpEach, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTimeouts(t, tt.timeouts)
+
+			start := time.Now()
+			ctx, cancel := withOperation(context.Background(), tt.op)
+			defer cancel()
+
+			if got := operationFromContext(ctx); got != tt.op {
+				t.Errorf("operation = %s, want %s", got, tt.op)
+			}
+			deadline, ok := ctx.Deadline()
+			if tt.want == 0 {
+				if ok {
+					t.Errorf("deadline in %s, want none", deadline.Sub(start))
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no deadline, want one in %s", tt.want)
+			}
+			if got := deadline.Sub(start); got < tt.want || got > tt.want+time.Second {
+				t.Errorf("deadline in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithOperationTimeoutKeepsASoonerDeadline(t *testing.T) {
+	setTimeouts(t, &Timeouts{Default: time.Hour})
+
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Minute)
+	defer cancelParent()
+	ctx, cancel := withOperation(parent, OpWhere)
+	defer cancel()
+
+	want, _ := parent.Deadline()
+	if got, _ := ctx.Deadline(); !got.Equal(want) {
+		t.Errorf("deadline = %s, want %s", got, want)
+	}
+}
+
+func TestStorageQueriesAreBoundedByTheTimeout(t *testing.T) {
+	storage := NewPostgresStorage(openSQLite(t, txItemSchema), "tx_item", txItem{})
+	err := storage.Insert(context.Background(), &txItem{Name: "a"})
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	setTimeouts(t, &Timeouts{Default: time.Hour, Operations: map[Operation]time.Duration{OpWhere: time.Nanosecond}})
+
+	items := []txItem{}
+	err = storage.Where(context.Background(), &items, "1 = 1", map[string]interface{}{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Where() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	count, err := storage.Count(context.Background(), "1 = 1", map[string]interface{}{})
+	if err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+}
@@ -54,6 +54,7 @@ func (hs *Server) authorizedOnly(userService user.ServiceInterface) func(next ht
 				return
 			}
 			ctx = context.WithValue(ctx, appcontext.KeyUserID, singleUser.ID)
+			ctx = context.WithValue(ctx, appcontext.KeyClientID, singleUser.ClientID)
 			ctx = context.WithValue(ctx, appcontext.KeySessionID, *singleUser.Token)
 
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -63,6 +64,38 @@ func (hs *Server) authorizedOnly(userService user.ServiceInterface) func(next ht
 	}
 }
 
+// adminOnly only lets the users of config.AdminUserIDs through, it must be used after authorizedOnly
+func (hs *Server) adminOnly(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		userID := appcontext.UserID(r.Context())
+		for _, adminUserID := range hs.config.AdminUserIDs {
+			if userID != 0 && userID == adminUserID {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		response.Error(w, "Forbidden", http.StatusForbidden, types.Error{
+			Path:    ".Server->adminOnly()",
+			Message: "",
+			Error:   nil,
+			Type:    "",
+		})
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// publicClient scopes the public requests to config.PublicClientID, as they have no authorized user to take it from
+func (hs *Server) publicClient(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), appcontext.KeyClientID, hs.config.PublicClientID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
 func getBearerToken(r *http.Request) string {
 	token := r.Header.Get("Authorization")
 	splitToken := strings.Split(token, "Bearer")
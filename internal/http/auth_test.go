@@ -0,0 +1,113 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/config"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/redis"
+	"github.com/riskibarqy/go-template/internal/user"
+	"github.com/riskibarqy/go-template/internal/user/postgres"
+	"github.com/riskibarqy/go-template/models"
+	"github.com/riskibarqy/go-template/utils"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	// nothing listens on the port, the cache always misses
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+}
+
+// newTestServer returns a server of the users of a sqlite database, one logged-in user in each of the clients 1 and 2
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "http.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+
+	storage := data.NewStorage[models.User](db, user.TableName)
+	expiredAt := utils.Now() + 3600
+	for clientID, name := range map[int]string{1: "alice", 2: "bob"} {
+		token := "token-" + name
+		ctx := context.WithValue(context.Background(), appcontext.KeyClientID, clientID)
+		err = storage.Insert(ctx, &models.User{Name: name, Email: name + "@example.com", Password: "x", Token: &token, TokenExpiredAt: &expiredAt})
+		if err != nil {
+			t.Fatalf("Insert(%s): %v", name, err)
+		}
+	}
+
+	userService := user.NewService(postgres.NewPostgresStorage(storage.Generic()), nil)
+	return NewServer(&config.Config{}, data.NewManager(db), userService, nil)
+}
+
+// listedUsers returns the names of the users listed by the request
+func listedUsers(t *testing.T, router http.Handler, r *http.Request) []string {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s = %d %s, want 200", r.URL.Path, w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Data []*models.User `json:"data"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&body)
+	if err != nil {
+		t.Fatalf("decode the users: %v", err)
+	}
+	names := []string{}
+	for _, u := range body.Data {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func TestClientIsOnlyTakenFromTheAuthorizedUser(t *testing.T) {
+	router := newTestServer(t).compileRouter()
+
+	r := httptest.NewRequest("GET", "/account-service/v1/private/users", nil)
+	r.Header.Set("Authorization", "Bearer token-bob")
+	r.Header.Set("X-Client-Id", "1")
+	names := listedUsers(t, router, r)
+	if len(names) != 1 || names[0] != "bob" {
+		t.Errorf("the users of bob with the client header of alice = %v, want [bob]", names)
+	}
+}
+
+func TestPublicUsersAreTheUsersOfThePublicClient(t *testing.T) {
+	server := newTestServer(t)
+
+	w := httptest.NewRecorder()
+	server.compileRouter().ServeHTTP(w, httptest.NewRequest("GET", "/account-service/v1/public/users", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("the public users without public client = %d, want 404", w.Code)
+	}
+
+	server.config.PublicClientID = 2
+	r := httptest.NewRequest("GET", "/account-service/v1/public/users", nil)
+	r.Header.Set("X-Client-Id", "1")
+	names := listedUsers(t, server.compileRouter(), r)
+	if len(names) != 1 || names[0] != "bob" {
+		t.Errorf("the public users with the client header of alice = %v, want the [bob] of the public client", names)
+	}
+}
@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/riskibarqy/go-template/datatransfers"
+	"github.com/riskibarqy/go-template/internal/audit"
+	"github.com/riskibarqy/go-template/internal/http/response"
+	"github.com/riskibarqy/go-template/internal/types"
+	"github.com/riskibarqy/go-template/internal/user"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// AuditController represents the audit controller
+type AuditController struct {
+	auditService audit.ServiceInterface
+}
+
+// AuditLogList audit log list, total count and paging metadata
+type AuditLogList struct {
+	Data    []*models.AuditLog `json:"data"`
+	Count   int                `json:"count"`
+	Page    int                `json:"page"`
+	Limit   int                `json:"limit"`
+	HasNext bool               `json:"hasNext"`
+}
+
+// UserHistory lists the audit logs of a user, the latest first.
+// The audit logs are scoped to the client of the admin, as the user they're about.
+func (a *AuditController) UserHistory(w http.ResponseWriter, r *http.Request) {
+	var err *types.Error
+
+	userID, errConversion := strconv.Atoi(chi.URLParam(r, "userId"))
+	if errConversion != nil {
+		err = &types.Error{
+			Path:    ".AuditController->UserHistory()",
+			Message: errConversion.Error(),
+			Error:   errConversion,
+			Type:    "golang-error",
+		}
+		response.Error(w, "Bad Request", http.StatusBadRequest, *err)
+		return
+	}
+
+	queryValues := r.URL.Query()
+	var limit = 10
+	if queryValues.Get("limit") != "" {
+		limit, errConversion = strconv.Atoi(queryValues.Get("limit"))
+		if errConversion != nil {
+			err = &types.Error{
+				Path:    ".AuditController->UserHistory()",
+				Message: errConversion.Error(),
+				Error:   errConversion,
+				Type:    "golang-error",
+			}
+			response.Error(w, "Bad Request", http.StatusBadRequest, *err)
+			return
+		}
+	}
+
+	var page = 1
+	if queryValues.Get("page") != "" {
+		page, errConversion = strconv.Atoi(queryValues.Get("page"))
+		if errConversion != nil {
+			err = &types.Error{
+				Path:    ".AuditController->UserHistory()",
+				Message: errConversion.Error(),
+				Error:   errConversion,
+				Type:    "golang-error",
+			}
+			response.Error(w, "Bad Request", http.StatusBadRequest, *err)
+			return
+		}
+	}
+
+	if limit <= 0 {
+		limit = 10
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	auditLogs, count, err := a.auditService.History(r.Context(), &datatransfers.AuditHistoryParams{
+		TableName: user.TableName,
+		RowID:     strconv.Itoa(userID),
+		Page:      page,
+		Limit:     limit,
+	})
+	if err != nil {
+		err.Path = ".AuditController->UserHistory()" + err.Path
+		response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+		return
+	}
+	if auditLogs == nil {
+		auditLogs = []*models.AuditLog{}
+	}
+
+	response.JSON(w, http.StatusOK, AuditLogList{
+		Data:    auditLogs,
+		Count:   count,
+		Page:    page,
+		Limit:   limit,
+		HasNext: page*limit < count,
+	})
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(
+	auditService audit.ServiceInterface,
+) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+	}
+}
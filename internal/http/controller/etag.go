@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidETag is returned when the If-Match header is not an ETag sent by the server
+var ErrInvalidETag = errors.New("invalid If-Match ETag")
+
+// makeETag makes the ETag of a resource from its version
+func makeETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// parseIfMatch returns the version held by the If-Match header,
+// it returns 0 when the header is empty or "*" so any version matches
+func parseIfMatch(header string) (int, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil || version < 1 {
+		return 0, ErrInvalidETag
+	}
+
+	return version, nil
+}
@@ -24,10 +24,21 @@ type UserController struct {
 	dataManager *data.Manager
 }
 
-// UserList user list and count
+// UserList user list, total count and paging metadata
 type UserList struct {
-	Data  []*models.User `json:"data"`
-	Count int            `json:"count"`
+	Data    []*models.User `json:"data"`
+	Count   int            `json:"count"`
+	Page    int            `json:"page"`
+	Limit   int            `json:"limit"`
+	HasNext bool           `json:"hasNext"`
+}
+
+// UserCursorList user list of a keyset page and the cursor of the next page
+type UserCursorList struct {
+	Data       []*models.User `json:"data"`
+	Limit      int            `json:"limit"`
+	NextCursor string         `json:"nextCursor"`
+	HasNext    bool           `json:"hasNext"`
 }
 
 func (a *UserController) Login(w http.ResponseWriter, r *http.Request) {
@@ -99,7 +110,7 @@ func (a *UserController) ChangePassword(w http.ResponseWriter, r *http.Request)
 		if err.Error == user.ErrWrongPassword {
 			response.Error(w, "Wrong old password", http.StatusBadRequest, *err)
 		} else {
-			response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+			response.DataError(w, *err)
 		}
 		return
 	}
@@ -137,6 +148,21 @@ func (a *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, errETag := parseIfMatch(r.Header.Get("If-Match"))
+	if errETag != nil {
+		err = &types.Error{
+			Path:    ".UserController->UpdateUser()",
+			Message: errETag.Error(),
+			Error:   errETag,
+			Type:    "golang-error",
+		}
+		response.Error(w, "Bad Request", http.StatusBadRequest, *err)
+		return
+	}
+	if version != 0 {
+		params.Version = version
+	}
+
 	var singleUser *models.User
 	errTransaction := a.dataManager.RunInTransaction(r.Context(), func(ctx context.Context) error {
 		singleUser, err = a.userService.UpdateUser(ctx, userID, params)
@@ -149,11 +175,15 @@ func (a *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		err.Path = ".UserController->UpdateUser()" + err.Path
 		if errTransaction == user.ErrEmailAlreadyExists {
 			response.Error(w, "email has been registered", http.StatusUnprocessableEntity, *err)
+		} else if errTransaction == data.ErrConflict {
+			response.Error(w, "user has been changed by another request", http.StatusConflict, *err)
 		} else {
-			response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+			response.DataError(w, *err)
 		}
 		return
 	}
+
+	w.Header().Set("ETag", makeETag(singleUser.Version))
 	response.JSON(w, http.StatusOK, singleUser)
 
 }
@@ -202,7 +232,7 @@ func (a *UserController) CreateUser(w http.ResponseWriter, r *http.Request) {
 		if errTransaction == user.ErrEmailAlreadyExists {
 			response.Error(w, "email has been registered", http.StatusUnprocessableEntity, *err)
 		} else {
-			response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+			response.DataError(w, *err)
 		}
 
 		return
@@ -235,7 +265,11 @@ func (a *UserController) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	})
 	if errTransaction != nil {
 		err.Path = ".USerController->DeleteUser()" + err.Path
-		response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+		if err.Error == data.ErrNotFound {
+			response.Error(w, "Not Found", http.StatusNotFound, *err)
+			return
+		}
+		response.DataError(w, *err)
 		return
 	}
 	response.JSON(w, http.StatusNoContent, "")
@@ -285,6 +319,39 @@ func (a *UserController) ListUser(w http.ResponseWriter, r *http.Request) {
 	if page < 0 {
 		page = 1
 	}
+
+	// cursor mode, the client scrolls with the nextCursor of the previous response
+	if _, ok := queryValues["cursor"]; ok {
+		// a page without limit would hold every user and no cursor
+		if limit == 0 {
+			limit = 10
+		}
+		userList, nextCursor, err := a.userService.ListUsersCursor(r.Context(), &datatransfers.FindAllParams{
+			Limit:  limit,
+			Search: search,
+			Cursor: queryValues.Get("cursor"),
+		})
+		if err != nil {
+			err.Path = ".UserController->ListUser()" + err.Path
+			if err.Error == data.ErrInvalidCursor {
+				response.Error(w, "Invalid cursor", http.StatusBadRequest, *err)
+			} else {
+				response.Error(w, "Internal Server Error", http.StatusInternalServerError, *err)
+			}
+			return
+		}
+		if userList == nil {
+			userList = []*models.User{}
+		}
+
+		response.JSON(w, http.StatusOK, UserCursorList{
+			Data:       userList,
+			Limit:      limit,
+			NextCursor: nextCursor,
+			HasNext:    nextCursor != "",
+		})
+		return
+	}
 	userList, count, err := a.userService.ListUsers(r.Context(), &datatransfers.FindAllParams{
 		Limit:  limit,
 		Search: search,
@@ -302,8 +369,11 @@ func (a *UserController) ListUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response.JSON(w, http.StatusOK, UserList{
-		Data:  userList,
-		Count: count,
+		Data:    userList,
+		Count:   count,
+		Page:    page,
+		Limit:   limit,
+		HasNext: page > 0 && limit > 0 && page*limit < count,
 	})
 }
 
@@ -361,6 +431,7 @@ func (a *UserController) GetUserByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", makeETag(user.Version))
 	response.JSON(w, http.StatusOK, user)
 
 }
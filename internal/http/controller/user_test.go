@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/redis"
+	"github.com/riskibarqy/go-template/internal/user"
+	"github.com/riskibarqy/go-template/internal/user/postgres"
+	"github.com/riskibarqy/go-template/models"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	// nothing listens on the port, the cache always misses
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+}
+
+// clientContext returns the context of the first client
+func clientContext() context.Context {
+	return context.WithValue(context.Background(), appcontext.KeyClientID, 1)
+}
+
+// newUserController returns a controller of the users of a sqlite database holding n users of the first client
+func newUserController(t *testing.T, n int) *UserController {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "controller.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+
+	storage := data.NewStorage[models.User](db, user.TableName)
+	for i := 0; i < n; i++ {
+		err = storage.Insert(clientContext(), &models.User{Name: fmt.Sprintf("user %d", i), Email: fmt.Sprintf("user%d@example.com", i), Password: "x"})
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+
+	return NewUserController(user.NewService(postgres.NewPostgresStorage(storage.Generic()), nil), data.NewManager(db))
+}
+
+func TestListUserCursorLimit(t *testing.T) {
+	c := newUserController(t, 12)
+
+	tests := []struct {
+		query     string
+		wantCode  int
+		wantUsers int
+		wantNext  bool
+	}{
+		{"cursor=&limit=5", http.StatusOK, 5, true},
+		{"cursor=&limit=0", http.StatusOK, 10, true},
+		{"cursor=&limit=-1", http.StatusOK, 10, true},
+		{"cursor=", http.StatusOK, 10, true},
+		{"cursor=&limit=20", http.StatusOK, 12, false},
+		{"cursor=&limit=x", http.StatusBadRequest, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/users?"+tt.query, nil).WithContext(clientContext())
+			w := httptest.NewRecorder()
+			c.ListUser(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("ListUser() = %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var body UserCursorList
+			err := json.NewDecoder(w.Body).Decode(&body)
+			if err != nil {
+				t.Fatalf("decode the users: %v", err)
+			}
+			if len(body.Data) != tt.wantUsers || body.HasNext != tt.wantNext || (body.NextCursor != "") != tt.wantNext {
+				t.Errorf("ListUser() = %d users, next %v, want %d users, next %v", len(body.Data), body.HasNext, tt.wantUsers, tt.wantNext)
+			}
+		})
+	}
+}
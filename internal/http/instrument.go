@@ -1,6 +1,7 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -29,8 +30,9 @@ func httpRequestsTotalCounterVec(method string, path string) *prometheus.Counter
 		[]string{"code"},
 	)
 
-	prometheus.MustRegister(counter)
-
+	if existing, ok := registerOrExisting(counter).(*prometheus.CounterVec); ok {
+		return existing
+	}
 	return counter
 }
 
@@ -47,7 +49,22 @@ func httpRequestDuration(method string, path string) *prometheus.HistogramVec {
 		[]string{"handler"},
 	)
 
-	prometheus.MustRegister(duration)
-
+	if existing, ok := registerOrExisting(duration).(*prometheus.HistogramVec); ok {
+		return existing
+	}
 	return duration
 }
+
+// registerOrExisting registers the collector and returns it, or the collector already registered in its place
+// when the router is compiled again. It panics on the other registration errors like prometheus.MustRegister.
+func registerOrExisting(collector prometheus.Collector) prometheus.Collector {
+	err := prometheus.Register(collector)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return alreadyRegistered.ExistingCollector
+	}
+	if err != nil {
+		panic(err)
+	}
+	return collector
+}
@@ -0,0 +1,27 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+)
+
+// requestID puts the id given by middleware.RequestID into the app context, e.g. for the audit logs,
+// and returns it in the X-Request-Id header
+func (hs *Server) requestID(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		requestID := middleware.GetReqID(r.Context())
+		if requestID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(middleware.RequestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), appcontext.KeyRequestID, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
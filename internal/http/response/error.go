@@ -2,10 +2,12 @@ package response
 
 import (
 	"encoding/json"
+	stderrors "errors"
 	"fmt"
 	"log"
 	"net/http"
 
+	"github.com/riskibarqy/go-template/internal/data"
 	"github.com/riskibarqy/go-template/internal/types"
 
 	validator "gopkg.in/go-playground/validator.v9"
@@ -34,8 +36,16 @@ func MakeFieldError(field string, message string) *FieldError {
 	}
 }
 
+// constraintMessages are the messages of the fields violating a constraint, by the kind of the constraint
+var constraintMessages = map[error]string{
+	data.ErrAlreadyExist: "already exists",
+	data.ErrForeignKey:   "does not exist or is still in use",
+	data.ErrNotNull:      "is required",
+	data.ErrCheck:        "is invalid",
+}
+
 // Error writes error http response
-func Error(w http.ResponseWriter, data string, status int, err types.Error) {
+func Error(w http.ResponseWriter, message string, status int, err types.Error) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 
@@ -43,10 +53,14 @@ func Error(w http.ResponseWriter, data string, status int, err types.Error) {
 	switch status {
 	case http.StatusUnauthorized:
 		errorCode = "Unauthorized"
+	case http.StatusForbidden:
+		errorCode = "Forbidden"
 	case http.StatusNotFound:
 		errorCode = "NotFound"
 	case http.StatusBadRequest:
 		errorCode = "BadRequest"
+	case http.StatusConflict:
+		errorCode = "Conflict"
 	case http.StatusUnprocessableEntity:
 		errorCode = "ValidationError"
 	}
@@ -55,7 +69,7 @@ func Error(w http.ResponseWriter, data string, status int, err types.Error) {
 
 	switch err.Error.(type) {
 	case validator.ValidationErrors:
-		data = "Bad Request"
+		message = "Bad Request"
 		for _, err := range err.Error.(validator.ValidationErrors) {
 			e := MakeFieldError(
 				err.Field(),
@@ -65,9 +79,14 @@ func Error(w http.ResponseWriter, data string, status int, err types.Error) {
 		}
 	}
 
+	var constraintErr *data.ConstraintError
+	if stderrors.As(err.Error, &constraintErr) && constraintErr.Field != "" {
+		errorFields = append(errorFields, MakeFieldError(constraintErr.Field, constraintMessages[constraintErr.Kind]))
+	}
+
 	json.NewEncoder(w).Encode(ErrorResponse{
 		Code:    errorCode,
-		Message: data,
+		Message: message,
 		Fields:  errorFields,
 	})
 
@@ -85,3 +104,16 @@ func Error(w http.ResponseWriter, data string, status int, err types.Error) {
 		}
 	}
 }
+
+// DataError writes the error http response of a failed data change: 409 when the data already exists,
+// 422 when it violates another constraint, with the offending field, and 500 otherwise
+func DataError(w http.ResponseWriter, err types.Error) {
+	switch {
+	case stderrors.Is(err.Error, data.ErrAlreadyExist):
+		Error(w, data.ErrAlreadyExist.Error(), http.StatusConflict, err)
+	case stderrors.Is(err.Error, data.ErrForeignKey), stderrors.Is(err.Error, data.ErrNotNull), stderrors.Is(err.Error, data.ErrCheck):
+		Error(w, "Validation Error", http.StatusUnprocessableEntity, err)
+	default:
+		Error(w, "Internal Server Error", http.StatusInternalServerError, err)
+	}
+}
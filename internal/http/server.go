@@ -10,7 +10,9 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/riskibarqy/go-template/config"
+	"github.com/riskibarqy/go-template/internal/audit"
 	"github.com/riskibarqy/go-template/internal/data"
 	"github.com/riskibarqy/go-template/internal/http/controller"
 	"github.com/riskibarqy/go-template/internal/user"
@@ -19,9 +21,11 @@ import (
 
 // Server represents the http server that handles the requests
 type Server struct {
-	dataManager    *data.Manager
-	userService    user.ServiceInterface
-	userController *controller.UserController
+	config          *config.Config
+	dataManager     *data.Manager
+	userService     user.ServiceInterface
+	userController  *controller.UserController
+	auditController *controller.AuditController
 }
 
 func (hs *Server) authMethod(r chi.Router, method string, path string, handler http.HandlerFunc) {
@@ -37,6 +41,7 @@ func (hs *Server) compileRouter() chi.Router {
 	//
 
 	r.Use(middleware.RequestID)
+	r.Use(hs.requestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
 
@@ -53,8 +58,8 @@ func (hs *Server) compileRouter() chi.Router {
 		AllowedOrigins: []string{"*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Access-Token", "X-Requested-With"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Access-Token", "X-Requested-With", "If-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	})
@@ -87,11 +92,28 @@ func (hs *Server) compileRouter() chi.Router {
 		hs.authMethod(r, "GET", "/users/{userId}", hs.userController.GetUserByID)
 		hs.authMethod(r, "POST", "/users", hs.userController.CreateUser)
 		hs.authMethod(r, "DELETE", "/users/{userId}", hs.userController.DeleteUser)
+
+		// Admin routes (require an admin user)
+		r.Group(func(r chi.Router) {
+			r.Use(hs.adminOnly)
+
+			hs.authMethod(r, "GET", "/admin/users/{userId}/history", hs.auditController.UserHistory)
+		})
 	})
 
-	// Public Users Route
-	r.HandleFunc(baseURL+"/public/users", hs.userController.ListUser) // Add any public-specific user operations
+	// Public Users Route, the public requests list the users of the configured public client
+	// and the route is not served without one
+	if hs.config.PublicClientID != 0 {
+		r.With(hs.publicClient).HandleFunc(baseURL+"/public/users", hs.userController.ListUser) // Add any public-specific user operations
+	}
+
+	return r
+}
 
+// metricsRouter returns the router of the internal listener, serving the prometheus metrics
+func metricsRouter() chi.Router {
+	r := chi.NewRouter()
+	r.Handle("/metrics", promhttp.Handler())
 	return r
 }
 
@@ -114,6 +136,18 @@ func (hs *Server) Serve() {
 		}
 	}()
 
+	// Prometheus metrics of the requests, the database queries and the connection pools,
+	// served on an internal listener apart from the public api
+	metricsSrv := http.Server{Addr: hs.config.MetricsAddr, Handler: metricsRouter()}
+	if hs.config.MetricsAddr != "" {
+		log.Printf("Serving the metrics on %s", hs.config.MetricsAddr)
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("listen metrics: %s\n", err)
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt)
 
@@ -125,6 +159,9 @@ func (hs *Server) Serve() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server Shutdown:", err)
 	}
+	if err := metricsSrv.Shutdown(ctx); err != nil {
+		log.Fatal("Metrics Server Shutdown:", err)
+	}
 	log.Println("Server exiting")
 }
 
@@ -133,12 +170,16 @@ func NewServer(
 	config *config.Config,
 	dataManager *data.Manager,
 	userService user.ServiceInterface,
+	auditService audit.ServiceInterface,
 ) *Server {
 	userController := controller.NewUserController(userService, dataManager)
+	auditController := controller.NewAuditController(auditService)
 
 	return &Server{
-		dataManager:    dataManager,
-		userService:    userService,
-		userController: userController,
+		config:          config,
+		dataManager:     dataManager,
+		userService:     userService,
+		userController:  userController,
+		auditController: auditController,
 	}
 }
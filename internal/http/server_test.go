@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsAreServedApartFromTheAPI(t *testing.T) {
+	router := newTestServer(t).compileRouter()
+	// compiling the router again reuses the registered request metrics
+	newTestServer(t).compileRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics on the api = %d, want 404", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	metricsRouter().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /metrics on the internal listener = %d, want 200", w.Code)
+	}
+}
+
+func TestDeleteMissingUser(t *testing.T) {
+	router := newTestServer(t).compileRouter()
+
+	r := httptest.NewRequest("DELETE", "/account-service/v1/private/users/1000", nil)
+	r.Header.Set("Authorization", "Bearer token-alice")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("DELETE of a missing user = %d %s, want 404", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/models"
+	"github.com/riskibarqy/go-template/utils"
+)
+
+// TableName is the table of the outbox events
+const TableName = "outbox_event"
+
+// Outbox writes the domain events into the storage of models.OutboxEvent,
+// the Relay delivers them to the sinks once their transaction is committed
+type Outbox struct {
+	storage data.GenericStorage
+	wake    chan struct{}
+}
+
+// New creates an outbox writing the events into the storage of models.OutboxEvent
+func New(storage data.GenericStorage) *Outbox {
+	return &Outbox{
+		storage: storage,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Publish writes the event of the topic with the key and the payload marshaled as json,
+// with the context of the change so the event is only delivered when the transaction of the change is committed.
+// The relay is woken up once the transaction is committed.
+func (o *Outbox) Publish(ctx context.Context, topic string, key string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal the payload of %s: %w", topic, err)
+	}
+
+	err = o.storage.Insert(ctx, &models.OutboxEvent{
+		Topic:         topic,
+		Key:           key,
+		Payload:       b,
+		NextAttemptAt: utils.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+
+	data.AfterCommit(ctx, func(context.Context) {
+		select {
+		case o.wake <- struct{}{}:
+		default:
+		}
+	})
+	return nil
+}
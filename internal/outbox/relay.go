@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/models"
+	"github.com/riskibarqy/go-template/utils"
+)
+
+// default settings of the relay
+const (
+	defaultInterval   = 5 * time.Second
+	defaultBatchSize  = 100
+	defaultLease      = 60      // seconds an event is held by the relay delivering it
+	defaultMaxBackoff = 60 * 60 // seconds between the retries of an event at most
+)
+
+// Relay delivers the pending events of the outbox to the sinks in the order they were published,
+// a failing event is retried later without holding back the next events.
+// The delivery is at least once: an event is delivered again when the relay stops before marking it,
+// or to every sink when one of them fails, so the sinks must be idempotent on the id of the event.
+// Several relays may run at once, an event is claimed by a single relay for the lease.
+type Relay struct {
+	outbox    *Outbox
+	sinks     []Sink
+	interval  time.Duration
+	batchSize int
+}
+
+// NewRelay creates a relay delivering the events of the outbox to the sinks
+func NewRelay(outbox *Outbox, sinks ...Sink) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		sinks:     sinks,
+		interval:  defaultInterval,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// SetInterval sets how often the relay polls the outbox, besides being woken up by the published events
+func (r *Relay) SetInterval(interval time.Duration) *Relay {
+	r.interval = interval
+	return r
+}
+
+// Run delivers the pending events until the context is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			delivered, err := r.RelayOnce(ctx)
+			if err != nil {
+				log.Printf("Failed to relay the outbox events: %v", err)
+			}
+			// a full batch means more events are pending
+			if err != nil || delivered < r.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.outbox.wake:
+		}
+	}
+}
+
+// RelayOnce delivers a batch of the pending events and returns the number of events it handled.
+// An event failing to be claimed or marked is logged and left to a later batch without holding back the next events,
+// the errors are returned along with the number of the events handled before and after them.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	// the events are read right after being committed, the replicas may lag behind
+	ctx = data.WithPrimary(ctx)
+
+	var events []*models.OutboxEvent
+	err := r.outbox.storage.WhereQuery(ctx, &events, data.NewQuery(
+		data.IsNull("delivered_at"),
+		data.Lte("next_attempt_at", utils.Now()),
+	).OrderBy("id", data.Asc).Limit(r.batchSize))
+	if err != nil {
+		return 0, err
+	}
+
+	handled := 0
+	errs := []error{}
+	for _, event := range events {
+		err := r.relay(ctx, event)
+		if err != nil {
+			log.Printf("Failed to relay the outbox event %d %s: %v", event.ID, event.Topic, err)
+			errs = append(errs, fmt.Errorf("relay the outbox event %d: %w", event.ID, err))
+			continue
+		}
+		handled++
+	}
+
+	return handled, errors.Join(errs...)
+}
+
+// relay claims the event and delivers it, the events claimed by another relay are skipped
+func (r *Relay) relay(ctx context.Context, event *models.OutboxEvent) error {
+	claimed, err := r.claim(ctx, event)
+	if err != nil || !claimed {
+		return err
+	}
+
+	return r.deliver(ctx, event)
+}
+
+// claim holds the event for the lease so the other relays skip it,
+// it reports false when another relay claimed it first
+func (r *Relay) claim(ctx context.Context, event *models.OutboxEvent) (bool, error) {
+	lease := utils.Now() + defaultLease
+	claimed, err := r.outbox.storage.UpdateWhere(ctx, map[string]interface{}{
+		"next_attempt_at": lease,
+	}, "id = :id AND next_attempt_at = :next_attempt_at", map[string]interface{}{
+		"id":              event.ID,
+		"next_attempt_at": event.NextAttemptAt,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	event.NextAttemptAt = lease
+	return claimed == 1, nil
+}
+
+// deliver sends the event to every sink, the event is marked as delivered when they all succeed
+// and is retried with an exponential backoff otherwise
+func (r *Relay) deliver(ctx context.Context, event *models.OutboxEvent) error {
+	var errDeliver error
+	for _, sink := range r.sinks {
+		errDeliver = sink.Deliver(ctx, event)
+		if errDeliver != nil {
+			break
+		}
+	}
+
+	now := utils.Now()
+	if errDeliver == nil {
+		event.DeliveredAt = &now
+		return r.outbox.storage.UpdateFields(ctx, event, "delivered_at")
+	}
+
+	message := errDeliver.Error()
+	event.Attempts++
+	event.LastError = &message
+	event.NextAttemptAt = now + backoff(event.Attempts)
+	log.Printf("Failed to deliver the outbox event %d %s, attempt %d: %v", event.ID, event.Topic, event.Attempts, errDeliver)
+	return r.outbox.storage.UpdateFields(ctx, event, "attempts", "last_error", "next_attempt_at")
+}
+
+// backoff returns the seconds to wait before the next attempt, doubling after each attempt
+func backoff(attempts int) int {
+	seconds := 1
+	for i := 1; i < attempts && seconds < defaultMaxBackoff; i++ {
+		seconds *= 2
+	}
+	if seconds > defaultMaxBackoff {
+		return defaultMaxBackoff
+	}
+	return seconds
+}
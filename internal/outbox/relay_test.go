@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/models"
+	_ "modernc.org/sqlite"
+)
+
+// failingStorage fails the updates of the event of the id, as a database failing halfway through a batch
+type failingStorage struct {
+	data.GenericStorage
+	eventID int
+}
+
+func (s *failingStorage) UpdateFields(ctx context.Context, elem interface{}, columns ...string) error {
+	if event, ok := elem.(*models.OutboxEvent); ok && event.ID == s.eventID {
+		return errors.New("connection reset")
+	}
+	return s.GenericStorage.UpdateFields(ctx, elem, columns...)
+}
+
+// recordingSink records the topics of the delivered events and fails the topic to fail
+type recordingSink struct {
+	fail      string
+	delivered []string
+}
+
+func (s *recordingSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	if event.Topic == s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.delivered = append(s.delivered, event.Topic)
+	return nil
+}
+
+// openOutbox opens a sqlite database created from the sqlite schema and returns the storage of its events
+func openOutbox(t *testing.T) data.GenericStorage {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+	return data.NewStorage[models.OutboxEvent](db, TableName).Generic()
+}
+
+// publishAll publishes an event of each topic, with the ids 1, 2, ...
+func publishAll(t *testing.T, o *Outbox, topics ...string) {
+	t.Helper()
+
+	for _, topic := range topics {
+		err := o.Publish(context.Background(), topic, "key", map[string]string{"topic": topic})
+		if err != nil {
+			t.Fatalf("Publish(%s): %v", topic, err)
+		}
+	}
+}
+
+func TestRelayOnceContinuesAfterAFailingEvent(t *testing.T) {
+	storage := openOutbox(t)
+	sink := &recordingSink{}
+	publishAll(t, New(storage), "first", "second", "third")
+
+	// the event 2 can't be marked as delivered
+	relay := NewRelay(New(&failingStorage{GenericStorage: storage, eventID: 2}), sink)
+	handled, err := relay.RelayOnce(context.Background())
+	if err == nil {
+		t.Errorf("RelayOnce() error = nil, want the error of the event 2")
+	}
+	if handled != 2 {
+		t.Errorf("RelayOnce() handled %d events, want 2", handled)
+	}
+	if len(sink.delivered) != 3 {
+		t.Errorf("the sink got %v, want the 3 events", sink.delivered)
+	}
+
+	var pending []*models.OutboxEvent
+	err = storage.WhereQuery(context.Background(), &pending, data.NewQuery(data.IsNull("delivered_at")))
+	if err != nil {
+		t.Fatalf("WhereQuery: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != 2 {
+		t.Errorf("%d events are pending, want the event 2 only", len(pending))
+	}
+}
+
+func TestRelayOnceRetriesAFailingDelivery(t *testing.T) {
+	storage := openOutbox(t)
+	sink := &recordingSink{fail: "second"}
+	o := New(storage)
+	publishAll(t, o, "first", "second", "third")
+
+	handled, err := NewRelay(o, sink).RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RelayOnce: %v", err)
+	}
+	if handled != 3 {
+		t.Errorf("RelayOnce() handled %d events, want 3", handled)
+	}
+	if len(sink.delivered) != 2 || sink.delivered[0] != "first" || sink.delivered[1] != "third" {
+		t.Errorf("the sink got %v, want [first third]", sink.delivered)
+	}
+
+	event := &models.OutboxEvent{}
+	err = storage.FindByID(context.Background(), event, 2)
+	if err != nil {
+		t.Fatalf("FindByID: %v", err)
+	}
+	if event.DeliveredAt != nil || event.Attempts != 1 || event.LastError == nil || *event.LastError != "sink unavailable" {
+		t.Errorf("the failed event has %d attempts and the error %v, want a retry after 1 attempt", event.Attempts, event.LastError)
+	}
+
+	// the failed event waits for its backoff
+	handled, err = NewRelay(o, sink).RelayOnce(context.Background())
+	if err != nil || handled != 0 {
+		t.Errorf("RelayOnce() again = %d, %v, want nothing to relay", handled, err)
+	}
+}
@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/riskibarqy/go-template/models"
+)
+
+// Sink delivers the outbox events to another service
+type Sink interface {
+	Deliver(ctx context.Context, event *models.OutboxEvent) error
+}
+
+// LogSink logs the events, for development
+type LogSink struct{}
+
+// Deliver implements Sink
+func (LogSink) Deliver(_ context.Context, event *models.OutboxEvent) error {
+	log.Printf("Outbox event %d %s %s: %s", event.ID, event.Topic, event.Key, event.Payload)
+	return nil
+}
+
+// WebhookSink posts the events as json to an url, any response but a 2xx fails the delivery.
+// The id of the event is sent as the Idempotency-Key header so the receiver can drop the redeliveries.
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a sink posting the events to the url
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Deliver implements Sink
+func (s *WebhookSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.Itoa(event.ID))
+	req.Header.Set("X-Event-Topic", event.Topic)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s responded %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// RedisStreamSink adds the events to a redis stream
+type RedisStreamSink struct {
+	client *redis.Client
+	stream string
+}
+
+// NewRedisStreamSink creates a sink adding the events to the stream
+func NewRedisStreamSink(client *redis.Client, stream string) *RedisStreamSink {
+	return &RedisStreamSink{
+		client: client,
+		stream: stream,
+	}
+}
+
+// Deliver implements Sink
+func (s *RedisStreamSink) Deliver(ctx context.Context, event *models.OutboxEvent) error {
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		Values: map[string]interface{}{
+			"id":      event.ID,
+			"topic":   event.Topic,
+			"key":     event.Key,
+			"payload": string(event.Payload),
+		},
+	}).Err()
+}
@@ -2,7 +2,6 @@ package postgres
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/riskibarqy/go-template/datatransfers"
 	"github.com/riskibarqy/go-template/internal/data"
@@ -15,48 +14,49 @@ type PostgresStorage struct {
 	Storage data.GenericStorage
 }
 
-// FindAll find all users
-func (s *PostgresStorage) FindAll(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, *types.Error) {
-
-	users := []*models.User{}
-	where := `"deleted_at" IS NULL`
+// findAllQuery builds the query filtering the users by the params
+func findAllQuery(params *datatransfers.FindAllParams) *data.Query {
+	query := data.NewQuery()
 
 	if params.UserID != 0 {
-		where += ` AND "id" = :userId`
+		query.Where(data.Eq("id", params.UserID))
 	}
 	if params.Email != "" {
-		where += ` AND "email" ILIKE :email`
+		query.Where(data.ILike("email", params.Email))
 	}
 	if params.Name != "" {
-		where += ` AND "name" ILIKE :name`
+		query.Where(data.ILike("name", params.Name))
 	}
 	if params.Search != "" {
-		where += ` AND "name" ILIKE :search`
+		query.Where(data.ILike("name", "%"+params.Search+"%"))
 	}
 	if params.Token != "" {
-		where += ` AND "token" ILIKE :token`
+		query.Where(data.ILike("token", params.Token))
 	}
 	if len(params.UserIDs) > 0 {
-		where += ` AND "id" in (:userIds)`
+		query.Where(data.In("id", params.UserIDs))
 	}
+	query.OrderBy("id", data.Desc)
+
+	return query
+}
+
+// FindAll find all users and the total number of users matching the params
+func (s *PostgresStorage) FindAll(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, int, *types.Error) {
+	users := []*models.User{}
+	query := findAllQuery(params)
+
+	var total int
+	var err error
 	if params.Page != 0 && params.Limit != 0 {
-		where = fmt.Sprintf(`%s ORDER BY "id" DESC LIMIT :limit OFFSET :offset`, where)
+		query.Page(params.Page, params.Limit)
+		total, err = s.Storage.FindPage(ctx, &users, query)
 	} else {
-		where = fmt.Sprintf(`%s ORDER BY "id" DESC`, where)
-	}
-
-	err := s.Storage.Where(ctx, &users, where, map[string]interface{}{
-		"userId":  params.UserID,
-		"userIds": params.UserIDs,
-		"limit":   params.Limit,
-		"email":   params.Email,
-		"name":    params.Name,
-		"search":  "%" + params.Search + "%",
-		"offset":  ((params.Page - 1) * params.Limit),
-		"token":   params.Token,
-	})
+		err = s.Storage.WhereQuery(ctx, &users, query)
+		total = len(users)
+	}
 	if err != nil {
-		return nil, &types.Error{
+		return nil, 0, &types.Error{
 			Path:    ".UserPostgresStorage->FindAll()",
 			Message: err.Error(),
 			Error:   err,
@@ -64,12 +64,31 @@ func (s *PostgresStorage) FindAll(ctx context.Context, params *datatransfers.Fin
 		}
 	}
 
-	return users, nil
+	return users, total, nil
+}
+
+// FindAllCursor find a keyset page of users starting after params.Cursor
+// and returns the cursor of the next page, empty when there is no next page
+func (s *PostgresStorage) FindAllCursor(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, string, *types.Error) {
+	users := []*models.User{}
+	query := findAllQuery(params).After(params.Cursor).Limit(params.Limit)
+
+	nextCursor, err := s.Storage.FindCursor(ctx, &users, query)
+	if err != nil {
+		return nil, "", &types.Error{
+			Path:    ".UserPostgresStorage->FindAllCursor()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "pq-error",
+		}
+	}
+
+	return users, nextCursor, nil
 }
 
 // FindByID find user by its id
 func (s *PostgresStorage) FindByID(ctx context.Context, userID int) (*models.User, *types.Error) {
-	users, err := s.FindAll(ctx, &datatransfers.FindAllParams{
+	users, _, err := s.FindAll(ctx, &datatransfers.FindAllParams{
 		UserID: userID,
 	})
 	if err != nil {
@@ -91,7 +110,7 @@ func (s *PostgresStorage) FindByID(ctx context.Context, userID int) (*models.Use
 
 // FindByEmail find user by its email
 func (s *PostgresStorage) FindByEmail(ctx context.Context, email string) (*models.User, *types.Error) {
-	users, err := s.FindAll(ctx, &datatransfers.FindAllParams{
+	users, _, err := s.FindAll(ctx, &datatransfers.FindAllParams{
 		Email: email,
 	})
 	if err != nil {
@@ -113,7 +132,7 @@ func (s *PostgresStorage) FindByEmail(ctx context.Context, email string) (*model
 
 // FindByToken find user by its token
 func (s *PostgresStorage) FindByToken(ctx context.Context, token string) (*models.User, *types.Error) {
-	users, err := s.FindAll(ctx, &datatransfers.FindAllParams{
+	users, _, err := s.FindAll(ctx, &datatransfers.FindAllParams{
 		Token: token,
 	})
 	if err != nil {
@@ -163,6 +182,21 @@ func (s *PostgresStorage) Update(ctx context.Context, user *models.User) (*model
 	return user, nil
 }
 
+// UpdateFields update only the columns of the user
+func (s *PostgresStorage) UpdateFields(ctx context.Context, user *models.User, columns ...string) (*models.User, *types.Error) {
+	err := s.Storage.UpdateFields(ctx, user, columns...)
+	if err != nil {
+		return nil, &types.Error{
+			Path:    ".UserPostgresStorage->UpdateFields()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "pq-error",
+		}
+	}
+
+	return user, nil
+}
+
 // Delete delete a user
 func (s *PostgresStorage) Delete(ctx context.Context, userID int) *types.Error {
 	err := s.Storage.Delete(ctx, userID)
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/datatransfers"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/models"
+	_ "modernc.org/sqlite"
+)
+
+// openStorage opens a sqlite database created from the sqlite schema and returns the user storage of it
+func openStorage(t *testing.T) *PostgresStorage {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "user.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+	// applying the schema again leaves the tables as is
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("ApplySchema again: %v", err)
+	}
+
+	return NewPostgresStorage(data.NewStorage[models.User](db, "user").Generic())
+}
+
+// clientContext returns the context of the client
+func clientContext(clientID int) context.Context {
+	return context.WithValue(context.Background(), appcontext.KeyClientID, clientID)
+}
+
+func TestSQLiteSchemaMatchesTheModels(t *testing.T) {
+	openStorage(t)
+
+	issues, err := data.VerifySchema(context.Background())
+	if err != nil {
+		t.Fatalf("VerifySchema: %v", err)
+	}
+	for _, issue := range issues {
+		t.Errorf("schema issue: %s", issue)
+	}
+}
+
+func TestUserStorageOnSQLite(t *testing.T) {
+	s := openStorage(t)
+	ctx := clientContext(1)
+
+	users := []*models.User{}
+	for _, u := range []struct{ name, email string }{
+		{"Alice", "alice@example.com"},
+		{"Bob", "bob@example.com"},
+		{"Carol", "carol@example.com"},
+	} {
+		token := "token-" + u.name
+		user, errType := s.Insert(ctx, &models.User{Name: u.name, Email: u.email, Password: "x", Token: &token})
+		if errType != nil {
+			t.Fatalf("Insert(%s): %v", u.name, errType.Error)
+		}
+		if user.ID == 0 || user.Version != 1 || user.ClientID != 1 {
+			t.Fatalf("Insert(%s) = id %d, version %d, client %d, want the generated id, version 1 and client 1",
+				u.name, user.ID, user.Version, user.ClientID)
+		}
+		users = append(users, user)
+	}
+
+	// the email is unique
+	_, errType := s.Insert(ctx, &models.User{Name: "Alice 2", Email: "alice@example.com", Password: "x"})
+	if errType == nil || !errors.Is(errType.Error, data.ErrAlreadyExist) {
+		t.Errorf("Insert() of a taken email = %v, want ErrAlreadyExist", errType)
+	}
+
+	found, errType := s.FindByEmail(ctx, "alice@example.com")
+	if errType != nil || found.ID != users[0].ID {
+		t.Errorf("FindByEmail() = %v, %v, want Alice", found, errType)
+	}
+	found, errType = s.FindByToken(ctx, "token-Bob")
+	if errType != nil || found.ID != users[1].ID {
+		t.Errorf("FindByToken() = %v, %v, want Bob", found, errType)
+	}
+
+	all, total, errType := s.FindAll(ctx, &datatransfers.FindAllParams{Search: "o", Page: 1, Limit: 1})
+	if errType != nil {
+		t.Fatalf("FindAll: %v", errType.Error)
+	}
+	if total != 2 || len(all) != 1 || all[0].Name != "Carol" {
+		t.Errorf("FindAll() = %d users of %d, want Carol of 2", len(all), total)
+	}
+
+	page, cursor, errType := s.FindAllCursor(ctx, &datatransfers.FindAllParams{Limit: 2})
+	if errType != nil {
+		t.Fatalf("FindAllCursor: %v", errType.Error)
+	}
+	next, nextCursor, errType := s.FindAllCursor(ctx, &datatransfers.FindAllParams{Limit: 2, Cursor: cursor})
+	if errType != nil {
+		t.Fatalf("FindAllCursor of the next page: %v", errType.Error)
+	}
+	if len(page) != 2 || page[0].Name != "Carol" || page[1].Name != "Bob" || len(next) != 1 || next[0].Name != "Alice" || nextCursor != "" {
+		t.Errorf("FindAllCursor() paged %d then %d users, want Carol, Bob then Alice", len(page), len(next))
+	}
+
+	alice := users[0]
+	alice.Name = "Alice B"
+	updated, errType := s.Update(ctx, alice)
+	if errType != nil {
+		t.Fatalf("Update: %v", errType.Error)
+	}
+	if updated.Version != 2 {
+		t.Errorf("Update() moved to the version %d, want 2", updated.Version)
+	}
+	alice.Version = 1
+	_, errType = s.Update(ctx, alice)
+	if errType == nil || !errors.Is(errType.Error, data.ErrConflict) {
+		t.Errorf("Update() of a stale version = %v, want ErrConflict", errType)
+	}
+
+	// the users of another client are out of reach
+	_, errType = s.FindByID(clientContext(2), users[1].ID)
+	if errType == nil || !errors.Is(errType.Error, data.ErrNotFound) {
+		t.Errorf("FindByID() of another client = %v, want ErrNotFound", errType)
+	}
+
+	errType = s.Delete(ctx, users[1].ID)
+	if errType != nil {
+		t.Fatalf("Delete: %v", errType.Error)
+	}
+	_, errType = s.FindByID(ctx, users[1].ID)
+	if errType == nil || !errors.Is(errType.Error, data.ErrNotFound) {
+		t.Errorf("FindByID() of a deleted user = %v, want ErrNotFound", errType)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	"github.com/riskibarqy/go-template/config"
 	"github.com/riskibarqy/go-template/datatransfers"
+	"github.com/riskibarqy/go-template/internal/appcontext"
 	"github.com/riskibarqy/go-template/internal/data"
 	"github.com/riskibarqy/go-template/internal/redis"
 	"github.com/riskibarqy/go-template/internal/types"
@@ -19,6 +20,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// TableName is the table of the users
+const TableName = "user"
+
 // Errors
 var (
 	ErrWrongPassword      = errors.New("wrong password")
@@ -30,20 +34,43 @@ var (
 	ErrNameAlreadyExist   = errors.New(("name already exits"))
 )
 
+// The topics of the user events
+const (
+	TopicUserCreated = "user.created"
+	TopicUserUpdated = "user.updated"
+	TopicUserDeleted = "user.deleted"
+)
+
+// Publisher publishes the user events within the transaction of the change, see outbox.Outbox
+type Publisher interface {
+	Publish(ctx context.Context, topic string, key string, payload interface{}) error
+}
+
+// Event is the payload of the user events, the secrets of the user are left out
+type Event struct {
+	ID       int    `json:"id"`
+	ClientID int    `json:"clientId"`
+	Name     string `json:"name,omitempty"`
+	Email    string `json:"email,omitempty"`
+}
+
 // Storage represents the user storage interface
 type Storage interface {
-	FindAll(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, *types.Error)
+	FindAll(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, int, *types.Error)
+	FindAllCursor(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, string, *types.Error)
 	FindByID(ctx context.Context, userID int) (*models.User, *types.Error)
 	FindByEmail(ctx context.Context, email string) (*models.User, *types.Error)
 	FindByToken(ctx context.Context, token string) (*models.User, *types.Error)
 	Insert(ctx context.Context, user *models.User) (*models.User, *types.Error)
 	Update(ctx context.Context, user *models.User) (*models.User, *types.Error)
+	UpdateFields(ctx context.Context, user *models.User, columns ...string) (*models.User, *types.Error)
 	Delete(ctx context.Context, userID int) *types.Error
 }
 
 // ServiceInterface represents the user service interface
 type ServiceInterface interface {
 	ListUsers(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, int, *types.Error)
+	ListUsersCursor(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, string, *types.Error)
 	GetUser(ctx context.Context, userID int) (*models.User, *types.Error)
 	CreateUser(ctx context.Context, params *models.User) (*models.User, *types.Error)
 	UpdateUser(ctx context.Context, userID int, params *models.User) (*models.User, *types.Error)
@@ -57,12 +84,13 @@ type ServiceInterface interface {
 // Service is the domain logic implementation of user Service interface
 type Service struct {
 	userStorage Storage
+	publisher   Publisher
 }
 
 func (s *Service) ListUsers(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, int, *types.Error) {
 	// Generate cache key
 	byteParams, _ := jsoniter.Marshal(params)
-	cacheKey := fmt.Sprintf("ListUsers-%s", utils.EncodeHexMD5(string(byteParams)))
+	cacheKey := tenantCacheKey(ctx, fmt.Sprintf("ListUsers-%s", utils.EncodeHexMD5(string(byteParams))))
 
 	// Try to get users from Redis cache
 	cached, count, errCache := redis.GetListCache(ctx, cacheKey)
@@ -74,8 +102,8 @@ func (s *Service) ListUsers(ctx context.Context, params *datatransfers.FindAllPa
 		}
 	}
 
-	// Fetch users from database
-	users, err := s.userStorage.FindAll(ctx, params)
+	// Fetch users and the total count from database
+	users, count, err := s.userStorage.FindAll(ctx, params)
 	if err != nil {
 		err.Path = ".UserService->ListUsers()" + err.Path
 		return nil, 0, err
@@ -92,17 +120,29 @@ func (s *Service) ListUsers(ctx context.Context, params *datatransfers.FindAllPa
 			log.Printf("Failed to set user cache: %v", err)
 		}
 
-		if err := redis.SetCache(ctxChild, fmt.Sprintf("cnt-%s", cacheKey), strconv.Itoa(len(users)), expiration); err != nil {
+		if err := redis.SetCache(ctxChild, fmt.Sprintf("cnt-%s", cacheKey), strconv.Itoa(count), expiration); err != nil {
 			log.Printf("Failed to set user count cache: %v", err)
 		}
 	}()
 
-	return users, len(users), nil
+	return users, count, nil
+}
+
+// ListUsersCursor lists a keyset page of users starting after params.Cursor
+// and returns the cursor of the next page
+func (s *Service) ListUsersCursor(ctx context.Context, params *datatransfers.FindAllParams) ([]*models.User, string, *types.Error) {
+	users, nextCursor, err := s.userStorage.FindAllCursor(ctx, params)
+	if err != nil {
+		err.Path = ".UserService->ListUsersCursor()" + err.Path
+		return nil, "", err
+	}
+
+	return users, nextCursor, nil
 }
 
 // GetUser is get user
 func (s *Service) GetUser(ctx context.Context, userID int) (*models.User, *types.Error) {
-	cacheKey := fmt.Sprintf("GetUser-%d", userID)
+	cacheKey := tenantCacheKey(ctx, fmt.Sprintf("GetUser-%d", userID))
 
 	// Try to get users from Redis cache
 	cached, errCache := redis.GetCache(ctx, cacheKey)
@@ -135,16 +175,26 @@ func (s *Service) GetUser(ctx context.Context, userID int) (*models.User, *types
 	return user, nil
 }
 
-// CreateUser create user
+// currentUser reads the user from the primary database, bypassing the cache and the replicas,
+// so an update without the version read by the client is checked against the stored version
+func (s *Service) currentUser(ctx context.Context, userID int) (*models.User, *types.Error) {
+	user, err := s.userStorage.FindByID(data.WithPrimary(ctx), userID)
+	if err != nil {
+		err.Path = ".UserService->currentUser()" + err.Path
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateUser create user, within the client of the context
 func (s *Service) CreateUser(ctx context.Context, params *models.User) (*models.User, *types.Error) {
-	users, _, errType := s.ListUsers(ctx, &datatransfers.FindAllParams{
-		Email: params.Email,
-	})
+	exists, errType := s.emailExists(ctx, params.Email)
 	if errType != nil {
 		errType.Path = ".UserService->CreateUser()" + errType.Path
 		return nil, errType
 	}
-	if len(users) > 0 {
+	if exists {
 		return nil, &types.Error{
 			Path:    ".UserService->CreateUser()",
 			Message: ErrEmailAlreadyExists.Error(),
@@ -163,16 +213,12 @@ func (s *Service) CreateUser(ctx context.Context, params *models.User) (*models.
 		}
 	}
 
-	now := utils.Now()
-
 	user := &models.User{
 		Name:           params.Name,
 		Email:          params.Email,
 		Password:       string(bcryptHash),
 		Token:          nil,
 		TokenExpiredAt: nil,
-		CreatedAt:      now,
-		UpdatedAt:      &now,
 	}
 
 	user, errType = s.userStorage.Insert(ctx, user)
@@ -181,25 +227,29 @@ func (s *Service) CreateUser(ctx context.Context, params *models.User) (*models.
 		return nil, errType
 	}
 
+	errType = s.publish(ctx, TopicUserCreated, user)
+	if errType != nil {
+		errType.Path = ".UserService->CreateUser()" + errType.Path
+		return nil, errType
+	}
+
 	return user, nil
 }
 
 // UpdateUser update a user
 func (s *Service) UpdateUser(ctx context.Context, userID int, params *models.User) (*models.User, *types.Error) {
-	user, err := s.GetUser(ctx, userID)
+	user, err := s.currentUser(ctx, userID)
 	if err != nil {
 		err.Path = ".UserService->UpdateUser()" + err.Path
 		return nil, err
 	}
 
-	users, _, err := s.ListUsers(ctx, &datatransfers.FindAllParams{
-		Email: params.Email,
-	})
+	exists, err := s.emailExists(ctx, params.Email)
 	if err != nil {
 		err.Path = ".UserService->UpdateUser()" + err.Path
 		return nil, err
 	}
-	if len(users) > 0 {
+	if exists {
 		return nil, &types.Error{
 			Path:    ".UserService->CreateUser()",
 			Message: data.ErrAlreadyExist.Error(),
@@ -210,6 +260,10 @@ func (s *Service) UpdateUser(ctx context.Context, userID int, params *models.Use
 
 	user.Name = params.Name
 	user.Email = params.Email
+	if params.Version != 0 {
+		// the version the client has read, the update fails when the user has changed since
+		user.Version = params.Version
+	}
 
 	user, err = s.userStorage.Update(ctx, user)
 	if err != nil {
@@ -217,21 +271,19 @@ func (s *Service) UpdateUser(ctx context.Context, userID int, params *models.Use
 		return nil, err
 	}
 
-	go func() {
-		ctxChild := context.Background()
-
-		cacheKey := fmt.Sprintf("GetUser-%d", userID)
+	err = s.publish(ctx, TopicUserUpdated, user)
+	if err != nil {
+		err.Path = ".UserService->UpdateUser()" + err.Path
+		return nil, err
+	}
 
-		// delete user cache
-		if err := redis.DeleteCache(ctxChild, cacheKey); err != nil {
-			log.Printf("Failed to set user cache: %v", err)
-		}
-	}()
+	s.invalidateCache(ctx, userID)
 
 	return user, nil
 }
 
-// DeleteUser delete a user
+// DeleteUser delete a user, it fails with data.ErrNotFound when the user doesn't exist or is already deleted
+// and only then publishes the deletion
 func (s *Service) DeleteUser(ctx context.Context, userID int) *types.Error {
 	err := s.userStorage.Delete(ctx, userID)
 	if err != nil {
@@ -239,23 +291,20 @@ func (s *Service) DeleteUser(ctx context.Context, userID int) *types.Error {
 		return err
 	}
 
-	go func() {
-		ctxChild := context.Background()
+	err = s.publish(ctx, TopicUserDeleted, &models.User{ID: userID, ClientID: clientID(ctx)})
+	if err != nil {
+		err.Path = ".UserService->DeleteUser()" + err.Path
+		return err
+	}
 
-		cacheKey := fmt.Sprintf("GetUser-%d", userID)
-
-		// delete user cache
-		if err := redis.DeleteCache(ctxChild, cacheKey); err != nil {
-			log.Printf("Failed to set user cache: %v", err)
-		}
-	}()
+	s.invalidateCache(ctx, userID)
 
 	return nil
 }
 
 // ChangePassword change password
 func (s *Service) ChangePassword(ctx context.Context, userID int, oldPassword, newPassword string) *types.Error {
-	user, err := s.GetUser(ctx, userID)
+	user, err := s.currentUser(ctx, userID)
 	if err != nil {
 		err.Path = ".UserService->ChangePassword()" + err.Path
 		return err
@@ -282,36 +331,29 @@ func (s *Service) ChangePassword(ctx context.Context, userID int, oldPassword, n
 	}
 
 	user.Password = string(bcryptHash)
-	_, err = s.userStorage.Update(ctx, user)
+	_, err = s.userStorage.UpdateFields(ctx, user, "password")
 	if err != nil {
 		err.Path = ".UserService->ChangePassword()" + err.Path
 		return err
 	}
 
-	go func() {
-		ctxChild := context.Background()
-
-		cacheKey := fmt.Sprintf("GetUser-%d", userID)
-
-		// delete user cache
-		if err := redis.DeleteCache(ctxChild, cacheKey); err != nil {
-			log.Printf("Failed to set user cache: %v", err)
-		}
-	}()
+	s.invalidateCache(ctx, userID)
 
 	return nil
 }
 
 // Login login
 func (s *Service) Login(ctx context.Context, email string, password string) (*datatransfers.LoginResponse, *types.Error) {
-	users, _, err := s.ListUsers(ctx, &datatransfers.FindAllParams{
-		Email: email,
-	})
+	// the token written by the login is read right away by the next requests
+	ctx = data.WithPrimary(ctx)
+
+	// the emails are unique across the clients, the login then runs within the client of the user
+	user, err := s.userStorage.FindByEmail(data.WithoutTenant(ctx), email)
 	if err != nil {
-		err.Path = ".UserService->Login()" + err.Path
-		return nil, err
-	}
-	if len(users) < 1 {
+		if err.Error != data.ErrNotFound {
+			err.Path = ".UserService->Login()" + err.Path
+			return nil, err
+		}
 		return nil, &types.Error{
 			Path:    ".UserService->Login()",
 			Message: ErrWrongEmail.Error(),
@@ -319,8 +361,7 @@ func (s *Service) Login(ctx context.Context, email string, password string) (*da
 			Type:    "validation-error",
 		}
 	}
-
-	user := users[0]
+	ctx = context.WithValue(ctx, appcontext.KeyClientID, user.ClientID)
 	errBcrypt := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if errBcrypt != nil {
 		return nil, &types.Error{
@@ -346,14 +387,15 @@ func (s *Service) Login(ctx context.Context, email string, password string) (*da
 
 	user.Token = &token
 	user.TokenExpiredAt = &tokenExpiredAt
-	user.UpdatedAt = &now
 
-	user, err = s.userStorage.Update(ctx, user)
+	user, err = s.userStorage.UpdateFields(ctx, user, "token", "token_expired_at")
 	if err != nil {
 		err.Path = ".UserService->CreateUser()" + err.Path
 		return nil, err
 	}
 
+	s.invalidateCache(ctx, user.ID)
+
 	return &datatransfers.LoginResponse{
 		SessionID: token,
 		User:      user,
@@ -370,17 +412,22 @@ func (s *Service) Logout(ctx context.Context, token string) *types.Error {
 
 	user.Token = nil
 	user.TokenExpiredAt = nil
-	_, err = s.userStorage.Update(ctx, user)
+	_, err = s.userStorage.UpdateFields(ctx, user, "token", "token_expired_at")
 	if err != nil {
 		err.Path = ".UserService->Logout()" + err.Path
 		return err
 	}
 
+	s.invalidateCache(ctx, user.ID)
+
 	return nil
 }
 
-// GetByToken get user by its token
+// GetByToken get user by its token, whatever its client as the client is only known from the user
 func (s *Service) GetByToken(ctx context.Context, token string) (*models.User, *types.Error) {
+	// read the token from the primary, a replica may not have the token of a fresh login yet
+	ctx = data.WithoutTenant(data.WithPrimary(ctx))
+
 	user, err := s.userStorage.FindByToken(ctx, token)
 	if err != nil {
 		err.Path = ".UserService->GetByToken()" + err.Path
@@ -390,11 +437,75 @@ func (s *Service) GetByToken(ctx context.Context, token string) (*models.User, *
 	return user, nil
 }
 
-// NewService creates a new user AppService
+// emailExists reports whether a user of any client has the email, the emails are unique across the clients
+func (s *Service) emailExists(ctx context.Context, email string) (bool, *types.Error) {
+	_, err := s.userStorage.FindByEmail(data.WithoutTenant(ctx), email)
+	if err != nil {
+		if err.Error != data.ErrNotFound {
+			err.Path = ".UserService->emailExists()" + err.Path
+			return false, err
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// publish publishes the event of the topic for the user, the event of a deleted user only holds its ids
+func (s *Service) publish(ctx context.Context, topic string, user *models.User) *types.Error {
+	if s.publisher == nil {
+		return nil
+	}
+
+	err := s.publisher.Publish(ctx, topic, strconv.Itoa(user.ID), &Event{
+		ID:       user.ID,
+		ClientID: user.ClientID,
+		Name:     user.Name,
+		Email:    user.Email,
+	})
+	if err != nil {
+		return &types.Error{
+			Path:    ".UserService->publish()",
+			Message: err.Error(),
+			Error:   err,
+			Type:    "golang-error",
+		}
+	}
+	return nil
+}
+
+// invalidateCache deletes the cached user once the transaction of the context is committed,
+// the cache would hold the rolled back user otherwise
+func (s *Service) invalidateCache(ctx context.Context, userID int) {
+	cacheKey := tenantCacheKey(ctx, fmt.Sprintf("GetUser-%d", userID))
+
+	data.AfterCommit(ctx, func(ctx context.Context) {
+		if err := redis.DeleteCache(ctx, cacheKey); err != nil {
+			log.Printf("Failed to delete user cache: %v", err)
+		}
+	})
+}
+
+// tenantCacheKey prefixes the cache key with the client of the context, so the clients don't share their cached users
+func tenantCacheKey(ctx context.Context, key string) string {
+	return fmt.Sprintf("client-%d-%s", clientID(ctx), key)
+}
+
+// clientID returns the client of the context, zero when it has none
+func clientID(ctx context.Context) int {
+	if c := appcontext.ClientID(ctx); c != nil {
+		return *c
+	}
+	return 0
+}
+
+// NewService creates a new user AppService, the events are published with the publisher
 func NewService(
 	userStorage Storage,
+	publisher Publisher,
 ) *Service {
 	return &Service{
 		userStorage: userStorage,
+		publisher:   publisher,
 	}
 }
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/riskibarqy/go-template/databases"
+	"github.com/riskibarqy/go-template/internal/appcontext"
+	"github.com/riskibarqy/go-template/internal/data"
+	"github.com/riskibarqy/go-template/internal/redis"
+	"github.com/riskibarqy/go-template/internal/user/postgres"
+	"github.com/riskibarqy/go-template/models"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	// nothing listens on the port, the cache always misses
+	redis.RedisClient = goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+}
+
+// openUserDB opens a sqlite database created from the sqlite schema in the temporary directory of the test
+func openUserDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := sqlx.Open("sqlite", filepath.Join(t.TempDir(), "user.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	err = databases.ApplySchema(db, "sqlite")
+	if err != nil {
+		t.Fatalf("create the tables: %v", err)
+	}
+	return db
+}
+
+// clientContext returns the context of the first client
+func clientContext() context.Context {
+	return context.WithValue(context.Background(), appcontext.KeyClientID, 1)
+}
+
+func TestUpdateUserChecksTheVersionOfThePrimary(t *testing.T) {
+	primary, replica := openUserDB(t), openUserDB(t)
+	ctx := clientContext()
+
+	// the replica lags behind, it still holds the first version of the user
+	for _, db := range []*sqlx.DB{primary, replica} {
+		err := data.NewStorage[models.User](db, TableName).Insert(ctx, &models.User{Name: "Alice", Email: "alice@example.com", Password: "x"})
+		if err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	_, err := primary.Exec(`UPDATE "user" SET name = 'Alice B', version = 2`)
+	if err != nil {
+		t.Fatalf("update the primary: %v", err)
+	}
+
+	replicas := data.NewReplicaSet(time.Hour, replica)
+	t.Cleanup(replicas.Close)
+	storage := data.NewStorage[models.User](primary, TableName).SetReplicas(replicas)
+	service := NewService(postgres.NewPostgresStorage(storage.Generic()), nil)
+
+	user, errType := service.UpdateUser(ctx, 1, &models.User{Name: "Alice C", Email: "alice.c@example.com"})
+	if errType != nil {
+		t.Fatalf("UpdateUser() without version = %v, want the update of the current version", errType.Error)
+	}
+	if user.Version != 3 {
+		t.Errorf("the user moved to the version %d, want 3", user.Version)
+	}
+
+	_, errType = service.UpdateUser(ctx, 1, &models.User{Name: "Alice D", Email: "alice.d@example.com", Version: 2})
+	if errType == nil || !errors.Is(errType.Error, data.ErrConflict) {
+		t.Errorf("UpdateUser() with a stale version = %v, want ErrConflict", errType)
+	}
+}
+
+// recordingPublisher records the topics and keys of the published events
+type recordingPublisher struct {
+	published []string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, topic string, key string, payload interface{}) error {
+	p.published = append(p.published, topic+" "+key)
+	return nil
+}
+
+func TestDeleteUserOnlyPublishesARealDelete(t *testing.T) {
+	db := openUserDB(t)
+	storage := data.NewStorage[models.User](db, TableName)
+	publisher := &recordingPublisher{}
+	service := NewService(postgres.NewPostgresStorage(storage.Generic()), publisher)
+
+	user := &models.User{Name: "Alice", Email: "alice@example.com", Password: "x"}
+	err := storage.Insert(clientContext(), user)
+	if err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+
+	errType := service.DeleteUser(clientContext(), user.ID)
+	if errType != nil {
+		t.Fatalf("DeleteUser: %v", errType.Error)
+	}
+
+	otherClient := context.WithValue(context.Background(), appcontext.KeyClientID, 2)
+	for _, missing := range []struct {
+		name string
+		ctx  context.Context
+		id   int
+	}{
+		{"an already deleted user", clientContext(), user.ID},
+		{"a missing user", clientContext(), user.ID + 1},
+		{"a user of another client", otherClient, user.ID},
+	} {
+		errType = service.DeleteUser(missing.ctx, missing.id)
+		if errType == nil || !errors.Is(errType.Error, data.ErrNotFound) {
+			t.Errorf("DeleteUser() of %s = %v, want ErrNotFound", missing.name, errType)
+		}
+	}
+
+	want := fmt.Sprintf("%s %d", TopicUserDeleted, user.ID)
+	if len(publisher.published) != 1 || publisher.published[0] != want {
+		t.Errorf("published %v, want [%s]", publisher.published, want)
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+import "github.com/riskibarqy/go-template/internal/data"
+
+// AuditLog models a row change recorded in the audit_log table,
+// it's defined by the data package whose Auditor records it
+type AuditLog = data.AuditLog
+
+// AuditChange is the old and new value of a changed column
+type AuditChange = data.AuditChange
+
+// AuditChanges are the changed columns of an audit log by their name
+type AuditChanges = data.AuditChanges
@@ -0,0 +1,8 @@
+package models
+
+// Timestamps holds the created_at and updated_at columns stamped by the storage,
+// it's embedded by the models so they're mapped as columns of the model
+type Timestamps struct {
+	CreatedAt int  `json:"createdAt" db:"created_at,insertonly"`
+	UpdatedAt *int `json:"updatedAt,omitempty" db:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "encoding/json"
+
+// OutboxEvent models a domain event written to the outbox_event table within the transaction of the change,
+// it's delivered to the sinks by the relay afterwards
+type OutboxEvent struct {
+	ID            int             `json:"id" db:"id"`
+	Topic         string          `json:"topic" db:"topic"`
+	Key           string          `json:"key" db:"event_key"`
+	Payload       json.RawMessage `json:"payload" db:"payload,json"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	LastError     *string         `json:"lastError,omitempty" db:"last_error"`
+	NextAttemptAt int             `json:"nextAttemptAt" db:"next_attempt_at"`
+	DeliveredAt   *int            `json:"deliveredAt,omitempty" db:"delivered_at"`
+	CreatedAt     int             `json:"createdAt" db:"created_at,insertonly"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// SeedHistory models a seeder applied to the database, recorded in the seed_history table
+type SeedHistory struct {
+	Name        string `json:"name" db:"name,pk"`
+	Environment string `json:"environment" db:"environment"`
+	AppliedAt   int    `json:"appliedAt" db:"applied_at"`
+}
@@ -8,9 +8,10 @@ type User struct {
 	Password       string  `json:"password,omitempty" db:"password" validate:"required"`
 	Token          *string `json:"token,omitempty" db:"token"`
 	TokenExpiredAt *int    `json:"tokenExpiredAt,omitempty" db:"token_expired_at"`
-	CreatedAt      int     `json:"createdAt" db:"created_at"`
-	UpdatedAt      *int    `json:"updatedAt,omitempty" db:"updated_at"`
 	DeletedAt      *int    `json:"deletedAt,omitempty" db:"deleted_at"`
+	Version        int     `json:"version" db:"version,lock"`
+	ClientID       int     `json:"clientId" db:"client_id,tenant"`
+	Timestamps
 }
 
 func (u *User) ForPublic() {